@@ -12,6 +12,10 @@ type Config struct {
 	InMemory          bool
 	GCReclaimInterval time.Duration
 	GCDiscardRatio    float64
+
+	// AllowZeroExpiresAt makes the database accept documents whose _expiresAt field holds the zero time.Time value
+	// (see document.ValidateOptions).
+	AllowZeroExpiresAt bool
 }
 
 func defaultConfig() *Config {
@@ -49,3 +53,11 @@ func WithGCReclaimInterval(interval time.Duration) Option {
 		return nil
 	}
 }
+
+// WithZeroExpiresAt allows to store documents whose _expiresAt field holds the zero time.Time value, which are rejected by default.
+func WithZeroExpiresAt(allow bool) Option {
+	return func(c *Config) error {
+		c.AllowZeroExpiresAt = allow
+		return nil
+	}
+}
@@ -1,14 +1,16 @@
 package clover
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	d "github.com/ostafen/clover/v2/document"
 	"github.com/ostafen/clover/v2/index"
 	"github.com/ostafen/clover/v2/internal"
 	"github.com/ostafen/clover/v2/query"
-	uuid "github.com/satori/go.uuid"
 )
 
 // Collection creation errors
@@ -26,8 +28,40 @@ type DB struct {
 }
 
 // CreateCollection creates a new empty collection with the given name.
-func (db *DB) CreateCollection(name string) error {
-	return db.engine.CreateCollection(name)
+// Options can be supplied to customize the collection, provided that the storage engine implements CollectionOptionsCreator:
+// otherwise, ErrNotSupported is returned.
+func (db *DB) CreateCollection(name string, opts ...CollectionOption) error {
+	if len(opts) == 0 {
+		return db.engine.CreateCollection(name)
+	}
+
+	options := CollectionOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	creator, ok := db.engine.(CollectionOptionsCreator)
+	if !ok {
+		return ErrNotSupported
+	}
+	return creator.CreateCollectionWithOptions(name, options)
+}
+
+// CollectionOptions contains the settings of a collection.
+type CollectionOptions struct {
+	// DefaultTTL, if positive, is the time to live of the inserted documents which do not set an explicit expiration.
+	DefaultTTL time.Duration `json:",omitempty"`
+}
+
+// CollectionOption customizes a collection at creation time.
+type CollectionOption func(opts *CollectionOptions)
+
+// WithDefaultTTL makes the documents inserted into the collection expire after ttl, unless they already set their expiration.
+// A zero or negative ttl means no default expiration.
+func WithDefaultTTL(ttl time.Duration) CollectionOption {
+	return func(opts *CollectionOptions) {
+		opts.DefaultTTL = ttl
+	}
 }
 
 // DropCollection removes the collection with the given name, deleting any content on disk.
@@ -40,8 +74,9 @@ func (db *DB) HasCollection(name string) (bool, error) {
 	return db.engine.HasCollection(name)
 }
 
+// NewObjectId returns a new document id, as generated by the ObjectIdProvider configured through document.SetObjectIdProvider.
 func NewObjectId() string {
-	return uuid.NewV4().String()
+	return d.NewObjectId()
 }
 
 // Insert adds the supplied documents to a collection.
@@ -124,6 +159,13 @@ func (db *DB) ForEach(q *query.Query, consumer func(_ *d.Document) bool) error {
 	})
 }
 
+// AnalyzeSchema reports the types observed for each field path across the documents selected by q (see document.AnalyzeSchema).
+func (db *DB) AnalyzeSchema(q *query.Query) (map[string]d.FieldStats, error) {
+	return d.AnalyzeSchema(func(consumer func(doc *d.Document) bool) error {
+		return db.ForEach(q, consumer)
+	})
+}
+
 // Count returns the number of documents which satisfy the query (i.e. len(q.FindAll()) == q.Count()).
 func (db *DB) Count(q *query.Query) (int, error) {
 	q, err := normalizeCriteria(q)
@@ -211,8 +253,135 @@ func (db *DB) ListCollections() ([]string, error) {
 }
 
 // CreateIndex creates an index for the specified for the specified (index, collection) pair.
-func (db *DB) CreateIndex(collection, field string) error {
-	return db.engine.CreateIndex(collection, field)
+// Options can be supplied to customize the index.
+func (db *DB) CreateIndex(collection, field string, opts ...IndexOption) error {
+	info := index.IndexInfo{Field: field, Type: index.IndexSingleField}
+	for _, opt := range opts {
+		opt(&info)
+	}
+	return db.createIndex(collection, info)
+}
+
+// createIndex creates the index described by info. Storage engines which do not implement IndexInfoCreator
+// only support single field indexes without options, thus ErrNotSupported is returned for any other index.
+func (db *DB) createIndex(collection string, info index.IndexInfo) error {
+	if creator, ok := db.engine.(IndexInfoCreator); ok {
+		return creator.CreateIndexWithInfo(collection, info)
+	}
+
+	if info.Type != index.IndexSingleField || len(info.Fields) > 0 || info.KeyFunc != "" || info.Unique || info.Filter != "" {
+		return ErrNotSupported
+	}
+	return db.engine.CreateIndex(collection, info.Field)
+}
+
+// CreateCompoundIndex creates an index on multiple fields of the specified collection, ordered by the first field, then by the second one, and so on.
+// Queries whose criteria require the first field to be equal to a value, and which are sorted by the second field, are served by the index.
+// Documents missing the first field are refused, while missing fields other than the first one are indexed as null.
+// The index is identified by the comma separated list of its fields (e.g. when dropping it).
+func (db *DB) CreateCompoundIndex(collection string, fields []string, opts ...IndexOption) error {
+	info := index.CompoundIndexInfo(fields...)
+	for _, opt := range opts {
+		opt(&info)
+	}
+	return db.createIndex(collection, info)
+}
+
+// CreateIndexesFromDefs creates the indexes described by defs on the specified collection, in order.
+// Together with ListIndexes, whose result can be serialized as JSON, it allows to reproduce the indexes of a collection on a different database.
+// It stops at the first index which cannot be created, leaving the previous ones in place.
+func (db *DB) CreateIndexesFromDefs(collection string, defs []index.IndexInfo) error {
+	for _, info := range defs {
+		if err := db.createIndex(collection, info); err != nil {
+			return fmt.Errorf("cannot create index on field %q: %w", info.Field, err)
+		}
+	}
+	return nil
+}
+
+// IndexOption customizes an index at creation time.
+type IndexOption func(info *index.IndexInfo)
+
+// WithKeyFunc makes the index derive its keys through the KeyFunc registered with the given name (see index.RegisterKeyFunc),
+// so that range queries and sorting through the index follow the custom ordering.
+// Comparisons on the field are evaluated using the same keys, whether the index is used to run the query or not.
+func WithKeyFunc(name string) IndexOption {
+	return func(info *index.IndexInfo) {
+		info.KeyFunc = name
+	}
+}
+
+// WithCaseInsensitive makes the index compare strings regardless of their case, so that equality lookups match any casing
+// (e.g. "Foo@Bar.com" matches "foo@bar.com") and sorting through the index follows the case-folded order of strings.
+// It is a shorthand for WithKeyFunc(index.CaseInsensitiveKeyFunc), thus values other than strings are unaffected.
+func WithCaseInsensitive() IndexOption {
+	return WithKeyFunc(index.CaseInsensitiveKeyFunc)
+}
+
+// WithUnique makes the index refuse documents holding a value already held by another document:
+// inserting or updating such documents fails with index.ErrDuplicateKey. Documents where the field is null or missing are not checked.
+// Creating the index fails with index.ErrDuplicateKey as well if the collection already contains duplicate values.
+func WithUnique() IndexOption {
+	return func(info *index.IndexInfo) {
+		info.Unique = true
+	}
+}
+
+// WithFilter makes the index partial: only the documents satisfying the filter registered with the given name (see RegisterIndexFilter) are indexed.
+// Since the index does not cover the whole collection, it is only used by the queries whose criteria require the filter to hold,
+// that is, by the queries whose criteria are the conjunction of the filter and any other criteria.
+func WithFilter(name string) IndexOption {
+	return func(info *index.IndexInfo) {
+		info.Filter = name
+	}
+}
+
+// ErrIndexFilterNotExist is returned when an index refers to a filter which has not been registered.
+var ErrIndexFilterNotExist = errors.New("no such index filter")
+
+var indexFilters sync.Map
+
+// RegisterIndexFilter makes the supplied criteria available, under the given name, as the filter of partial indexes (see WithFilter).
+// Since only the name of the filter is persisted along with the index, it must be registered each time the database is opened.
+// Writes do not fail if the filter of a partial index is not registered: rather, the index stops being maintained and used by queries,
+// which is reported once through the standard logger, and it must be rebuilt (see DB.RebuildIndex) once the filter is registered again.
+// Queries are checked to require the filter by comparing their criteria with it, thus filters should not use predicates (see query.Query.MatchPredicate),
+// which cannot be compared: a partial index whose filter uses a predicate is never used to run queries.
+func RegisterIndexFilter(name string, filter query.Criteria) error {
+	q, err := normalizeCriteria(query.NewQuery("").Where(filter))
+	if err != nil {
+		return err
+	}
+	indexFilters.Store(name, q.Criteria())
+	return nil
+}
+
+// getIndexFilter returns the filter registered with the supplied name.
+func getIndexFilter(name string) (query.Criteria, error) {
+	if filter, ok := indexFilters.Load(name); ok {
+		return filter.(query.Criteria), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrIndexFilterNotExist, name)
+}
+
+// WithIndexType sets the type of the index, which defaults to index.IndexSingleField.
+// Indexes of type index.IndexHash only store a hash of each value, thus they are only used by queries checking the field for equality.
+func WithIndexType(indexType index.IndexType) IndexOption {
+	return func(info *index.IndexInfo) {
+		info.Type = indexType
+	}
+}
+
+// CreateIndexStream is like CreateIndex, but it builds the index by decoding the documents of the collection in parallel,
+// which is considerably faster on large collections. The collection should not be modified while the index is being built.
+// The build can be cancelled through ctx. If progress is not nil, it is periodically called with the number of indexed documents.
+// ErrNotSupported is returned if the storage engine does not implement StreamIndexCreator.
+func (db *DB) CreateIndexStream(ctx context.Context, collection, field string, progress func(indexed int)) error {
+	creator, ok := db.engine.(StreamIndexCreator)
+	if !ok {
+		return ErrNotSupported
+	}
+	return creator.CreateIndexStream(ctx, collection, field, progress)
 }
 
 // HasIndex returns true if an idex exists for the specified (index, collection) pair.
@@ -225,6 +394,17 @@ func (db *DB) DropIndex(collection, field string) error {
 	return db.engine.DropIndex(collection, field)
 }
 
+// RebuildIndex drops the entries of the index on the specified (collection, field) pair and indexes again the documents of the collection,
+// within a single transaction. It allows to repair an index which is suspected to be out of sync with the documents, and it can be safely repeated.
+// ErrNotSupported is returned if the storage engine does not implement IndexRebuilder.
+func (db *DB) RebuildIndex(collection, field string) error {
+	rebuilder, ok := db.engine.(IndexRebuilder)
+	if !ok {
+		return ErrNotSupported
+	}
+	return rebuilder.RebuildIndex(collection, field)
+}
+
 // ListIndexes returns a list containing the names of all the indexes for the specified collection.
 func (db *DB) ListIndexes(collection string) ([]index.IndexInfo, error) {
 	return db.engine.ListIndexes(collection)
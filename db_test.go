@@ -1,16 +1,20 @@
 package clover_test
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -624,7 +628,7 @@ func TestCompareUint64(t *testing.T) {
 		require.NoError(t, err)
 
 		for _, doc := range docs {
-			require.Greater(t, doc.Get("id"), uint64(4))
+			require.Greater(t, doc.Get("id"), int64(4))
 		}
 	})
 }
@@ -730,8 +734,8 @@ func TestInCriteria(t *testing.T) {
 		require.Greater(t, len(docs), 0)
 		for _, doc := range docs {
 			userId := doc.Get("userId").(int64)
-			id := doc.Get("id").(uint64)
-			require.True(t, uint64(userId) == id || userId == 6)
+			id := doc.Get("id").(int64)
+			require.True(t, userId == id || userId == 6)
 		}
 	})
 }
@@ -1058,6 +1062,100 @@ func TestSortWithIndex(t *testing.T) {
 	})
 }
 
+func TestSortWithMultikeyIndex(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("test"))
+
+		for i, a := range []interface{}{[]interface{}{0, 5}, 2, []interface{}{3, 1}, 4} {
+			doc := d.NewDocument()
+			doc.Set("n", i)
+			doc.Set("a", a)
+			doc.Set("b", "x")
+			require.NoError(t, db.Insert("test", doc))
+		}
+
+		queries := []*q.Query{
+			q.NewQuery("test").Sort(q.SortOption{Field: "a"}),
+			q.NewQuery("test").Sort(q.SortOption{Field: "a", Direction: -1}),
+			q.NewQuery("test").Where(q.Field("a").AnyElement().Gt(0)).Sort(q.SortOption{Field: "a"}),
+			q.NewQuery("test").Where(q.Field("b").Eq("x")).Sort(q.SortOption{Field: "a"}),
+		}
+
+		getNs := func() [][]int64 {
+			res := make([][]int64, 0, len(queries))
+			for _, query := range queries {
+				docs, err := db.FindAll(query)
+				require.NoError(t, err)
+
+				ns := make([]int64, 0, len(docs))
+				for _, doc := range docs {
+					ns = append(ns, doc.Get("n").(int64))
+				}
+				res = append(res, ns)
+			}
+			return res
+		}
+
+		expected := getNs()
+
+		require.NoError(t, db.CreateIndex("test", "a"))
+		require.Equal(t, expected, getNs())
+
+		require.NoError(t, db.DropIndex("test", "a"))
+		require.NoError(t, db.CreateCompoundIndex("test", []string{"b", "a"}))
+		require.Equal(t, expected, getNs())
+	})
+}
+
+func TestSortWithMultiValueIndex(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("orders"))
+
+		// items.sku is nil when items is an array of objects, even if the index holds the sku of each element
+		for _, items := range []interface{}{
+			[]interface{}{map[string]interface{}{"sku": "e"}, map[string]interface{}{"sku": "a"}},
+			map[string]interface{}{"sku": "b"},
+			[]interface{}{map[string]interface{}{"sku": "c"}},
+			map[string]interface{}{"sku": "d"},
+		} {
+			doc := d.NewDocument()
+			doc.Set("items", items)
+			require.NoError(t, db.Insert("orders", doc))
+		}
+
+		queries := []*q.Query{
+			q.NewQuery("orders").Sort(q.SortOption{Field: "items.sku"}),
+			q.NewQuery("orders").Sort(q.SortOption{Field: "items.sku", Direction: -1}),
+			q.NewQuery("orders").Where(q.Field("items.sku").GtEq("a")).Sort(q.SortOption{Field: "items.sku"}),
+		}
+
+		getSkus := func() [][]interface{} {
+			res := make([][]interface{}, 0, len(queries))
+			for _, query := range queries {
+				docs, err := db.FindAll(query)
+				require.NoError(t, err)
+
+				skus := make([]interface{}, 0, len(docs))
+				for _, doc := range docs {
+					skus = append(skus, doc.Get("items.sku"))
+				}
+				res = append(res, skus)
+			}
+			return res
+		}
+
+		expected := getSkus()
+		require.Equal(t, []interface{}{nil, nil, "b", "d"}, expected[0])
+
+		require.NoError(t, db.CreateIndex("orders", "items.sku"))
+		require.Equal(t, expected, getSkus())
+
+		require.NoError(t, db.DropIndex("orders", "items.sku"))
+		require.NoError(t, db.CreateIndexStream(context.Background(), "orders", "items.sku", nil))
+		require.Equal(t, expected, getSkus())
+	})
+}
+
 func TestForEachStop(t *testing.T) {
 	runCloverTest(t, func(t *testing.T, db *c.DB) {
 		require.NoError(t, loadFromJson(db, todosPath, &TodoModel{}))
@@ -1268,6 +1366,213 @@ func TestCreateIndex(t *testing.T) {
 	})
 }
 
+func TestCreateIndexStream(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, loadFromJson(db, todosPath, &TodoModel{}))
+
+		criteria := q.Field("userId").Gt(5).And(q.Field("userId").LtEq(10))
+		sortOpt := q.SortOption{Field: "userId", Direction: 1}
+
+		allDocs, err := db.FindAll(q.NewQuery("todos").Where(criteria).Sort(sortOpt, q.SortOption{Field: d.ObjectIdField}))
+		require.NoError(t, err)
+
+		indexed := 0
+		err = db.CreateIndexStream(context.Background(), "todos", "userId", func(n int) {
+			indexed = n
+		})
+		require.NoError(t, err)
+
+		n, err := db.Count(q.NewQuery("todos"))
+		require.NoError(t, err)
+		require.Equal(t, n, indexed)
+
+		has, err := db.HasIndex("todos", "userId")
+		require.NoError(t, err)
+		require.True(t, has)
+
+		require.Equal(t, c.ErrIndexExist, db.CreateIndexStream(context.Background(), "todos", "userId", nil))
+
+		indexDocs, err := db.FindAll(q.NewQuery("todos").Where(criteria).Sort(sortOpt))
+		require.NoError(t, err)
+		require.Equal(t, allDocs, indexDocs)
+	})
+}
+
+func TestCreateIndexStreamCancelled(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, loadFromJson(db, todosPath, &TodoModel{}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		require.Error(t, db.CreateIndexStream(ctx, "todos", "userId", nil))
+
+		has, err := db.HasIndex("todos", "userId")
+		require.NoError(t, err)
+		require.False(t, has)
+
+		require.Equal(t, c.ErrCollectionNotExist, db.CreateIndexStream(context.Background(), "coll", "userId", nil))
+	})
+}
+
+func TestCreateIndexWithKeyFunc(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("releases"))
+
+		versions := []string{"1.10.0", "1.9.2", "2.0.0", "1.9.10", "0.1", "1.2.3"}
+		for _, v := range versions {
+			doc := d.NewDocument()
+			doc.Set("version", v)
+			_, err := db.InsertOne("releases", doc)
+			require.NoError(t, err)
+		}
+
+		require.ErrorIs(t, db.CreateIndex("releases", "version", c.WithKeyFunc("missing")), index.ErrKeyFuncNotExist)
+		require.NoError(t, db.CreateIndex("releases", "version", c.WithKeyFunc(index.VersionKeyFunc)))
+
+		indexes, err := db.ListIndexes("releases")
+		require.NoError(t, err)
+		require.Equal(t, []index.IndexInfo{{Field: "version", Type: index.IndexSingleField, KeyFunc: index.VersionKeyFunc}}, indexes)
+
+		getVersions := func(docs []*d.Document) []string {
+			res := make([]string, 0, len(docs))
+			for _, doc := range docs {
+				res = append(res, doc.Get("version").(string))
+			}
+			return res
+		}
+
+		docs, err := db.FindAll(q.NewQuery("releases").Where(q.Field("version").Gt("1.9").And(q.Field("version").LtEq("1.10.0"))).Sort(q.SortOption{Field: "version"}))
+		require.NoError(t, err)
+		require.Equal(t, []string{"1.9.2", "1.9.10", "1.10.0"}, getVersions(docs))
+
+		docs, err = db.FindAll(q.NewQuery("releases").Sort(q.SortOption{Field: "version", Direction: -1}))
+		require.NoError(t, err)
+		require.Equal(t, []string{"2.0.0", "1.10.0", "1.9.10", "1.9.2", "1.2.3", "0.1"}, getVersions(docs))
+
+		// comparisons follow the custom ordering even when the index is not used for the query
+		docs, err = db.FindAll(q.NewQuery("releases").Where(q.Field("version").Gt("1.9.2").Or(q.Field("_id").Eq(""))))
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"1.9.10", "1.10.0", "2.0.0"}, getVersions(docs))
+	})
+}
+
+func TestCaseInsensitiveIndex(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("users"))
+
+		emails := []interface{}{"Foo@Bar.com", "alice@example.com", "BOB@example.com", "carol@Example.com", 42}
+		for _, email := range emails {
+			doc := d.NewDocument()
+			doc.Set("email", email)
+			require.NoError(t, db.Insert("users", doc))
+		}
+
+		require.NoError(t, db.CreateIndex("users", "email", c.WithCaseInsensitive()))
+
+		indexes, err := db.ListIndexes("users")
+		require.NoError(t, err)
+		require.Equal(t, []index.IndexInfo{{Field: "email", Type: index.IndexSingleField, KeyFunc: index.CaseInsensitiveKeyFunc}}, indexes)
+
+		doc, err := db.FindFirst(q.NewQuery("users").Where(q.Field("email").Eq("foo@bar.COM")))
+		require.NoError(t, err)
+		require.NotNil(t, doc)
+		require.Equal(t, "Foo@Bar.com", doc.Get("email"))
+
+		n, err := db.Count(q.NewQuery("users").Where(q.Field("email").In("bob@EXAMPLE.com", "Carol@example.com")))
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+
+		n, err = db.Count(q.NewQuery("users").Where(q.Field("email").Eq(42)))
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		docs, err := db.FindAll(q.NewQuery("users").Where(q.Field("email").Gt("b")).Sort(q.SortOption{Field: "email"}))
+		require.NoError(t, err)
+
+		sorted := make([]interface{}, 0, len(docs))
+		for _, doc := range docs {
+			sorted = append(sorted, doc.Get("email"))
+		}
+		require.Equal(t, []interface{}{"BOB@example.com", "carol@Example.com", "Foo@Bar.com"}, sorted)
+	})
+}
+
+func TestIndexWithCustomObjectIds(t *testing.T) {
+	defer d.SetObjectIdProvider(d.UUIDProvider{})
+	d.SetObjectIdProvider(&sequentialIdProvider{})
+
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("test"))
+		require.NoError(t, db.CreateIndex("test", "value"))
+
+		for i := 1; i <= 1000; i *= 10 {
+			doc := d.NewDocument()
+			doc.Set(d.ObjectIdField, strconv.Itoa(i))
+			doc.Set("value", i)
+			require.NoError(t, db.Insert("test", doc))
+		}
+
+		doc := d.NewDocument()
+		doc.Set(d.ObjectIdField, "not-a-number")
+		require.Error(t, db.Insert("test", doc))
+
+		docs, err := db.FindAll(q.NewQuery("test").Where(q.Field("value").Gt(1)).Sort(q.SortOption{Field: "value", Direction: -1}))
+		require.NoError(t, err)
+		require.Len(t, docs, 3)
+
+		for i, id := range []string{"1000", "100", "10"} {
+			require.Equal(t, id, docs[i].ObjectId())
+		}
+
+		require.NoError(t, db.DeleteById("test", "100"))
+
+		n, err := db.Count(q.NewQuery("test").Where(q.Field("value").GtEq(100)))
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+	})
+}
+
+func TestIndexNormalizedValues(t *testing.T) {
+	type item struct {
+		Id    string `clover:"_id,omitempty"`
+		Count int    `clover:"count"`
+		Small uint8  `clover:"small"`
+		Ratio float32
+	}
+
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("items"))
+		require.NoError(t, db.CreateIndex("items", "count"))
+		require.NoError(t, db.CreateIndex("items", "small"))
+		require.NoError(t, db.CreateIndex("items", "Ratio"))
+
+		for i := 0; i < 10; i++ {
+			require.NoError(t, db.Insert("items", d.NewDocumentOf(&item{Count: i, Small: uint8(i), Ratio: float32(i) / 2})))
+		}
+
+		n, err := db.Count(q.NewQuery("items").Where(q.Field("count").Eq(int(5))))
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		n, err = db.Count(q.NewQuery("items").Where(q.Field("count").GtEq(int32(5))))
+		require.NoError(t, err)
+		require.Equal(t, 5, n)
+
+		n, err = db.Count(q.NewQuery("items").Where(q.Field("small").Eq(uint(3))))
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		n, err = db.Count(q.NewQuery("items").Where(q.Field("small").In(int(3), uint16(4))))
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+
+		n, err = db.Count(q.NewQuery("items").Where(q.Field("Ratio").Eq(float32(1.5))))
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+	})
+}
+
 func TestIndex(t *testing.T) {
 	runCloverTest(t, func(t *testing.T, db *c.DB) {
 		require.NoError(t, loadFromJson(db, todosPath, &TodoModel{}))
@@ -1286,6 +1591,69 @@ func TestIndex(t *testing.T) {
 	})
 }
 
+func TestIndexArrayOfObjects(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("orders"))
+
+		ids := make([]string, 0)
+		for i := 0; i < 100; i++ {
+			items := make([]interface{}, 0)
+			for j := 0; j < i%4; j++ {
+				items = append(items, map[string]interface{}{"sku": fmt.Sprintf("sku-%d", (i+j)%10), "qty": j})
+			}
+
+			doc := d.NewDocumentOf(map[string]interface{}{"items": items})
+			id, err := db.InsertOne("orders", doc)
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+
+		criteria := q.Field("items.sku").Eq("sku-3")
+		testIndexedQuery(t, db, criteria, "orders", "items.sku")
+
+		docs, err := db.FindAll(q.NewQuery("orders").Where(criteria))
+		require.NoError(t, err)
+		require.NotEmpty(t, docs)
+
+		for _, doc := range docs {
+			found := false
+			doc.ForEachInArray("items", func(_ int, item *d.Document) bool {
+				found = found || item.Get("sku") == "sku-3"
+				return !found
+			})
+			require.True(t, found)
+		}
+
+		testIndexedQuery(t, db, q.Field("items.sku").GtEq("sku-2").And(q.Field("items.sku").Lt("sku-5")), "orders", "items.sku")
+
+		// replacing the items removes the entries of all the previous elements
+		for _, doc := range docs {
+			require.NoError(t, db.UpdateById("orders", doc.ObjectId(), map[string]interface{}{
+				"items": []interface{}{map[string]interface{}{"sku": "replaced"}},
+			}))
+		}
+
+		n, err := db.Count(q.NewQuery("orders").Where(criteria))
+		require.NoError(t, err)
+		require.Zero(t, n)
+
+		n, err = db.Count(q.NewQuery("orders").Where(q.Field("items.sku").Eq("replaced")))
+		require.NoError(t, err)
+		require.Equal(t, len(docs), n)
+
+		require.NoError(t, db.Delete(q.NewQuery("orders").Where(q.Field("items.sku").Eq("replaced"))))
+
+		n, err = db.Count(q.NewQuery("orders").Where(q.Field("items.sku").Eq("replaced")))
+		require.NoError(t, err)
+		require.Zero(t, n)
+
+		// documents having multiple elements are returned only once when sorting through the index
+		sortedDocs, err := db.FindAll(q.NewQuery("orders").Sort(q.SortOption{Field: "items.sku"}))
+		require.NoError(t, err)
+		require.Len(t, sortedDocs, len(ids)-len(docs))
+	})
+}
+
 func TestIndexNested(t *testing.T) {
 	runCloverTest(t, func(t *testing.T, db *c.DB) {
 		require.NoError(t, loadFromJson(db, airlinesPath, nil))
@@ -1609,3 +1977,596 @@ func TestClamp(t *testing.T) {
 	//v := util.ClampOnSphere(-95, c.LatitudeMin, c.LatitudeMax)
 
 }
+
+func TestAnalyzeSchema(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("products"))
+
+		for i := 0; i < 10; i++ {
+			doc := d.NewDocument()
+			if i%10 == 0 {
+				doc.Set("price", "9.99")
+			} else {
+				doc.Set("price", float64(i)+0.99)
+			}
+
+			doc.Set("name", "product")
+			if i%2 == 0 {
+				doc.Set("details.weight", i)
+			} else {
+				doc.Set("details", nil)
+			}
+
+			if i < 3 {
+				doc.Set("tags", []interface{}{"a"})
+			}
+			require.NoError(t, db.Insert("products", doc))
+		}
+
+		stats, err := db.AnalyzeSchema(q.NewQuery("products"))
+		require.NoError(t, err)
+
+		price := stats["price"]
+		require.Equal(t, 10, price.Total)
+		require.Equal(t, map[string]int{"float64": 9, "string": 1}, price.Types)
+		require.Equal(t, 1.0, price.Presence())
+		require.Equal(t, 0.9, price.TypeRatio("float64"))
+
+		require.Equal(t, map[string]int{"object": 5, "null": 5}, stats["details"].Types)
+
+		weight := stats["details.weight"]
+		require.Equal(t, map[string]int{"int64": 5}, weight.Types)
+		require.Equal(t, 0.5, weight.Presence())
+		require.Equal(t, 1.0, weight.TypeRatio("int64"))
+
+		tags := stats["tags"]
+		require.Equal(t, map[string]int{"array": 3}, tags.Types)
+		require.Equal(t, 0.3, tags.Presence())
+
+		require.Equal(t, map[string]int{"string": 10}, stats[d.ObjectIdField].Types)
+		require.Len(t, stats, 6)
+
+		stats, err = db.AnalyzeSchema(q.NewQuery("products").Where(q.Field("price").Eq("none")))
+		require.NoError(t, err)
+		require.Empty(t, stats)
+	})
+}
+
+func TestZeroExpiresAt(t *testing.T) {
+	newDoc := func() *d.Document {
+		doc := d.NewDocument()
+		doc.SetExpiresAt(time.Time{})
+		return doc
+	}
+
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("test"))
+		require.Error(t, db.Insert("test", newDoc()))
+	})
+
+	db, err := c.Open("", c.InMemoryMode(true), c.WithZeroExpiresAt(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.CreateCollection("test"))
+	require.NoError(t, db.Insert("test", newDoc()))
+}
+
+func TestCollectionDefaultTTL(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("cache", c.WithDefaultTTL(time.Hour)))
+		require.NoError(t, db.CreateCollection("plain"))
+		require.NoError(t, db.CreateCollection("negative", c.WithDefaultTTL(-time.Hour)))
+
+		before := time.Now()
+
+		defaulted := d.NewDocument()
+		defaulted.Set("key", "a")
+		id, err := db.InsertOne("cache", defaulted)
+		require.NoError(t, err)
+
+		explicitExpiration := time.Now().Add(time.Minute)
+		explicit := d.NewDocument()
+		explicit.Set("key", "b")
+		explicit.SetExpiresAt(explicitExpiration)
+		explicitId, err := db.InsertOne("cache", explicit)
+		require.NoError(t, err)
+
+		doc, err := db.FindById("cache", id)
+		require.NoError(t, err)
+		require.NotNil(t, doc.ExpiresAt())
+		require.False(t, doc.ExpiresAt().Before(before.Add(time.Hour)))
+		require.False(t, doc.ExpiresAt().After(time.Now().Add(time.Hour)))
+
+		doc, err = db.FindById("cache", explicitId)
+		require.NoError(t, err)
+		require.True(t, explicitExpiration.Equal(*doc.ExpiresAt()))
+
+		for _, collection := range []string{"plain", "negative"} {
+			id, err := db.InsertOne(collection, d.NewDocument())
+			require.NoError(t, err)
+
+			doc, err := db.FindById(collection, id)
+			require.NoError(t, err)
+			require.Nil(t, doc.ExpiresAt())
+		}
+	})
+}
+
+func TestCreateIndexesFromDefs(t *testing.T) {
+	insertReleases := func(db *c.DB) {
+		require.NoError(t, db.CreateCollection("releases"))
+		for i, v := range []string{"1.10.0", "1.9.2", "2.0.0", "1.9.10"} {
+			doc := d.NewDocument()
+			doc.Set("version", v)
+			doc.Set("downloads", i*100)
+			require.NoError(t, db.Insert("releases", doc))
+		}
+	}
+
+	findVersions := func(db *c.DB) []string {
+		docs, err := db.FindAll(q.NewQuery("releases").Where(q.Field("version").Gt("1.9.2")).Sort(q.SortOption{Field: "version"}))
+		require.NoError(t, err)
+
+		versions := make([]string, 0, len(docs))
+		for _, doc := range docs {
+			versions = append(versions, doc.Get("version").(string))
+		}
+		return versions
+	}
+
+	var exported []byte
+	var expectedVersions []string
+
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		insertReleases(db)
+		require.NoError(t, db.CreateIndex("releases", "version", c.WithKeyFunc(index.VersionKeyFunc)))
+		require.NoError(t, db.CreateIndex("releases", "downloads"))
+
+		defs, err := db.ListIndexes("releases")
+		require.NoError(t, err)
+
+		exported, err = json.Marshal(defs)
+		require.NoError(t, err)
+
+		expectedVersions = findVersions(db)
+	})
+
+	require.Equal(t, []string{"1.9.10", "1.10.0", "2.0.0"}, expectedVersions)
+
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		insertReleases(db)
+
+		var defs []index.IndexInfo
+		require.NoError(t, json.Unmarshal(exported, &defs))
+		require.NoError(t, db.CreateIndexesFromDefs("releases", defs))
+
+		indexes, err := db.ListIndexes("releases")
+		require.NoError(t, err)
+		require.ElementsMatch(t, defs, indexes)
+		require.Equal(t, expectedVersions, findVersions(db))
+
+		err = db.CreateIndexesFromDefs("releases", defs)
+		require.ErrorIs(t, err, c.ErrIndexExist)
+
+		err = db.CreateIndexesFromDefs("releases", []index.IndexInfo{{Field: "name", KeyFunc: "missing"}})
+		require.ErrorIs(t, err, index.ErrKeyFuncNotExist)
+	})
+}
+
+func TestHashIndexQueries(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("links"))
+		require.NoError(t, db.CreateIndex("links", "url", c.WithIndexType(index.IndexHash)))
+
+		indexes, err := db.ListIndexes("links")
+		require.NoError(t, err)
+		require.Equal(t, []index.IndexInfo{{Field: "url", Type: index.IndexHash}}, indexes)
+
+		urls := []string{"https://a.com/x", "https://b.com/y", "https://a.com/x", "https://c.com/z"}
+		for i, u := range urls {
+			doc := d.NewDocument()
+			doc.Set("url", u)
+			doc.Set("n", i)
+			require.NoError(t, db.Insert("links", doc))
+		}
+
+		n, err := db.Count(q.NewQuery("links").Where(q.Field("url").Eq("https://a.com/x")))
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+
+		n, err = db.Count(q.NewQuery("links").Where(q.Field("url").Eq("https://a.com/x").And(q.Field("n").Gt(0))))
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		// non equality queries are answered without the index
+		n, err = db.Count(q.NewQuery("links").Where(q.Field("url").Gt("https://b.com")))
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+
+		n, err = db.Count(q.NewQuery("links").Where(q.Field("url").Eq("https://a.com/x").Or(q.Field("url").Eq("https://c.com/z"))))
+		require.NoError(t, err)
+		require.Equal(t, 3, n)
+
+		docs, err := db.FindAll(q.NewQuery("links").Sort(q.SortOption{Field: "url"}))
+		require.NoError(t, err)
+		require.Len(t, docs, 4)
+		require.Equal(t, "https://c.com/z", docs[3].Get("url"))
+
+		require.NoError(t, db.Update(q.NewQuery("links").Where(q.Field("n").Eq(0)), map[string]interface{}{"url": "https://d.com"}))
+
+		n, err = db.Count(q.NewQuery("links").Where(q.Field("url").Eq("https://a.com/x")))
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		n, err = db.Count(q.NewQuery("links").Where(q.Field("url").Eq("https://d.com")))
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		require.NoError(t, db.DropIndex("links", "url"))
+		require.Error(t, db.CreateIndex("links", "url", c.WithIndexType(index.IndexType(100))))
+	})
+}
+
+type sequentialIdProvider struct {
+	next int64
+}
+
+func (p *sequentialIdProvider) New() string {
+	return strconv.FormatInt(atomic.AddInt64(&p.next, 1), 10)
+}
+
+func (p *sequentialIdProvider) Validate(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 64)
+	return err == nil
+}
+
+func TestObjectIdProvider(t *testing.T) {
+	defer d.SetObjectIdProvider(d.UUIDProvider{})
+	d.SetObjectIdProvider(&sequentialIdProvider{})
+
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("test"))
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, db.Insert("test", d.NewDocumentOf(map[string]interface{}{"n": i})))
+		}
+
+		external := d.NewDocument()
+		external.Set(d.ObjectIdField, "1000")
+		require.NoError(t, db.Insert("test", external))
+
+		invalid := d.NewDocument()
+		invalid.Set(d.ObjectIdField, c.NewObjectId()+"x")
+		require.Error(t, db.Insert("test", invalid))
+
+		docs, err := db.FindAll(q.NewQuery("test").Sort(q.SortOption{Field: d.ObjectIdField}))
+		require.NoError(t, err)
+		require.Len(t, docs, 4)
+
+		ids := make([]string, 0, len(docs))
+		for _, doc := range docs {
+			ids = append(ids, doc.ObjectId())
+		}
+		require.Equal(t, []string{"1", "1000", "2", "3"}, ids)
+	})
+}
+
+func TestGeoIndexQueries(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("places"))
+		require.NoError(t, db.CreateIndex("places", "location", c.WithIndexType(index.IndexGeoSpatial)))
+
+		places := map[string]index.Point{
+			"rome":  {Lat: 41.9028, Lng: 12.4964},
+			"milan": {Lat: 45.4642, Lng: 9.19},
+			"paris": {Lat: 48.8566, Lng: 2.3522},
+		}
+
+		for name, p := range places {
+			doc := d.NewDocument()
+			doc.Set("name", name)
+			doc.Set("location", p)
+			require.NoError(t, db.Insert("places", doc))
+		}
+
+		doc, err := db.FindFirst(q.NewQuery("places").Where(q.Field("name").Eq("rome")))
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{"lat": 41.9028, "lng": 12.4964}, doc.Get("location"))
+
+		// geospatial indexes are not used for standard criteria
+		n, err := db.Count(q.NewQuery("places").Where(q.Field("location.lat").Gt(45)))
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+
+		n, err = db.Count(q.NewQuery("places").Where(q.Field("location").Eq(map[string]interface{}{"lat": 45.4642, "lng": 9.19})))
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+	})
+}
+
+func TestCompoundIndexQueries(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("tasks"))
+
+		statuses := []string{"open", "closed", "open", "open", "closed"}
+		for i, status := range statuses {
+			doc := d.NewDocument()
+			doc.Set("status", status)
+			doc.Set("createdAt", time.Date(2020, 1, 5-i, 0, 0, 0, 0, time.UTC))
+			doc.Set("n", i)
+			require.NoError(t, db.Insert("tasks", doc))
+		}
+
+		require.NoError(t, db.CreateCompoundIndex("tasks", []string{"status", "createdAt"}))
+		require.ErrorIs(t, db.CreateCompoundIndex("tasks", []string{"status", "createdAt"}), c.ErrIndexExist)
+
+		indexes, err := db.ListIndexes("tasks")
+		require.NoError(t, err)
+		require.Equal(t, []index.IndexInfo{index.CompoundIndexInfo("status", "createdAt")}, indexes)
+
+		getNs := func(docs []*d.Document) []int64 {
+			ns := make([]int64, 0, len(docs))
+			for _, doc := range docs {
+				ns = append(ns, doc.Get("n").(int64))
+			}
+			return ns
+		}
+
+		docs, err := db.FindAll(q.NewQuery("tasks").Where(q.Field("status").Eq("open")).Sort(q.SortOption{Field: "createdAt"}))
+		require.NoError(t, err)
+		require.Equal(t, []int64{3, 2, 0}, getNs(docs))
+
+		docs, err = db.FindAll(q.NewQuery("tasks").Where(q.Field("status").Eq("open").And(q.Field("n").Gt(0))).Sort(q.SortOption{Field: "createdAt", Direction: -1}))
+		require.NoError(t, err)
+		require.Equal(t, []int64{2, 3}, getNs(docs))
+
+		docs, err = db.FindAll(q.NewQuery("tasks").Where(q.Field("status").Eq("closed")).Sort(q.SortOption{Field: "n"}))
+		require.NoError(t, err)
+		require.Equal(t, []int64{1, 4}, getNs(docs))
+
+		n, err := db.Count(q.NewQuery("tasks").Where(q.Field("status").Eq("open").Or(q.Field("n").Eq(1))))
+		require.NoError(t, err)
+		require.Equal(t, 4, n)
+
+		// documents missing the leading field are refused
+		doc := d.NewDocument()
+		doc.Set("createdAt", time.Now())
+		require.ErrorIs(t, db.Insert("tasks", doc), index.ErrMissingLeadingField)
+
+		doc = d.NewDocument()
+		doc.Set("status", "open")
+		require.NoError(t, db.Insert("tasks", doc))
+
+		docs, err = db.FindAll(q.NewQuery("tasks").Where(q.Field("status").Eq("open")).Sort(q.SortOption{Field: "createdAt"}))
+		require.NoError(t, err)
+		require.Len(t, docs, 4)
+		require.False(t, docs[0].Has("createdAt"))
+
+		require.NoError(t, db.Delete(q.NewQuery("tasks").Where(q.Field("n").Eq(0))))
+		require.NoError(t, db.Update(q.NewQuery("tasks").Where(q.Field("n").Eq(1)), map[string]interface{}{"status": "open"}))
+
+		docs, err = db.FindAll(q.NewQuery("tasks").Where(q.Field("status").Eq("open").And(q.Field("createdAt").Exists())).Sort(q.SortOption{Field: "createdAt"}))
+		require.NoError(t, err)
+		require.Equal(t, []int64{3, 2, 1}, getNs(docs))
+
+		require.NoError(t, db.DropIndex("tasks", "status,createdAt"))
+
+		docs, err = db.FindAll(q.NewQuery("tasks").Where(q.Field("status").Eq("open")).Sort(q.SortOption{Field: "createdAt"}))
+		require.NoError(t, err)
+		require.Len(t, docs, 4)
+	})
+}
+
+func TestUniqueIndex(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("users"))
+		require.NoError(t, db.CreateIndex("users", "email", c.WithUnique()))
+
+		newUser := func(email string) *d.Document {
+			doc := d.NewDocument()
+			doc.Set("email", email)
+			return doc
+		}
+
+		require.NoError(t, db.Insert("users", newUser("a@example.com")))
+		require.ErrorIs(t, db.Insert("users", newUser("a@example.com")), index.ErrDuplicateKey)
+		require.ErrorIs(t, db.Insert("users", newUser("b@example.com"), newUser("b@example.com")), index.ErrDuplicateKey)
+
+		n, err := db.Count(q.NewQuery("users"))
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		require.NoError(t, db.Insert("users", newUser("b@example.com"), d.NewDocument(), d.NewDocument()))
+
+		err = db.Update(q.NewQuery("users").Where(q.Field("email").Eq("b@example.com")), map[string]interface{}{"email": "a@example.com"})
+		require.ErrorIs(t, err, index.ErrDuplicateKey)
+
+		require.NoError(t, db.Update(q.NewQuery("users").Where(q.Field("email").Eq("b@example.com")), map[string]interface{}{"email": "c@example.com", "name": "c"}))
+
+		// unique indexes cannot be created on fields with duplicate values
+		require.ErrorIs(t, db.Insert("users", newUser("c@example.com")), index.ErrDuplicateKey)
+		require.NoError(t, db.DropIndex("users", "email"))
+		require.NoError(t, db.Insert("users", newUser("c@example.com")))
+		require.ErrorIs(t, db.CreateIndex("users", "email", c.WithUnique()), index.ErrDuplicateKey)
+
+		require.Error(t, db.CreateIndex("users", "name", c.WithUnique(), c.WithIndexType(index.IndexHash)))
+	})
+}
+
+func TestArrayFieldIndex(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("posts"))
+
+		for i, tags := range []interface{}{[]interface{}{"go", "db"}, []interface{}{"rust"}, []interface{}{"go"}, "go"} {
+			doc := d.NewDocument()
+			doc.Set("n", i)
+			doc.Set("tags", tags)
+			require.NoError(t, db.Insert("posts", doc))
+		}
+
+		getNs := func(criteria q.Criteria) []int64 {
+			docs, err := db.FindAll(q.NewQuery("posts").Where(criteria).Sort(q.SortOption{Field: "n"}))
+			require.NoError(t, err)
+
+			ns := make([]int64, 0, len(docs))
+			for _, doc := range docs {
+				ns = append(ns, doc.Get("n").(int64))
+			}
+			return ns
+		}
+
+		tags := q.Field("tags").AnyElement()
+
+		check := func() {
+			require.Equal(t, []int64{0, 2, 3}, getNs(tags.Eq("go")))
+			require.Equal(t, []int64{0, 1}, getNs(tags.In("db", "rust")))
+			require.Equal(t, []int64{0}, getNs(tags.Lt("go")))
+			require.Equal(t, []int64{2}, getNs(tags.Eq([]interface{}{"go"})))
+			require.Equal(t, []int64{1}, getNs(tags.Eq("go").Not()))
+
+			// by default, arrays are only compared as a whole, whether the field is indexed or not
+			require.Equal(t, []int64{3}, getNs(q.Field("tags").Eq("go")))
+			require.Empty(t, getNs(q.Field("tags").In("db", "rust")))
+			require.Equal(t, []int64{0, 1, 2}, getNs(q.Field("tags").Eq("go").Not()))
+		}
+
+		check()
+
+		require.NoError(t, db.CreateIndex("posts", "tags"))
+		check()
+
+		require.NoError(t, db.Update(q.NewQuery("posts").Where(q.Field("n").Eq(0)), map[string]interface{}{"tags": []interface{}{"db"}}))
+		require.Equal(t, []int64{2, 3}, getNs(tags.Eq("go")))
+
+		require.NoError(t, db.DropIndex("posts", "tags"))
+		require.NoError(t, db.CreateIndex("posts", "tags", c.WithIndexType(index.IndexHash)))
+		require.Equal(t, []int64{2, 3}, getNs(tags.Eq("go")))
+		require.Equal(t, []int64{0}, getNs(tags.Eq("db")))
+		require.Equal(t, []int64{3}, getNs(q.Field("tags").Eq("go")))
+
+		require.NoError(t, db.CreateCompoundIndex("posts", []string{"tags", "n"}))
+		require.Equal(t, []int64{2, 3}, getNs(tags.Eq("go")))
+
+		// arrays can only be held by one of the fields of a compound index
+		doc := d.NewDocument()
+		doc.Set("tags", []interface{}{"go"})
+		doc.Set("n", []interface{}{1, 2})
+		require.ErrorIs(t, db.Insert("posts", doc), index.ErrParallelArrays)
+	})
+}
+
+func TestPartialIndex(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("posts"))
+		require.NoError(t, c.RegisterIndexFilter("active", q.Field("archived").Eq(false)))
+
+		for i := 0; i < 10; i++ {
+			doc := d.NewDocument()
+			doc.Set("n", i)
+			doc.Set("archived", i%3 == 0)
+			require.NoError(t, db.Insert("posts", doc))
+		}
+
+		require.ErrorIs(t, db.CreateIndex("posts", "n", c.WithFilter("missing")), c.ErrIndexFilterNotExist)
+		require.NoError(t, db.CreateIndex("posts", "n", c.WithFilter("active")))
+
+		indexes, err := db.ListIndexes("posts")
+		require.NoError(t, err)
+		require.Equal(t, []index.IndexInfo{{Field: "n", Type: index.IndexSingleField, Filter: "active"}}, indexes)
+
+		getNs := func(criteria q.Criteria) []int64 {
+			docs, err := db.FindAll(q.NewQuery("posts").Where(criteria).Sort(q.SortOption{Field: "n"}))
+			require.NoError(t, err)
+
+			ns := make([]int64, 0, len(docs))
+			for _, doc := range docs {
+				ns = append(ns, doc.Get("n").(int64))
+			}
+			return ns
+		}
+
+		// the index only covers the queries requiring the filter to hold
+		require.Equal(t, []int64{4, 5, 7, 8}, getNs(q.Field("archived").Eq(false).And(q.Field("n").Gt(3))))
+		require.Equal(t, []int64{6, 9}, getNs(q.Field("n").Gt(5).And(q.Field("archived").Eq(true))))
+		require.Equal(t, []int64{4, 5, 6, 7, 8, 9}, getNs(q.Field("n").Gt(3)))
+
+		// documents enter and leave the index as they start or stop satisfying the filter
+		require.NoError(t, db.Update(q.NewQuery("posts").Where(q.Field("n").Eq(9)), map[string]interface{}{"archived": false}))
+		require.NoError(t, db.Update(q.NewQuery("posts").Where(q.Field("n").Eq(4)), map[string]interface{}{"archived": true}))
+		require.NoError(t, db.Delete(q.NewQuery("posts").Where(q.Field("n").Eq(5))))
+
+		require.Equal(t, []int64{7, 8, 9}, getNs(q.Field("archived").Eq(false).And(q.Field("n").Gt(3))))
+
+		doc := d.NewDocument()
+		doc.Set("n", 10)
+		doc.Set("archived", false)
+		require.NoError(t, db.Insert("posts", doc))
+
+		require.Equal(t, []int64{7, 8, 9, 10}, getNs(q.Field("archived").Eq(false).And(q.Field("n").Gt(3))))
+	})
+}
+
+func TestRebuildIndex(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("items"))
+		require.ErrorIs(t, db.RebuildIndex("items", "n"), c.ErrIndexNotExist)
+
+		for i := 0; i < 20; i++ {
+			doc := d.NewDocument()
+			doc.Set("n", i)
+			require.NoError(t, db.Insert("items", doc))
+		}
+
+		require.NoError(t, db.CreateIndex("items", "n", c.WithUnique()))
+
+		for i := 0; i < 2; i++ {
+			require.NoError(t, db.RebuildIndex("items", "n"))
+
+			n, err := db.Count(q.NewQuery("items").Where(q.Field("n").GtEq(15)))
+			require.NoError(t, err)
+			require.Equal(t, 5, n)
+
+			docs, err := db.FindAll(q.NewQuery("items").Sort(q.SortOption{Field: "n", Direction: -1}).Limit(1))
+			require.NoError(t, err)
+			require.Len(t, docs, 1)
+			require.Equal(t, int64(19), docs[0].Get("n"))
+		}
+
+		// the unique constraint still holds after the rebuild
+		doc := d.NewDocument()
+		doc.Set("n", 3)
+		require.ErrorIs(t, db.Insert("items", doc), index.ErrDuplicateKey)
+	})
+}
+
+func TestLargeIntegerQueries(t *testing.T) {
+	runCloverTest(t, func(t *testing.T, db *c.DB) {
+		require.NoError(t, db.CreateCollection("counters"))
+
+		values := []interface{}{int64(math.MaxInt64 - 1), uint64(math.MaxInt64), uint64(math.MaxInt64) + 1, uint64(math.MaxUint64)}
+		for _, v := range values {
+			doc := d.NewDocument()
+			doc.Set("v", v)
+			require.NoError(t, db.Insert("counters", doc))
+		}
+
+		count := func(criteria q.Criteria) int {
+			n, err := db.Count(q.NewQuery("counters").Where(criteria))
+			require.NoError(t, err)
+			return n
+		}
+
+		check := func() {
+			require.Equal(t, 2, count(q.Field("v").Gt(int64(math.MaxInt64))))
+			require.Equal(t, 3, count(q.Field("v").GtEq(uint64(math.MaxInt64))))
+			require.Equal(t, 1, count(q.Field("v").Eq(uint64(math.MaxInt64)+1)))
+			require.Equal(t, 2, count(q.Field("v").Lt(uint64(math.MaxInt64)+1)))
+			require.Equal(t, 1, count(q.Field("v").Lt(int64(math.MaxInt64))))
+		}
+
+		check()
+		require.NoError(t, db.CreateIndex("counters", "v"))
+		check()
+	})
+}
@@ -1,9 +1,20 @@
 package document
 
 import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/ostafen/clover/v2/internal"
 	"github.com/ostafen/clover/v2/util"
@@ -18,6 +29,12 @@ const (
 // Document represents a document as a map.
 type Document struct {
 	fields map[string]interface{}
+	shared bool            // fields may be shared with other documents and must be copied before being modified
+	owned  map[string]bool // objects and arrays of a shared document already copied, by path (true if their content was copied as well)
+
+	compacted bool // fields were rebuilt by Compact, and were not modified since
+
+	declaredOrder []string // names of the fields of the struct the document was created from, in declaration order (see WithDeclaredOrder)
 }
 
 // ObjectId returns the id of the document, provided that the document belongs to some collection. Otherwise, it returns the empty string.
@@ -35,22 +52,321 @@ func NewDocument() *Document {
 
 // NewDocumentOf creates a new document and initializes it with the content of the provided object.
 // It returns nil if the object cannot be converted to a valid Document.
-func NewDocumentOf(o interface{}) *Document {
-	normalized, _ := internal.Normalize(o)
+func NewDocumentOf(o interface{}, opts ...DocumentOption) *Document {
+	var options documentOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var normalized interface{}
+	var declaredOrder []string
+	if options.declaredOrder {
+		normalized, declaredOrder, _ = internal.NormalizeWithOrder(o)
+	} else {
+		normalized, _ = internal.Normalize(o)
+	}
+
 	fields, _ := normalized.(map[string]interface{})
 	if fields == nil {
 		return nil
 	}
 
 	return &Document{
-		fields: fields,
+		fields:        fields,
+		declaredOrder: declaredOrder,
+	}
+}
+
+type documentOptions struct {
+	declaredOrder bool
+}
+
+// DocumentOption customizes the creation of a document through NewDocumentOf.
+type DocumentOption func(opts *documentOptions)
+
+// WithDeclaredOrder makes the document created from a struct record the order its fields are declared in, which is returned by DeclaredOrder.
+// The order is not stored along with the document, thus it is lost once the document is inserted into a collection.
+func WithDeclaredOrder() DocumentOption {
+	return func(opts *documentOptions) {
+		opts.declaredOrder = true
+	}
+}
+
+// DeclaredOrder returns the names of the top-level fields of the document in the order they are declared in the struct the document was created from,
+// provided that the document was created through NewDocumentOf using the WithDeclaredOrder option. Otherwise, it returns nil.
+// Fields deleted from the document after its creation are not included, as well as the ones added later.
+func (doc *Document) DeclaredOrder() []string {
+	if doc.declaredOrder == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(doc.declaredOrder))
+	for _, name := range doc.declaredOrder {
+		if _, exists := doc.fields[name]; exists {
+			names = append(names, name)
+		}
 	}
+	return names
+}
+
+// Normalize converts v to the canonical representation used by documents, which is the one values are stored with:
+// for example, signed integers become int64 values, floats become float64 values and structs become maps.
+// Values normalized this way can be compared with the content of stored documents, e.g. through reflect.DeepEqual.
+func Normalize(v interface{}) (interface{}, error) {
+	return internal.Normalize(v)
+}
+
+// NormalizeMap returns a copy of m whose values are converted to the canonical representation used by documents
+// (e.g. every integer becomes an int64), which allows to compare it with the content of stored documents.
+func NormalizeMap(m map[string]interface{}) (map[string]interface{}, error) {
+	normalized, err := internal.Normalize(m)
+	if err != nil {
+		return nil, err
+	}
+	return normalized.(map[string]interface{}), nil
+}
+
+// NormalizeOptions allows to restrict the types of values accepted when creating a document.
+type NormalizeOptions = internal.NormalizeOptions
+
+// SetStringerFallback sets whether values of unsupported types implementing fmt.Stringer, such as custom id types,
+// are stored as the result of their String method, which is the default. When disabled, such values are rejected
+// by Set, SetE, NewDocumentOf and the other functions normalizing values, as if NormalizeOptions.DisallowStringer was always set.
+// Like SetTypedGetterMode, it is meant to be called once, when the application starts.
+func SetStringerFallback(enabled bool) {
+	internal.SetStringerFallback(enabled)
+}
+
+// StringerFallback reports whether the fmt.Stringer fallback is enabled (see SetStringerFallback).
+func StringerFallback() bool {
+	return internal.StringerFallback()
 }
 
-// Copy returns a shallow copy of the underlying document.
+// ErrCyclicReference is returned when converting to a document a value which contains itself,
+// such as a map holding itself as one of its values.
+var ErrCyclicReference = internal.ErrCyclicReference
+
+// NewDocumentOfWithOptions is like NewDocumentOf, but returns an error if the object cannot be converted to a valid Document
+// or if any of its values violates the supplied options. Nil options impose no restriction.
+func NewDocumentOfWithOptions(o interface{}, opts *NormalizeOptions) (*Document, error) {
+	normalized, err := internal.NormalizeWithOptions(o, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, _ := normalized.(map[string]interface{})
+	if fields == nil {
+		return nil, fmt.Errorf("object cannot be converted to a document")
+	}
+
+	return &Document{
+		fields: fields,
+	}, nil
+}
+
+// SetStructTag sets the name of the struct tag specifying field names and options when converting structs to documents and back,
+// which is "clover" by default. Tags of other libraries following the same "name,omitempty" format, such as "json" or "bson", can be used as well.
+// It must be called before using any document.
+func SetStructTag(name string) {
+	internal.SetStructTag(name)
+}
+
+// Copy returns an independent snapshot of the document: all the nested values are copied, as by Clone,
+// thus no change to either of the two documents (including in-place changes to the values returned by Get) affects the other.
+// COW should be preferred when most of the copies are only read.
 func (doc *Document) Copy() *Document {
+	return doc.Clone()
+}
+
+// Clone returns a deep copy of the document, which shares no mutable state with the original:
+// nested objects, arrays and byte slices are recursively copied.
+func (doc *Document) Clone() *Document {
 	return &Document{
-		fields: util.CopyMap(doc.fields),
+		fields:        util.DeepCopyMap(doc.fields),
+		declaredOrder: doc.declaredOrder,
+	}
+}
+
+// cowCopies counts the objects and arrays copied by writes to shared documents.
+var cowCopies int64
+
+// COW returns a copy-on-write view of the document. The view shares the fields of the document
+// until either of the two is modified: a write to a shared document only copies the objects and arrays
+// along the path of the written field, while the rest of the fields are still shared.
+// This makes COW much cheaper than Copy when most of the copies are only read, or only change a few fields.
+// Reads and writes to the same document still must not happen concurrently.
+func (doc *Document) COW() *Document {
+	doc.shared = true
+	doc.owned = nil
+	return &Document{
+		fields:        doc.fields,
+		shared:        true,
+		declaredOrder: doc.declaredOrder,
+	}
+}
+
+// beforeWrite must be called before replacing or deleting the field with the given name:
+// the objects and arrays enclosing the field are copied if they are shared with other documents.
+// An empty name stands for the whole document, which is entirely copied.
+func (doc *Document) beforeWrite(name string) {
+	doc.copyPath(name, false)
+}
+
+// beforeUpdate must be called before modifying in place the value of the field with the given name,
+// which is copied, if shared with other documents, together with the objects and arrays enclosing it.
+func (doc *Document) beforeUpdate(name string) {
+	doc.copyPath(name, true)
+}
+
+func (doc *Document) copyPath(name string, copyValue bool) {
+	doc.compacted = false
+	if !doc.shared {
+		return
+	}
+
+	if name == "" {
+		doc.fields = util.DeepCopyMap(doc.fields)
+		doc.shared = false
+		doc.owned = nil
+		atomic.AddInt64(&cowCopies, 1)
+		return
+	}
+
+	if doc.owned == nil {
+		doc.owned = make(map[string]bool)
+	}
+
+	if _, copied := doc.owned[""]; !copied {
+		doc.fields = shallowCopy(doc.fields).(map[string]interface{})
+		doc.owned[""] = false
+		atomic.AddInt64(&cowCopies, 1)
+	}
+
+	// values previously copied below the field may be replaced by shared ones
+	for path := range doc.owned {
+		if strings.HasPrefix(path, name+".") {
+			delete(doc.owned, path)
+		}
+	}
+
+	fields := strings.Split(name, ".")
+	if !copyValue {
+		fields = fields[:len(fields)-1]
+	}
+
+	var parent interface{} = doc.fields
+	for i, field := range fields {
+		ref := childRef(parent, field)
+		if ref == nil {
+			return
+		}
+
+		v, _ := ref.get()
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+		default:
+			return
+		}
+
+		path := strings.Join(fields[:i+1], ".")
+		deep, copied := doc.owned[path]
+		if deep {
+			return
+		}
+
+		last := i == len(fields)-1 && copyValue
+		if last {
+			v = util.DeepCopyValue(v)
+		} else if !copied {
+			v = shallowCopy(v)
+		}
+
+		if last || !copied {
+			ref.set(v)
+			doc.owned[path] = last
+			atomic.AddInt64(&cowCopies, 1)
+		}
+		parent = v
+	}
+}
+
+// ownValue records that the value just set for the field with the given name is not shared with other documents,
+// as it is the case for newly normalized values, so that later writes within the field do not copy it.
+func (doc *Document) ownValue(name string) {
+	if doc.shared {
+		doc.owned[name] = true
+	}
+}
+
+// childRef returns a reference to the field of the object or array v with the given name, or nil if there is no such field.
+func childRef(v interface{}, name string) *fieldRef {
+	switch vType := v.(type) {
+	case map[string]interface{}:
+		if _, exists := vType[name]; exists {
+			return &fieldRef{m: vType, key: name}
+		}
+	case []interface{}:
+		if index, err := strconv.Atoi(name); err == nil && index >= 0 && index < len(vType) {
+			return &fieldRef{s: vType, index: index}
+		}
+	}
+	return nil
+}
+
+// shallowCopy returns a copy of the object or array v, whose values are still shared with v.
+func shallowCopy(v interface{}) interface{} {
+	switch vType := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(vType))
+		for key, value := range vType {
+			m[key] = value
+		}
+		return m
+	case []interface{}:
+		return append([]interface{}(nil), vType...)
+	}
+	return v
+}
+
+// Compact rebuilds the fields of the document by encoding and decoding them once, as if the document was read back from the database.
+// This releases the storage retained by the fields deleted over the lifetime of the document, as well as the one shared
+// with other documents (see COW), and leaves the document in the same state as a freshly decoded one with the same content:
+// the encoding of the document, which is canonical, is not changed. It can be used before persisting documents which have been edited many times.
+// Compact is a no-op for documents which were not modified since they were last compacted.
+func (doc *Document) Compact() {
+	if doc.compacted && !doc.shared {
+		return
+	}
+
+	data, err := Encode(doc)
+	if err != nil { // fields are normalized, thus they can always be encoded
+		return
+	}
+
+	fields := make(map[string]interface{})
+	if err := internal.Decode(data, &fields); err != nil {
+		return
+	}
+
+	doc.fields = fields
+	doc.shared = false
+	doc.owned = nil
+	doc.compacted = true
+}
+
+// Clear removes all the fields of the document, except for the _id field if keepId is true,
+// leaving the document in the same state as one returned by NewDocument. This allows to reuse the same document.
+func (doc *Document) Clear(keepId bool) {
+	id, hasId := doc.fields[ObjectIdField]
+
+	doc.fields = make(map[string]interface{})
+	doc.shared = false
+	doc.owned = nil
+	doc.compacted = false
+	doc.declaredOrder = nil
+
+	if keepId && hasId {
+		doc.fields[ObjectIdField] = id
 	}
 }
 
@@ -58,59 +374,650 @@ func (doc *Document) AsMap() map[string]interface{} {
 	return util.CopyMap(doc.fields)
 }
 
-func lookupField(name string, fieldMap map[string]interface{}, force bool) (map[string]interface{}, interface{}, string) {
+// fieldRef locates a field within its parent container, which is either an object or an array.
+type fieldRef struct {
+	m     map[string]interface{}
+	key   string
+	s     []interface{}
+	index int
+}
+
+func (ref *fieldRef) get() (interface{}, bool) {
+	if ref.m != nil {
+		v, exists := ref.m[ref.key]
+		return v, exists
+	}
+	return ref.s[ref.index], true
+}
+
+func (ref *fieldRef) set(v interface{}) {
+	if ref.m != nil {
+		ref.m[ref.key] = v
+		return
+	}
+	ref.s[ref.index] = v
+}
+
+// delete removes the referenced field. Since removing an array element would shift the following ones, elements are set to nil instead.
+func (ref *fieldRef) delete() {
+	if ref.m != nil {
+		delete(ref.m, ref.key)
+		return
+	}
+	ref.s[ref.index] = nil
+}
+
+// lookupField follows the path of a field, returning a reference to the field along with its value, or a nil reference if the field doesn't exist.
+// Path segments which are non-negative integers index into arrays, while any other segment (as well as any segment applied to an object) is a field name.
+// If force is true, missing objects along the path are created, arrays indexed beyond their length are grown with nil elements,
+// and the arrays crossed by the path (and their nested objects) are copied, since shallow copies of the document share them.
+func lookupField(name string, fieldMap map[string]interface{}, force bool) (*fieldRef, interface{}) {
 	fields := strings.Split(name, ".")
 
-	var exists bool
-	var f interface{}
-	currMap := fieldMap
-	for i, field := range fields {
-		f, exists = currMap[field]
+	ref := &fieldRef{m: fieldMap, key: fields[0]}
+	crossedArray := false
+	for i := 0; ; i++ {
+		v, exists := ref.get()
+		if !exists && !force {
+			return nil, nil
+		}
 
-		m, isMap := f.(map[string]interface{})
+		if i == len(fields)-1 {
+			return ref, v
+		}
 
-		if force {
-			if (!exists || !isMap) && i < len(fields)-1 {
-				m = make(map[string]interface{})
-				currMap[field] = m
-				f = m
+		next := fields[i+1]
+		switch vType := v.(type) {
+		case map[string]interface{}:
+			if force && crossedArray {
+				vType = util.CopyMap(vType)
+				ref.set(vType)
 			}
-		} else if !exists {
-			return nil, nil, ""
+			ref = &fieldRef{m: vType, key: next}
+			continue
+		case []interface{}:
+			if index, err := strconv.Atoi(next); err == nil && index >= 0 {
+				if force {
+					s := make([]interface{}, len(vType), maxInt(len(vType), index+1))
+					copy(s, vType)
+					vType = s[:cap(s)]
+					ref.set(vType)
+					crossedArray = true
+				} else if index >= len(vType) {
+					return nil, nil
+				}
+				ref = &fieldRef{s: vType, index: index}
+				continue
+			}
+		}
+
+		if !force {
+			return nil, nil
 		}
 
-		if i < len(fields)-1 {
-			currMap = m
+		m := make(map[string]interface{})
+		ref.set(m)
+		ref = &fieldRef{m: m, key: next}
+	}
+}
+
+// ErrInvalidArrayIndex is returned when a field is set through a path where an array is followed by a segment
+// which is not a valid index of the array: a negative number, a number far past its end (see maxArrayPadding) or not a number at all.
+var ErrInvalidArrayIndex = errors.New("invalid array index")
+
+// maxArrayPadding is the maximum number of nil elements an array can be padded with when setting an element past its end,
+// so that paths such as "tags.1000000000" cannot make arrays grow without bound.
+const maxArrayPadding = 1024
+
+// checkFieldPath returns ErrInvalidArrayIndex if lookupField, in force mode, would have to replace an array or grow it past maxArrayPadding.
+func checkFieldPath(name string, fieldMap map[string]interface{}) error {
+	var v interface{} = fieldMap
+	for _, field := range strings.Split(name, ".") {
+		switch vType := v.(type) {
+		case map[string]interface{}:
+			v = vType[field]
+		case []interface{}:
+			index, err := strconv.Atoi(field)
+			if err != nil || index < 0 || index > len(vType)+maxArrayPadding {
+				return fmt.Errorf("%w: %q in path %q", ErrInvalidArrayIndex, field, name)
+			}
+
+			if index >= len(vType) {
+				return nil
+			}
+			v = vType[index]
+		default:
+			return nil // the rest of the path is created from scratch
 		}
 	}
-	return currMap, f, fields[len(fields)-1]
+	return nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
 }
 
 // Has tells returns true if the document contains a field with the supplied name.
 func (doc *Document) Has(name string) bool {
-	fieldMap, _, _ := lookupField(name, doc.fields, false)
-	return fieldMap != nil
+	ref, _ := lookupField(name, doc.fields, false)
+	return ref != nil
 }
 
-// Get retrieves the value of a field. Nested fields can be accessed using dot.
+// Get retrieves the value of a field. Nested fields can be accessed using dot, and array elements using their index (such as "tags.0").
+// Since nil is returned both for missing fields and for fields explicitly set to nil, Lookup should be used to tell them apart.
+// The value is not copied: nested objects and arrays are shared with the document, thus they must be treated as read-only
+// (use Clone or AsMap to obtain values that can be modified).
 func (doc *Document) Get(name string) interface{} {
-	_, v, _ := lookupField(name, doc.fields, false)
+	_, v := lookupField(name, doc.fields, false)
 	return v
 }
 
-// Set maps a field to a value. Nested fields can be accessed using dot.
+// GetRef returns the value of a field without copying it, even if it is a large nested object or array, which makes it
+// suitable for read-only access, such as in analytics. Nested fields can be accessed using dot.
+// The returned value aliases the document: it is shared with the document and with any view created by COW, thus mutating it
+// results in undefined behavior, while changes made to the document afterwards may or may not be visible through it.
+// Use Clone or AsMap to obtain values that can be modified.
+func (doc *Document) GetRef(name string) interface{} {
+	_, v := lookupField(name, doc.fields, false)
+	return v
+}
+
+// Lookup retrieves the value of a field, and reports whether the field exists. Nested fields can be accessed using dot.
+// A field explicitly set to nil is returned as (nil, true), while a missing field is returned as (nil, false).
+func (doc *Document) Lookup(name string) (interface{}, bool) {
+	ref, v := lookupField(name, doc.fields, false)
+	return v, ref != nil
+}
+
+// GetMany retrieves the values of several fields at once, returning a map from each requested name (in dot notation) to the value of the field.
+// Missing fields are not included in the map, while fields explicitly set to nil are included with a nil value.
+func (doc *Document) GetMany(names ...string) map[string]interface{} {
+	values := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		if ref, v := lookupField(name, doc.fields, false); ref != nil {
+			values[name] = v
+		}
+	}
+	return values
+}
+
+// ArrayValues retrieves the values of a field whose path crosses one or more arrays of objects,
+// such as "items.sku", where "items" is an array: the path is followed within each element of the array, collecting the sub-values.
+// Arrays are crossed implicitly, since there is no wildcard syntax (a "*" segment is treated as a regular field name).
+// Elements which are not objects or do not contain the rest of the path are skipped.
+// The second return value reports whether the path actually crosses an array: if false, Get should be used instead.
+func (doc *Document) ArrayValues(name string) ([]interface{}, bool) {
+	return collectArrayValues(strings.Split(name, "."), doc.fields)
+}
+
+func collectArrayValues(fields []string, fieldMap map[string]interface{}) ([]interface{}, bool) {
+	v, exists := fieldMap[fields[0]]
+	if !exists {
+		return nil, false
+	}
+
+	if len(fields) == 1 {
+		return []interface{}{v}, false
+	}
+
+	switch vType := v.(type) {
+	case map[string]interface{}:
+		return collectArrayValues(fields[1:], vType)
+	case []interface{}:
+		values := make([]interface{}, 0)
+		for _, elem := range vType {
+			if elemMap, isMap := elem.(map[string]interface{}); isMap {
+				elemValues, _ := collectArrayValues(fields[1:], elemMap)
+				values = append(values, elemValues...)
+			}
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	urlType  = reflect.TypeOf(url.URL{})
+)
+
+// GetString returns the value of a field as a string. Nested fields can be accessed using dot.
+// The second return value reports whether the field exists and its value is convertible to a string (see GetField).
+func (doc *Document) GetString(name string) (string, bool) {
+	v, ok := doc.getTyped(name, reflect.TypeOf(""))
+	s, _ := v.(string)
+	return s, ok
+}
+
+// GetInt64 returns the value of a field as an int64, converting numbers of other types if no information is lost.
+func (doc *Document) GetInt64(name string) (int64, bool) {
+	v, ok := doc.getTyped(name, reflect.TypeOf(int64(0)))
+	n, _ := v.(int64)
+	return n, ok
+}
+
+// GetFloat64 returns the value of a field as a float64, converting numbers of other types if no information is lost.
+func (doc *Document) GetFloat64(name string) (float64, bool) {
+	v, ok := doc.getTyped(name, reflect.TypeOf(float64(0)))
+	f, _ := v.(float64)
+	return f, ok
+}
+
+// GetBool returns the value of a field as a bool.
+func (doc *Document) GetBool(name string) (bool, bool) {
+	v, ok := doc.getTyped(name, reflect.TypeOf(false))
+	b, _ := v.(bool)
+	return b, ok
+}
+
+// GetTime returns the value of a field as a time.Time, parsing strings in RFC3339 format.
+func (doc *Document) GetTime(name string) (time.Time, bool) {
+	v, ok := doc.getTyped(name, timeType)
+	tm, _ := v.(time.Time)
+	return tm, ok
+}
+
+func (doc *Document) getTyped(name string, t reflect.Type) (interface{}, bool) {
+	if !doc.Has(name) {
+		return nil, false
+	}
+	return getConverted(doc.Get(name), t)
+}
+
+// NumericGetMode controls whether typed getters, such as GetField, convert numbers between different types.
+type NumericGetMode int
+
+const (
+	// NumericLenient allows numbers to be converted to the requested type, provided that no information is lost
+	// (e.g. a float64 can be retrieved as an int64 only if its value is integral).
+	NumericLenient NumericGetMode = iota
+	// NumericStrict requires numbers to be stored with exactly the requested type, which is int64, uint64 or float64.
+	NumericStrict
+)
+
+var typedGetterMode int32 = int32(NumericLenient)
+
+// SetTypedGetterMode sets the NumericGetMode used by the typed getters, which is NumericLenient by default.
+// It can be called while documents are being accessed, although the mode is meant to be set once, when the application starts.
+func SetTypedGetterMode(mode NumericGetMode) {
+	atomic.StoreInt32(&typedGetterMode, int32(mode))
+}
+
+// TypedGetterMode returns the NumericGetMode used by the typed getters (see SetTypedGetterMode).
+func TypedGetterMode() NumericGetMode {
+	return NumericGetMode(atomic.LoadInt32(&typedGetterMode))
+}
+
+// getConverted converts a field value for a typed getter, honoring TypedGetterMode.
+func getConverted(v interface{}, t reflect.Type) (interface{}, bool) {
+	if TypedGetterMode() == NumericStrict && util.IsNumber(v) && t != nil && isNumericKind(t.Kind()) && reflect.TypeOf(v) != t {
+		return nil, false
+	}
+	return convertValue(v, t)
+}
+
+// convertValue attempts to convert a normalized value to type t.
+// Numbers are converted between numeric types only if no information is lost (except for float precision),
+// while times are converted from and to strings in RFC3339 format, and URLs are parsed from strings.
+func convertValue(v interface{}, t reflect.Type) (interface{}, bool) {
+	if v == nil || t == nil {
+		return nil, false
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Type() == t {
+		return v, true
+	}
+
+	switch {
+	case t == timeType:
+		if s, isString := v.(string); isString {
+			tm, err := time.Parse(time.RFC3339Nano, s)
+			return tm, err == nil
+		}
+	case t == urlType || t == reflect.PtrTo(urlType):
+		if s, isString := v.(string); isString {
+			u, err := url.Parse(s)
+			if err != nil {
+				return nil, false
+			}
+
+			if t == urlType {
+				return *u, true
+			}
+			return u, true
+		}
+	case t.Kind() == reflect.String:
+		if tm, isTime := v.(time.Time); isTime {
+			return reflect.ValueOf(tm.Format(time.RFC3339Nano)).Convert(t).Interface(), true
+		}
+	case isNumericKind(t.Kind()):
+		if !util.IsNumber(v) {
+			return nil, false
+		}
+
+		converted := rv.Convert(t)
+		if isFloatKind(rv.Kind()) && isFloatKind(t.Kind()) { // floats only lose precision
+			if converted.OverflowFloat(rv.Float()) {
+				return nil, false
+			}
+			return converted.Interface(), true
+		}
+
+		if isNegative(rv) != isNegative(converted) || converted.Convert(rv.Type()).Interface() != v {
+			return nil, false
+		}
+		return converted.Interface(), true
+	}
+	return nil, false
+}
+
+func isNumericKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
+
+func isFloatKind(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+func isNegative(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() < 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() < 0
+	}
+	return false
+}
+
+// Set maps a field to a value. Nested fields can be accessed using dot, and array elements using their index (such as "items.2.price"):
+// arrays are grown as needed, padding them with nil elements, up to 1024 elements past their end.
+// If the value cannot be normalized (e.g. because it contains an unsupported type), or the path is not valid (see ErrInvalidArrayIndex),
+// the document is silently left unchanged: use SetE to be notified of the failure.
 func (doc *Document) Set(name string, value interface{}) {
+	_ = doc.SetE(name, value)
+}
+
+// SetE is like Set, but it returns the error preventing the value from being normalized or the path from being followed,
+// in which case the document is left unchanged.
+func (doc *Document) SetE(name string, value interface{}) error {
 	normalizedValue, err := internal.Normalize(value)
-	if err == nil {
-		m, _, fieldName := lookupField(name, doc.fields, true)
-		m[fieldName] = normalizedValue
+	if err != nil {
+		return fmt.Errorf("cannot set field %q: %w", name, err)
+	}
+
+	if err := checkFieldPath(name, doc.fields); err != nil {
+		return fmt.Errorf("cannot set field %q: %w", name, err)
+	}
+
+	doc.beforeWrite(name)
+	ref, _ := lookupField(name, doc.fields, true)
+	ref.set(normalizedValue)
+	doc.ownValue(name)
+	return nil
+}
+
+// Compute returns a new document containing one field for each entry of specs, whose value is the result of the associated function.
+// Each function reads the fields of the source document through get, which behaves like Get.
+// Field names of specs can use dot notation to produce nested fields.
+func (doc *Document) Compute(specs map[string]func(get func(path string) interface{}) interface{}) *Document {
+	res := NewDocument()
+	for name, compute := range specs {
+		res.Set(name, compute(doc.Get))
+	}
+	return res
+}
+
+// Truncate caps the length of the fields in limits to the corresponding maximum length:
+// strings are trimmed to the given number of runes and arrays to the given number of elements.
+// Missing fields and fields of any other type are left unchanged, as well as negative limits.
+func (doc *Document) Truncate(limits map[string]int) {
+	for name, limit := range limits {
+		if limit < 0 {
+			continue
+		}
+
+		if !doc.Has(name) {
+			continue
+		}
+
+		doc.beforeWrite(name)
+		ref, v := lookupField(name, doc.fields, true)
+		switch vType := v.(type) {
+		case string:
+			if utf8.RuneCountInString(vType) > limit {
+				ref.set(string([]rune(vType)[:limit]))
+			}
+		case []interface{}:
+			if len(vType) > limit {
+				ref.set(vType[:limit:limit])
+			}
+		}
+	}
+}
+
+// ErrIntegerOverflow is returned when an integer operation overflows the int64 range.
+var ErrIntegerOverflow = errors.New("integer overflow")
+
+// IncrementInt adds delta to the integer value of a field, which is treated as zero if missing, and returns the new value.
+// If the field is not an integer or the result overflows the int64 range, an error is returned and the document is left unchanged.
+func (doc *Document) IncrementInt(name string, delta int64) (int64, error) {
+	var current int64
+	if doc.Has(name) {
+		switch v := doc.Get(name).(type) {
+		case int64:
+			current = v
+		case uint64:
+			if v > math.MaxInt64 {
+				return 0, fmt.Errorf("%w: field %q has value %d", ErrIntegerOverflow, name, v)
+			}
+			current = int64(v)
+		default:
+			return 0, fmt.Errorf("field %q is not an integer: %v", name, v)
+		}
+	}
+
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, fmt.Errorf("%w: %d + %d", ErrIntegerOverflow, current, delta)
+	}
+
+	res := current + delta
+	doc.Set(name, res)
+	return res, nil
+}
+
+// IncrFloat adds delta to the numeric value of a field, which is treated as zero if missing, and stores the result as a float64.
+// If the field is not a number, the document is left unchanged and 0 is returned. Use IncrFloatE to be notified of the failure.
+func (doc *Document) IncrFloat(name string, delta float64) float64 {
+	v, _ := doc.IncrFloatE(name, delta)
+	return v
+}
+
+// IncrFloatE is like IncrFloat, but it returns an error if the field is not a number.
+func (doc *Document) IncrFloatE(name string, delta float64) (float64, error) {
+	var current float64
+	if doc.Has(name) {
+		switch v := doc.Get(name).(type) {
+		case int64:
+			current = float64(v)
+		case uint64:
+			current = float64(v)
+		case float64:
+			current = v
+		default:
+			return 0, fmt.Errorf("field %q is not a number: %v", name, v)
+		}
+	}
+
+	res := current + delta
+	doc.Set(name, res)
+	return res, nil
+}
+
+// Push appends the supplied values to the array field with the given name, which is created if missing. Nested fields can be accessed using dot.
+// If the field is not an array, or any of the values cannot be normalized, the document is left unchanged.
+func (doc *Document) Push(name string, values ...interface{}) {
+	normalizedValues, err := internal.Normalize(values)
+	if err != nil {
+		return
+	}
+
+	current, exists := doc.Lookup(name)
+	s, isSlice := current.([]interface{})
+	if exists && !isSlice {
+		return
+	}
+
+	res := make([]interface{}, 0, len(s)+len(values))
+	res = append(res, s...)
+	res = append(res, normalizedValues.([]interface{})...)
+
+	if err := checkFieldPath(name, doc.fields); err != nil {
+		return
+	}
+
+	doc.beforeWrite(name)
+	ref, _ := lookupField(name, doc.fields, true)
+	ref.set(res)
+}
+
+// Pull removes from the array field with the given name all the elements equal to value, which are compared as in queries:
+// thus, numbers of different types are equal if their values are. Nested fields can be accessed using dot.
+// If the field is not an array, the document is left unchanged.
+func (doc *Document) Pull(name string, value interface{}) {
+	normalizedValue, err := internal.Normalize(value)
+	if err != nil {
+		return
+	}
+
+	s, isSlice := doc.Get(name).([]interface{})
+	if !isSlice {
+		return
+	}
+
+	res := make([]interface{}, 0, len(s))
+	for _, elem := range s {
+		if internal.Compare(elem, normalizedValue) != 0 {
+			res = append(res, elem)
+		}
+	}
+
+	doc.beforeWrite(name)
+	ref, _ := lookupField(name, doc.fields, true)
+	ref.set(res)
+}
+
+// SetRaw maps a field to a value encoded with GetRaw, which is useful to move values between documents.
+// Invalid encodings are silently ignored: use SetRawE to detect them.
+func (doc *Document) SetRaw(name string, encoded []byte) {
+	_ = doc.SetRawE(name, encoded)
+}
+
+// SetRawE is like SetRaw, but it returns an error if encoded is not a valid encoded value.
+func (doc *Document) SetRawE(name string, encoded []byte) error {
+	value, err := internal.DecodeValue(encoded)
+	if err != nil {
+		return err
+	}
+
+	normalized, err := internal.Normalize(value)
+	if err != nil {
+		return err
+	}
+
+	if err := checkFieldPath(name, doc.fields); err != nil {
+		return err
+	}
+
+	doc.beforeWrite(name)
+	ref, _ := lookupField(name, doc.fields, true)
+	ref.set(normalized)
+	doc.ownValue(name)
+	return nil
+}
+
+// GetRaw returns the encoding of the value of a field, which can be stored in another document through SetRaw.
+func (doc *Document) GetRaw(name string) ([]byte, error) {
+	return internal.EncodeValue(doc.GetRef(name))
+}
+
+func deleteField(fields map[string]interface{}, name string) {
+	if ref, _ := lookupField(name, fields, false); ref != nil {
+		ref, _ = lookupField(name, fields, true)
+		ref.delete()
+	}
+}
+
+// Delete removes the field with the given name, if it exists. Nested fields can be accessed using dot.
+// Array elements are set to nil rather than removed, so that the index of the following ones doesn't change.
+func (doc *Document) Delete(name string) {
+	if doc.Has(name) {
+		doc.beforeWrite(name)
+		deleteField(doc.fields, name)
+	}
+}
+
+// Rename moves the value of the field oldPath to newPath (both in dot notation), creating the missing objects along newPath as Set does.
+// The old field is removed first, thus newPath can be nested within oldPath, or vice versa. An error is returned if oldPath does not exist.
+func (doc *Document) Rename(oldPath, newPath string) error {
+	if !doc.Has(oldPath) {
+		return fmt.Errorf("field %q does not exist", oldPath)
+	}
+
+	if oldPath == newPath {
+		return nil
+	}
+
+	if err := checkFieldPath(newPath, doc.fields); err != nil {
+		return err
+	}
+
+	doc.beforeWrite(oldPath)
+	value := doc.Get(oldPath)
+	deleteField(doc.fields, oldPath)
+
+	doc.beforeWrite(newPath)
+	ref, _ := lookupField(newPath, doc.fields, true)
+	ref.set(value)
+	return nil
+}
+
+// DeleteAll removes each of the supplied fields which exists. Nested fields can be accessed using dot.
+func (doc *Document) DeleteAll(names []string) {
+	for _, name := range names {
+		doc.Delete(name)
 	}
 }
 
 // SetAll sets each field specified in the input map to the corresponding value. Nested fields can be accessed using dot.
+// All the values are normalized before the document is modified, and values which cannot be normalized are skipped, as with Set,
+// as well as fields whose path is not valid (see ErrInvalidArrayIndex).
+// Fields are written in lexicographic order, so that a field such as "a.b" is always applied after "a".
 func (doc *Document) SetAll(values map[string]interface{}) {
-	for updateField, updateValue := range values {
-		doc.Set(updateField, updateValue)
+	names := make([]string, 0, len(values))
+	normalized := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		if normalizedValue, err := internal.Normalize(value); err == nil {
+			names = append(names, name)
+			normalized[name] = normalizedValue
+		}
+	}
+
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if checkFieldPath(name, doc.fields) == nil {
+			doc.beforeWrite(name)
+			ref, _ := lookupField(name, doc.fields, true)
+			ref.set(normalized[name])
+			doc.ownValue(name)
+		}
 	}
 }
 
@@ -125,6 +1032,186 @@ func (doc *Document) Fields(includeSubFields bool) []string {
 	return util.MapKeys(doc.fields, true, includeSubFields)
 }
 
+// Field is a key-value pair of a document, as returned by OrderedFields.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// OrderedFields returns a copy of the top-level fields of the document sorted by key, which allows to produce a canonical representation of it.
+// Nested objects, including the ones held by arrays, are represented as []Field values, sorted the same way.
+func (doc *Document) OrderedFields() []Field {
+	return orderedFields(doc.fields)
+}
+
+func orderedFields(m map[string]interface{}) []Field {
+	keys := util.MapKeys(m, true, false)
+
+	fields := make([]Field, 0, len(keys))
+	for _, key := range keys {
+		fields = append(fields, Field{Key: key, Value: orderedValue(m[key])})
+	}
+	return fields
+}
+
+func orderedValue(v interface{}) interface{} {
+	switch vType := v.(type) {
+	case map[string]interface{}:
+		return orderedFields(vType)
+	case []interface{}:
+		s := make([]interface{}, len(vType))
+		for i, elem := range vType {
+			s[i] = orderedValue(elem)
+		}
+		return s
+	}
+	return util.DeepCopyValue(v)
+}
+
+// Flatten returns a map from the path (in dot notation) of each leaf field of the document to a copy of its value.
+// Nested objects are walked recursively, while arrays are kept as values. Empty objects are kept as well, so that UnflattenMap can rebuild them.
+func (doc *Document) Flatten() map[string]interface{} {
+	flat := make(map[string]interface{})
+	flattenMap(doc.fields, "", flat)
+	return flat
+}
+
+func flattenMap(m map[string]interface{}, prefix string, flat map[string]interface{}) {
+	for key, value := range m {
+		path := joinPath(prefix, key)
+		if nested, isMap := value.(map[string]interface{}); isMap && len(nested) > 0 {
+			flattenMap(nested, path, flat)
+			continue
+		}
+		flat[path] = util.DeepCopyValue(value)
+	}
+}
+
+// UnflattenMap rebuilds the nested map represented by a map whose keys are field paths in dot notation, such as the one returned by Flatten.
+// Paths are applied in lexicographic order, thus a path such as "a.b" always overrides a non-object value of "a".
+func UnflattenMap(flat map[string]interface{}) map[string]interface{} {
+	paths := make([]string, 0, len(flat))
+	for path := range flat {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	m := make(map[string]interface{})
+	for _, path := range paths {
+		if checkFieldPath(path, m) == nil {
+			ref, _ := lookupField(path, m, true)
+			ref.set(flat[path])
+		}
+	}
+	return m
+}
+
+// FindPaths returns the paths of all the leaf values of the document satisfying pred, in dot notation.
+// Nested objects and arrays are traversed, with array elements being addressed by their index (e.g. "tags.0").
+// Keys are visited in sorted order, and array elements in index order.
+func (doc *Document) FindPaths(pred func(value interface{}) bool) []string {
+	paths := make([]string, 0)
+	findPaths(doc.fields, "", pred, &paths)
+	return paths
+}
+
+func findPaths(value interface{}, path string, pred func(value interface{}) bool, paths *[]string) {
+	switch vType := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(vType))
+		for key := range vType {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			findPaths(vType[key], joinPath(path, key), pred, paths)
+		}
+	case []interface{}:
+		for i, elem := range vType {
+			findPaths(elem, joinPath(path, strconv.Itoa(i)), pred, paths)
+		}
+	default:
+		if pred(value) {
+			*paths = append(*paths, path)
+		}
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// ForEachInArray invokes fn for each element of the array stored at the supplied field, in index order.
+// Elements which are objects are wrapped as sub-documents sharing the same underlying fields,
+// while any other element is passed as nil. The iteration stops as soon as fn returns false.
+// Since fn can modify the sub-documents, the array of a document returned by COW is copied first.
+func (doc *Document) ForEachInArray(name string, fn func(i int, sub *Document) bool) {
+	doc.beforeUpdate(name)
+
+	s, _ := doc.Get(name).([]interface{})
+	for i, elem := range s {
+		var sub *Document
+		if fields, isMap := elem.(map[string]interface{}); isMap {
+			sub = &Document{fields: fields}
+		}
+
+		if !fn(i, sub) {
+			return
+		}
+	}
+}
+
+// Equal returns true if the two documents contain the same fields, recursively. Numbers are compared by value, regardless of their type.
+func (doc *Document) Equal(other *Document) bool {
+	return internal.Compare(doc.fields, other.fields) == 0
+}
+
+// EqualIgnoring returns true if the two documents contain the same fields, without taking into account the supplied fields.
+// Nested fields can be accessed using dot. Numbers are compared by value, regardless of their type.
+func (doc *Document) EqualIgnoring(other *Document, ignore ...string) bool {
+	fields := util.CopyMap(doc.fields)
+	otherFields := util.CopyMap(other.fields)
+
+	for _, name := range ignore {
+		deleteField(fields, name)
+		deleteField(otherFields, name)
+	}
+	return internal.Compare(fields, otherFields) == 0
+}
+
+// Subtract returns a copy of the document without the fields which are also present in other with an equal value.
+// Nested objects are subtracted recursively, so that only their unique or differing fields are kept.
+func (doc *Document) Subtract(other *Document) *Document {
+	return &Document{
+		fields: subtractMaps(doc.fields, other.fields),
+	}
+}
+
+func subtractMaps(m, other map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{})
+	for key, value := range m {
+		otherValue, exists := other[key]
+		if exists && internal.Compare(value, otherValue) == 0 {
+			continue
+		}
+
+		valueMap, isMap := value.(map[string]interface{})
+		otherMap, isOtherMap := otherValue.(map[string]interface{})
+		if isMap && isOtherMap {
+			if diff := subtractMaps(valueMap, otherMap); len(diff) > 0 {
+				res[key] = diff
+			}
+			continue
+		}
+		res[key] = util.DeepCopyValue(value)
+	}
+	return res
+}
+
 // ExpiresAt returns the document expiration instant
 func (doc *Document) ExpiresAt() *time.Time {
 	exp, ok := doc.Get(ExpiresAtField).(time.Time)
@@ -139,7 +1226,26 @@ func (doc *Document) SetExpiresAt(expiration time.Time) {
 	doc.Set(ExpiresAtField, expiration)
 }
 
-// TTL returns a duration representing the time to live of the document before expiration.
+// SetExpiresAfter makes the document expire after the supplied duration, starting from now.
+func (doc *Document) SetExpiresAfter(d time.Duration) {
+	doc.SetExpiresAt(time.Now().Add(d))
+}
+
+// WithExpiration returns a deep copy of the document which expires after the supplied duration, leaving the original document untouched.
+func (doc *Document) WithExpiration(d time.Duration) *Document {
+	docCopy := doc.Clone()
+	docCopy.SetExpiresAfter(d)
+	return docCopy
+}
+
+// WithoutExpiration returns a deep copy of the document which never expires, leaving the original document untouched.
+func (doc *Document) WithoutExpiration() *Document {
+	docCopy := doc.Clone()
+	delete(docCopy.fields, ExpiresAtField)
+	return docCopy
+}
+
+// TTL returns a duration representing the time to live of the document before expiration, with nanosecond precision.
 // A negative duration means that the document has no expiration, while a zero value represents an already expired document.
 func (doc *Document) TTL() time.Duration {
 	expiresAt := doc.ExpiresAt()
@@ -147,13 +1253,37 @@ func (doc *Document) TTL() time.Duration {
 		return time.Duration(-1)
 	}
 
-	now := time.Now()
-
-	if expiresAt.Before(now) { // document already expired
+	ttl := time.Until(*expiresAt)
+	if ttl < 0 { // document already expired
 		return time.Duration(0)
 	}
+	return ttl
+}
 
-	return time.Millisecond * time.Duration(expiresAt.Sub(now).Milliseconds())
+// MarshalJSON encodes the fields of the document as a JSON object, rendering time values in RFC 3339 format.
+func (doc *Document) MarshalJSON() ([]byte, error) {
+	return json.Marshal(doc.fields)
+}
+
+// UnmarshalJSON replaces the fields of the document with the ones of a JSON object, keeping integral numbers as int64.
+// Since JSON has no time type, times encoded by MarshalJSON are decoded as strings.
+func (doc *Document) UnmarshalJSON(data []byte) error {
+	value, err := decodePatchValue(data)
+	if err != nil {
+		return err
+	}
+
+	fields, isMap := value.(map[string]interface{})
+	if !isMap {
+		return fmt.Errorf("cannot unmarshal %s into a document: not an object", TypeName(value))
+	}
+
+	doc.fields = fields
+	doc.shared = false
+	doc.owned = nil
+	doc.compacted = false
+	doc.declaredOrder = nil
+	return nil
 }
 
 // Unmarshal stores the document in the value pointed by v.
@@ -161,19 +1291,271 @@ func (doc *Document) Unmarshal(v interface{}) error {
 	return internal.Convert(doc.fields, v)
 }
 
-func isValidObjectId(id string) bool {
+// UnmarshalContext is like Unmarshal, but it can be cancelled through ctx.
+// The context is checked before converting each top-level field, which is the granularity of the cancellation:
+// a single large field (such as a long array) is always converted as a whole, as is the whole document when v does not point to a struct or a map.
+// If the conversion is aborted, the context error is returned and v may be partially filled.
+func (doc *Document) UnmarshalContext(ctx context.Context, v interface{}) error {
+	return internal.ConvertContext(ctx, doc.fields, v)
+}
+
+// ScanFields assigns the value of each field in targets to the variable pointed by the corresponding value.
+// Values are converted to the type of the targets where possible, following the same rules as GetField.
+// An error is returned if a field is missing or its value cannot be assigned to its target.
+func (doc *Document) ScanFields(targets map[string]interface{}) error {
+	for name, target := range targets {
+		if err := doc.UnmarshalField(name, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalField stores the value of a single field (in dot notation) in the value pointed by v, without converting the rest of the document.
+// Objects are unmarshaled as by Unmarshal, while other values are converted following the same rules as ScanFields.
+// An error is returned if the field is missing or its value cannot be assigned to v.
+func (doc *Document) UnmarshalField(name string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("target of field %q is not a non-nil pointer", name)
+	}
+
+	value, exists := doc.Lookup(name)
+	if !exists {
+		return fmt.Errorf("field %q does not exist", name)
+	}
+
+	if err := scanValue(value, rv.Elem()); err != nil {
+		return fmt.Errorf("field %q cannot be assigned to a value of type %s: %w", name, rv.Elem().Type(), err)
+	}
+	return nil
+}
+
+func scanValue(value interface{}, dest reflect.Value) error {
+	if value == nil {
+		dest.Set(reflect.Zero(dest.Type()))
+		return nil
+	}
+
+	if reflect.TypeOf(value).AssignableTo(dest.Type()) {
+		dest.Set(reflect.ValueOf(value))
+		return nil
+	}
+
+	// the values of types implementing encoding.TextMarshaler are stored as strings
+	if text, isString := value.(string); isString {
+		if unmarshaler, ok := dest.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return unmarshaler.UnmarshalText([]byte(text))
+		}
+	}
+
+	if converted, ok := convertValue(value, dest.Type()); ok {
+		dest.Set(reflect.ValueOf(converted))
+		return nil
+	}
+
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return internal.ConvertValue(value, dest.Addr().Interface())
+	}
+	return fmt.Errorf("incompatible value of type %T", value)
+}
+
+// ObjectIdProvider generates the ids of the documents inserted without one, and validates the ids of all the inserted documents.
+type ObjectIdProvider interface {
+	New() string
+	Validate(id string) bool
+}
+
+// UUIDProvider is the default ObjectIdProvider, which generates random UUIDs and only accepts UUIDs.
+type UUIDProvider struct{}
+
+func (UUIDProvider) New() string {
+	return uuid.NewV4().String()
+}
+
+func (UUIDProvider) Validate(id string) bool {
 	_, err := uuid.FromString(id)
 	return err == nil
 }
 
+var objectIdProvider ObjectIdProvider = UUIDProvider{}
+
+// SetObjectIdProvider replaces the ObjectIdProvider, allowing to adopt a different id scheme, such as sequential or externally assigned ids.
+// Since the provider is shared by all the databases, it should be set once, before any of them is used.
+func SetObjectIdProvider(provider ObjectIdProvider) {
+	objectIdProvider = provider
+}
+
+// NewObjectId returns a new document id, generated by the configured ObjectIdProvider.
+func NewObjectId() string {
+	return objectIdProvider.New()
+}
+
+// ValidateOptions customizes the checks performed by ValidateWithOptions.
+type ValidateOptions struct {
+	// AllowZeroExpiresAt accepts documents whose _expiresAt field holds the zero time.Time value.
+	// Since such documents are already expired, the zero value usually comes from an uninitialized field, thus it is rejected by default.
+	AllowZeroExpiresAt bool
+}
+
+// Validate checks that the document has a valid _id and, if set, a valid _expiresAt field, using the default ValidateOptions.
 func Validate(doc *Document) error {
-	if !isValidObjectId(doc.ObjectId()) {
+	return ValidateWithOptions(doc, nil)
+}
+
+// ValidateWithOptions is like Validate, but the checks are customized by opts. Nil options are the same as the default ones.
+func ValidateWithOptions(doc *Document, opts *ValidateOptions) error {
+	if opts == nil {
+		opts = &ValidateOptions{}
+	}
+
+	if !objectIdProvider.Validate(doc.ObjectId()) {
 		return fmt.Errorf("invalid _id: %s", doc.ObjectId())
 	}
 
-	if doc.Has(ExpiresAtField) && doc.ExpiresAt() == nil {
-		return fmt.Errorf("invalid _expiresAt: %s", doc.Get(ExpiresAtField))
+	if doc.Has(ExpiresAtField) {
+		expiresAt := doc.ExpiresAt()
+		if expiresAt == nil {
+			return fmt.Errorf("invalid _expiresAt: %s", doc.Get(ExpiresAtField))
+		}
+
+		if expiresAt.IsZero() && !opts.AllowZeroExpiresAt {
+			return fmt.Errorf("invalid _expiresAt: zero time value (set ValidateOptions.AllowZeroExpiresAt to accept it)")
+		}
+	}
+	return nil
+}
+
+// NewWithId creates a new empty document, whose id is generated by the configured ObjectIdProvider.
+func NewWithId() *Document {
+	doc := NewDocument()
+	doc.Set(ObjectIdField, NewObjectId())
+	return doc
+}
+
+// NewFromValidated creates a new document with the content of the provided object, generating its id if missing.
+// An error is returned if the object cannot be converted to a valid Document, or if the resulting document does not pass Validate.
+func NewFromValidated(o interface{}) (*Document, error) {
+	doc, err := NewDocumentOfWithOptions(o, &NormalizeOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if !doc.Has(ObjectIdField) {
+		doc.Set(ObjectIdField, NewObjectId())
+	}
+
+	if err := Validate(doc); err != nil {
+		return nil, err
 	}
+	return doc, nil
+}
+
+// ErrArrayElementType is returned by ValidateArrayTypes when an array contains an element of an unexpected kind.
+var ErrArrayElementType = errors.New("unexpected array element type")
+
+// ValidateArrayTypes checks that each of the array fields named by rules only contains elements of the associated kind,
+// returning an error reporting the path and index of the first offending element. Fields which do not exist are ignored.
+// Since documents store numbers as int64, uint64 or float64, floating point kinds accept every number,
+// while integer kinds only accept integers (unsigned kinds also require them to be non negative).
+// Objects, arrays and times are matched by reflect.Map, reflect.Slice and reflect.Struct respectively.
+func (doc *Document) ValidateArrayTypes(rules map[string]reflect.Kind) error {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !doc.Has(name) {
+			continue
+		}
+
+		elems, isSlice := doc.Get(name).([]interface{})
+		if !isSlice {
+			return fmt.Errorf("field %q is not an array", name)
+		}
+
+		kind := rules[name]
+		for i, elem := range elems {
+			matches, err := matchesKind(elem, kind)
+			if err != nil {
+				return err
+			}
+
+			if !matches {
+				return fmt.Errorf("%w: %s.%d is %s, expected %s", ErrArrayElementType, name, i, TypeName(elem), kind)
+			}
+		}
+	}
+	return nil
+}
+
+func matchesKind(value interface{}, kind reflect.Kind) (bool, error) {
+	switch kind {
+	case reflect.Float32, reflect.Float64:
+		switch value.(type) {
+		case int64, uint64, float64:
+			return true, nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch value.(type) {
+		case int64, uint64:
+			return true, nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch vType := value.(type) {
+		case int64:
+			return vType >= 0, nil
+		case uint64:
+			return true, nil
+		}
+	case reflect.String:
+		_, isString := value.(string)
+		return isString, nil
+	case reflect.Bool:
+		_, isBool := value.(bool)
+		return isBool, nil
+	case reflect.Map:
+		_, isMap := value.(map[string]interface{})
+		return isMap, nil
+	case reflect.Slice:
+		_, isSlice := value.([]interface{})
+		return isSlice, nil
+	case reflect.Struct:
+		_, isTime := value.(time.Time)
+		return isTime, nil
+	default:
+		return false, fmt.Errorf("unsupported kind %s", kind)
+	}
+	return false, nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface, using the same encoding of Encode.
+func (doc *Document) MarshalBinary() ([]byte, error) {
+	return Encode(doc)
+}
+
+// Size returns the number of bytes the document occupies when stored, which is the length of its encoding.
+// Since documents are not kept encoded, the size is computed by encoding the document, and always reflects its current content.
+func (doc *Document) Size() int {
+	data, _ := Encode(doc) // fields are normalized, thus they can always be encoded
+	return len(data)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface, replacing the fields of the document with the decoded ones.
+func (doc *Document) UnmarshalBinary(data []byte) error {
+	fields := make(map[string]interface{})
+	if err := internal.Decode(data, &fields); err != nil {
+		return err
+	}
+
+	doc.fields = fields
+	doc.shared = false
+	doc.owned = nil
+	doc.compacted = false
+	doc.declaredOrder = nil
 	return nil
 }
 
@@ -1,8 +1,20 @@
 package document
 
 import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
 	"math/rand"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -34,21 +46,33 @@ func TestDocument(t *testing.T) {
 func TestDocumentSetUint(t *testing.T) {
 	doc := NewDocument()
 
-	// test uint64 conversion
+	// unsigned integers are stored as int64 values, unless they exceed math.MaxInt64
 	doc.Set("uint", uint(0))
-	require.IsType(t, uint64(0), doc.Get("uint"))
+	require.IsType(t, int64(0), doc.Get("uint"))
 
 	doc.Set("uint8", uint8(0))
-	require.IsType(t, uint64(0), doc.Get("uint8"))
+	require.IsType(t, int64(0), doc.Get("uint8"))
 
 	doc.Set("uint16", uint16(0))
-	require.IsType(t, uint64(0), doc.Get("uint16"))
+	require.IsType(t, int64(0), doc.Get("uint16"))
 
-	doc.Set("uint32", uint16(0))
-	require.IsType(t, uint64(0), doc.Get("uint32"))
+	doc.Set("uint32", uint32(0))
+	require.IsType(t, int64(0), doc.Get("uint32"))
 
-	doc.Set("uint64", uint16(0))
-	require.IsType(t, uint64(0), doc.Get("uint64"))
+	doc.Set("uint64", uint64(math.MaxInt64))
+	require.Equal(t, int64(math.MaxInt64), doc.Get("uint64"))
+
+	doc.Set("uint64", uint64(math.MaxInt64)+1)
+	require.Equal(t, uint64(math.MaxInt64)+1, doc.Get("uint64"))
+
+	// the representation survives encoding
+	data, err := Encode(doc)
+	require.NoError(t, err)
+
+	decoded, err := Decode(data)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), decoded.Get("uint8"))
+	require.Equal(t, uint64(math.MaxInt64)+1, decoded.Get("uint64"))
 }
 
 func TestDocumentSetInt(t *testing.T) {
@@ -156,6 +180,86 @@ func TestDocumentValidation(t *testing.T) {
 	require.Error(t, Validate(doc))
 }
 
+func isULID(id string) bool {
+	if len(id) != 26 {
+		return false
+	}
+	return strings.Trim(strings.ToUpper(id), "0123456789ABCDEFGHJKMNPQRSTVWXYZ") == ""
+}
+
+type ulidProvider struct{}
+
+func (ulidProvider) New() string {
+	return "01ARZ3NDEKTSV4RRFFQ69G5FAV"
+}
+
+func (ulidProvider) Validate(id string) bool {
+	return isULID(id)
+}
+
+func TestDocumentValidateObjectId(t *testing.T) {
+	defer SetObjectIdProvider(UUIDProvider{})
+
+	doc := NewDocument()
+	doc.Set(ObjectIdField, "01ARZ3NDEKTSV4RRFFQ69G5FAV")
+	require.Error(t, Validate(doc))
+
+	SetObjectIdProvider(ulidProvider{})
+	require.NoError(t, Validate(doc))
+
+	doc.Set(ObjectIdField, "bb4e2b8c-09b9-4f7c-a1b4-bb1c1f8a1d2e")
+	err := Validate(doc)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "bb4e2b8c-09b9-4f7c-a1b4-bb1c1f8a1d2e")
+}
+
+func TestNewWithId(t *testing.T) {
+	doc := NewWithId()
+	require.NoError(t, Validate(doc))
+	require.NotEqual(t, doc.ObjectId(), NewWithId().ObjectId())
+}
+
+func TestNewFromValidated(t *testing.T) {
+	type todo struct {
+		Id    string `clover:"_id,omitempty"`
+		Title string `clover:"title"`
+	}
+
+	doc, err := NewFromValidated(&todo{Title: "test"})
+	require.NoError(t, err)
+	require.NoError(t, Validate(doc))
+	require.Equal(t, "test", doc.Get("title"))
+
+	id := NewObjectId()
+	doc, err = NewFromValidated(&todo{Id: id, Title: "test"})
+	require.NoError(t, err)
+	require.Equal(t, id, doc.ObjectId())
+
+	_, err = NewFromValidated(&todo{Id: "invalid", Title: "test"})
+	require.Error(t, err)
+
+	_, err = NewFromValidated(10)
+	require.Error(t, err)
+}
+
+func TestDocumentValidateExpiresAt(t *testing.T) {
+	doc := NewWithId()
+	doc.SetExpiresAt(time.Time{})
+	require.Error(t, Validate(doc))
+
+	require.NoError(t, ValidateWithOptions(doc, &ValidateOptions{AllowZeroExpiresAt: true}))
+	require.Error(t, ValidateWithOptions(doc, nil))
+
+	doc.SetExpiresAt(time.Now().Add(-time.Hour))
+	require.NoError(t, Validate(doc))
+
+	doc.SetExpiresAt(time.Now().AddDate(100, 0, 0))
+	require.NoError(t, Validate(doc))
+
+	doc.Set(ExpiresAtField, "tomorrow")
+	require.Error(t, Validate(doc))
+}
+
 func TestDocumentToMap(t *testing.T) {
 	doc := NewDocumentOf(map[string]interface{}{
 		"f_1": map[string]interface{}{
@@ -204,3 +308,1707 @@ func TestDocumentFields(t *testing.T) {
 	require.Equal(t, 5, len(keys))
 
 }
+
+func TestDocumentDeclaredOrder(t *testing.T) {
+	type Base struct {
+		Id      string `clover:"_id"`
+		Name    string `clover:"name"`
+		Created time.Time
+	}
+
+	type Label string
+
+	type item struct {
+		Zeta string `clover:"zeta"`
+		*Base
+		Label
+		Name  string `clover:"name"`
+		Alpha int    `clover:"alpha,omitempty"`
+		Beta  bool   `clover:"beta"`
+	}
+
+	doc := NewDocumentOf(&item{Zeta: "z", Base: &Base{Id: "1", Name: "shadowed"}, Name: "clover"}, WithDeclaredOrder())
+	require.Equal(t, []string{"zeta", "_id", "Created", "Label", "name", "beta"}, doc.DeclaredOrder())
+	require.ElementsMatch(t, doc.DeclaredOrder(), doc.Fields(false))
+
+	doc.Delete("zeta")
+	doc.Set("extra", 1)
+	require.Equal(t, []string{"_id", "Created", "Label", "name", "beta"}, doc.DeclaredOrder())
+	require.Equal(t, doc.DeclaredOrder(), doc.Copy().DeclaredOrder())
+	require.Equal(t, doc.DeclaredOrder(), doc.WithExpiration(time.Hour).DeclaredOrder())
+	require.Equal(t, doc.DeclaredOrder(), doc.WithoutExpiration().DeclaredOrder())
+
+	// replacing the content of the document discards the order
+	data, err := doc.MarshalJSON()
+	require.NoError(t, err)
+
+	cleared := doc.Copy()
+	cleared.Clear(false)
+	require.Nil(t, cleared.DeclaredOrder())
+
+	fromJSON := doc.Copy()
+	require.NoError(t, fromJSON.UnmarshalJSON(data))
+	require.Nil(t, fromJSON.DeclaredOrder())
+
+	binary, err := doc.MarshalBinary()
+	require.NoError(t, err)
+
+	fromBinary := doc.Copy()
+	require.NoError(t, fromBinary.UnmarshalBinary(binary))
+	require.Nil(t, fromBinary.DeclaredOrder())
+
+	doc = NewDocumentOf(&item{Alpha: 1}, WithDeclaredOrder())
+	require.Equal(t, []string{"zeta", "Label", "name", "alpha", "beta"}, doc.DeclaredOrder())
+
+	require.Nil(t, NewDocumentOf(&item{}).DeclaredOrder())
+	require.Nil(t, NewDocumentOf(map[string]interface{}{"a": 1}, WithDeclaredOrder()).DeclaredOrder())
+}
+
+func TestDocumentOrderedFields(t *testing.T) {
+	doc := NewDocumentOf(map[string]interface{}{
+		"b": map[string]interface{}{"z": 1, "a": "aString"},
+		"c": []interface{}{map[string]interface{}{"y": true, "x": nil}, 2},
+		"a": 42,
+	})
+
+	require.Equal(t, []Field{
+		{Key: "a", Value: int64(42)},
+		{Key: "b", Value: []Field{{Key: "a", Value: "aString"}, {Key: "z", Value: int64(1)}}},
+		{Key: "c", Value: []interface{}{[]Field{{Key: "x", Value: nil}, {Key: "y", Value: true}}, int64(2)}},
+	}, doc.OrderedFields())
+
+	require.Empty(t, NewDocument().OrderedFields())
+}
+
+func TestDocumentForEachInArray(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("items", []interface{}{
+		map[string]interface{}{"sku": "a"},
+		"notAnObject",
+		map[string]interface{}{"sku": "c"},
+		map[string]interface{}{"sku": "d"},
+	})
+
+	indexes := make([]int, 0)
+	skus := make([]interface{}, 0)
+	doc.ForEachInArray("items", func(i int, sub *Document) bool {
+		indexes = append(indexes, i)
+		if sub == nil {
+			skus = append(skus, nil)
+		} else {
+			skus = append(skus, sub.Get("sku"))
+		}
+		return true
+	})
+	require.Equal(t, []int{0, 1, 2, 3}, indexes)
+	require.Equal(t, []interface{}{"a", nil, "c", "d"}, skus)
+
+	n := 0
+	doc.ForEachInArray("items", func(i int, sub *Document) bool {
+		n++
+		return i < 2
+	})
+	require.Equal(t, 3, n)
+
+	doc.ForEachInArray("missing", func(i int, sub *Document) bool {
+		require.Fail(t, "unexpected element")
+		return true
+	})
+}
+
+func TestNewDocumentOfWithOptions(t *testing.T) {
+	s := struct {
+		Name  string
+		Price float64
+	}{"clover", 9.99}
+
+	doc, err := NewDocumentOfWithOptions(&s, &NormalizeOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 9.99, doc.Get("Price"))
+
+	_, err = NewDocumentOfWithOptions(&s, &NormalizeOptions{DisallowFloat: true})
+	require.Error(t, err)
+
+	_, err = NewDocumentOfWithOptions(10, &NormalizeOptions{})
+	require.Error(t, err)
+
+	cyclic := map[string]interface{}{"name": "clover"}
+	cyclic["self"] = cyclic
+
+	_, err = NewDocumentOfWithOptions(cyclic, &NormalizeOptions{})
+	require.ErrorIs(t, err, ErrCyclicReference)
+	require.Nil(t, NewDocumentOf(cyclic))
+}
+
+func TestDocumentEqualIgnoring(t *testing.T) {
+	doc := NewDocumentOf(map[string]interface{}{
+		"name": "clover",
+		"meta": map[string]interface{}{
+			"_version":   1,
+			"_updatedAt": "2022-01-01",
+			"tags":       []interface{}{"db", "go"},
+		},
+		"data": []byte("hello"),
+	})
+
+	other := NewDocumentOf(map[string]interface{}{
+		"name": "clover",
+		"meta": map[string]interface{}{
+			"_version":   2,
+			"_updatedAt": "2022-02-01",
+			"tags":       []interface{}{"db", "go"},
+		},
+		"data": []byte("hello"),
+	})
+
+	require.False(t, doc.EqualIgnoring(other))
+	require.False(t, doc.EqualIgnoring(other, "meta._version"))
+	require.True(t, doc.EqualIgnoring(other, "meta._version", "meta._updatedAt"))
+	require.True(t, doc.EqualIgnoring(other, "meta"))
+	require.True(t, doc.Has("meta._version")) // ignored fields must not be removed from the original documents
+
+	other.Set("name", "badger")
+	require.False(t, doc.EqualIgnoring(other, "meta._version", "meta._updatedAt"))
+
+	other.Set("name", "clover")
+	other.Set("data", []byte("hello!"))
+	require.False(t, doc.EqualIgnoring(other, "meta._version", "meta._updatedAt"))
+}
+
+func TestDocumentGetRef(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("a.b", map[string]interface{}{"c": []interface{}{1, 2, 3}})
+
+	ref := doc.GetRef("a.b").(map[string]interface{})
+	require.Equal(t, []interface{}{int64(1), int64(2), int64(3)}, ref["c"])
+	require.Equal(t, doc.Get("a.b"), ref)
+
+	doc.Set("a.b.d", "clover")
+	require.Equal(t, "clover", ref["d"])
+
+	require.Nil(t, doc.GetRef("a.missing"))
+}
+
+func newBenchmarkDocument() *Document {
+	doc := NewDocument()
+	for i := 0; i < 100; i++ {
+		doc.Set(fmt.Sprintf("nested.field%d", i), map[string]interface{}{"value": i})
+	}
+	return doc
+}
+
+func BenchmarkGet(b *testing.B) {
+	doc := newBenchmarkDocument()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = doc.Get("nested").(map[string]interface{})
+	}
+}
+
+func BenchmarkGetRef(b *testing.B) {
+	doc := newBenchmarkDocument()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = doc.GetRef("nested").(map[string]interface{})
+	}
+}
+
+func BenchmarkDocumentAsMap(b *testing.B) {
+	doc := newBenchmarkDocument()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = doc.AsMap()["nested"].(map[string]interface{})
+	}
+}
+
+func TestDocumentCOW(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("a.b", "clover")
+	doc.Set("tags", []interface{}{"db", "go"})
+
+	copies := atomic.LoadInt64(&cowCopies)
+
+	views := make([]*Document, 0)
+	for i := 0; i < 10; i++ {
+		views = append(views, doc.COW())
+	}
+
+	for _, view := range views {
+		require.Equal(t, "clover", view.Get("a.b"))
+		require.Equal(t, doc.GetRef("tags"), view.GetRef("tags"))
+	}
+	require.Equal(t, copies, atomic.LoadInt64(&cowCopies)) // reads must not trigger copies
+
+	views[0].Set("a.b", "badger")
+	require.Equal(t, copies+2, atomic.LoadInt64(&cowCopies)) // only the root and "a" are copied
+	require.Equal(t, "badger", views[0].Get("a.b"))
+	require.Equal(t, "clover", doc.Get("a.b"))
+	require.Equal(t, "clover", views[1].Get("a.b"))
+
+	// fields outside of the written path are still shared
+	require.True(t, &doc.Get("tags").([]interface{})[0] == &views[0].Get("tags").([]interface{})[0])
+
+	views[0].Set("a.c", "bolt")
+	require.Equal(t, copies+2, atomic.LoadInt64(&cowCopies)) // the view has its own copy of "a" now
+
+	doc.Set("a.b", "sqlite")
+	require.Equal(t, copies+4, atomic.LoadInt64(&cowCopies))
+	require.Equal(t, "sqlite", doc.Get("a.b"))
+	require.Equal(t, "clover", views[1].Get("a.b"))
+	require.Equal(t, "badger", views[0].Get("a.b"))
+}
+
+func TestDocumentCOWForEachInArray(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("items", []interface{}{map[string]interface{}{"n": 1}, map[string]interface{}{"n": 2}})
+	doc.Set("tags", []interface{}{"db", "go"})
+
+	view := doc.COW()
+	view.ForEachInArray("items", func(i int, sub *Document) bool {
+		sub.Set("n", i*10)
+		return true
+	})
+
+	require.Equal(t, int64(0), view.Get("items.0.n"))
+	require.Equal(t, int64(10), view.Get("items.1.n"))
+	require.Equal(t, int64(1), doc.Get("items.0.n"))
+	require.Equal(t, int64(2), doc.Get("items.1.n"))
+	require.True(t, &doc.Get("tags").([]interface{})[0] == &view.Get("tags").([]interface{})[0])
+}
+
+func TestDocumentScanFields(t *testing.T) {
+	type address struct {
+		City string `clover:"city"`
+	}
+
+	now := time.Now()
+
+	doc := NewDocument()
+	doc.Set("name", "John")
+	doc.Set("age", 30)
+	doc.Set("height", 1.80)
+	doc.Set("score", 10.0)
+	doc.Set("active", true)
+	doc.Set("createdAt", now)
+	doc.Set("updatedAt", now.Format(time.RFC3339Nano))
+	doc.Set("address", map[string]interface{}{"city": "Rome"})
+	doc.Set("tags", []string{"a", "b"})
+	doc.Set("nickname", nil)
+
+	var (
+		name      string
+		age       int
+		height    float32
+		score     int64
+		active    bool
+		createdAt time.Time
+		updatedAt time.Time
+		addr      address
+		tags      []string
+		nickname  = "none"
+	)
+
+	err := doc.ScanFields(map[string]interface{}{
+		"name":      &name,
+		"age":       &age,
+		"height":    &height,
+		"score":     &score,
+		"active":    &active,
+		"createdAt": &createdAt,
+		"updatedAt": &updatedAt,
+		"address":   &addr,
+		"tags":      &tags,
+		"nickname":  &nickname,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, "John", name)
+	require.Equal(t, 30, age)
+	require.Equal(t, float32(1.80), height)
+	require.Equal(t, int64(10), score)
+	require.True(t, active)
+	require.True(t, now.Equal(createdAt))
+	require.True(t, now.Equal(updatedAt))
+	require.Equal(t, address{City: "Rome"}, addr)
+	require.Equal(t, []string{"a", "b"}, tags)
+	require.Empty(t, nickname)
+
+	require.Error(t, doc.ScanFields(map[string]interface{}{"name": &age}))
+	require.Error(t, doc.ScanFields(map[string]interface{}{"height": &age}))
+	require.Error(t, doc.ScanFields(map[string]interface{}{"age": &active}))
+	require.Error(t, doc.ScanFields(map[string]interface{}{"missing": &name}))
+	require.Error(t, doc.ScanFields(map[string]interface{}{"name": name}))
+}
+
+func TestDocumentUnmarshalField(t *testing.T) {
+	type address struct {
+		City string `clover:"city"`
+		Zip  string `clover:"zip"`
+	}
+
+	doc := NewDocument()
+	doc.Set("name", "John")
+	doc.Set("profile.address", map[string]interface{}{"city": "Rome", "zip": "00100"})
+	doc.Set("profile.tags", []string{"a", "b"})
+	doc.Set("profile.age", 30)
+
+	var addr address
+	require.NoError(t, doc.UnmarshalField("profile.address", &addr))
+	require.Equal(t, address{City: "Rome", Zip: "00100"}, addr)
+
+	var tags []string
+	require.NoError(t, doc.UnmarshalField("profile.tags", &tags))
+	require.Equal(t, []string{"a", "b"}, tags)
+
+	var age int
+	require.NoError(t, doc.UnmarshalField("profile.age", &age))
+	require.Equal(t, 30, age)
+
+	require.Error(t, doc.UnmarshalField("profile.missing", &age))
+	require.Error(t, doc.UnmarshalField("name", &age))
+	require.Error(t, doc.UnmarshalField("name", age))
+}
+
+func TestDocumentArrayValues(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("items", []interface{}{
+		map[string]interface{}{"sku": "a", "details": map[string]interface{}{"tags": []interface{}{map[string]interface{}{"name": "x"}}}},
+		map[string]interface{}{"sku": "b"},
+		10,
+		map[string]interface{}{"price": 5},
+	})
+	doc.Set("nested.value", 1)
+
+	values, crossed := doc.ArrayValues("items.sku")
+	require.True(t, crossed)
+	require.Equal(t, []interface{}{"a", "b"}, values)
+
+	values, crossed = doc.ArrayValues("items.details.tags.name")
+	require.True(t, crossed)
+	require.Equal(t, []interface{}{"x"}, values)
+
+	values, crossed = doc.ArrayValues("items.missing")
+	require.True(t, crossed)
+	require.Empty(t, values)
+
+	_, crossed = doc.ArrayValues("items")
+	require.False(t, crossed)
+
+	_, crossed = doc.ArrayValues("nested.value")
+	require.False(t, crossed)
+
+	_, crossed = doc.ArrayValues("missing.value")
+	require.False(t, crossed)
+}
+
+func TestDocumentMarshalBinary(t *testing.T) {
+	type container struct {
+		Name string
+		Doc  *Document
+	}
+
+	doc := NewDocument()
+	doc.Set("int", 10)
+	doc.Set("string", "hello")
+	doc.Set("time", time.Now())
+	doc.Set("nested.values", []interface{}{1, "a", true})
+
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(&container{Name: "test", Doc: doc}))
+
+	var c container
+	require.NoError(t, gob.NewDecoder(&buf).Decode(&c))
+	require.Equal(t, "test", c.Name)
+	require.True(t, doc.EqualIgnoring(c.Doc))
+
+	data, err := doc.MarshalBinary()
+	require.NoError(t, err)
+
+	other := NewDocument()
+	other.Set("field", "value")
+	require.NoError(t, other.UnmarshalBinary(data))
+	require.True(t, doc.EqualIgnoring(other))
+	require.False(t, other.Has("field"))
+
+	require.Error(t, other.UnmarshalBinary([]byte{0xc1}))
+}
+
+func TestDocumentSize(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("name", "clover")
+
+	data, err := Encode(doc)
+	require.NoError(t, err)
+	require.Equal(t, len(data), doc.Size())
+
+	size := doc.Size()
+	doc.Set("description", strings.Repeat("a", 100))
+	require.Greater(t, doc.Size(), size+100)
+
+	doc.Delete("description")
+	require.Equal(t, size, doc.Size())
+}
+
+func TestDocumentSubtract(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("equal", 1)
+	doc.Set("different", "a")
+	doc.Set("unique", true)
+	doc.Set("nested.equal", 2)
+	doc.Set("nested.different", []interface{}{1, 2})
+	doc.Set("nested.deep.equal", "x")
+	doc.Set("sameNested.a", 1)
+	doc.Set("subsetNested.a", 1)
+
+	other := NewDocument()
+	other.Set("equal", 1)
+	other.Set("different", "b")
+	other.Set("nested.equal", 2)
+	other.Set("nested.different", []interface{}{1, 3})
+	other.Set("nested.deep.equal", "x")
+	other.Set("sameNested.a", 1)
+	other.Set("subsetNested.a", 1)
+	other.Set("subsetNested.b", 2)
+	other.Set("onlyOther", 3)
+
+	diff := doc.Subtract(other)
+
+	expected := NewDocument()
+	expected.Set("different", "a")
+	expected.Set("unique", true)
+	expected.Set("nested.different", []interface{}{1, 2})
+	require.Equal(t, expected.AsMap(), diff.AsMap())
+
+	// the result does not share values with the original document
+	diff.Set("nested.different", nil)
+	require.Equal(t, []interface{}{int64(1), int64(2)}, doc.Get("nested.different"))
+
+	require.Empty(t, doc.Subtract(doc).AsMap())
+	require.Equal(t, doc.AsMap(), doc.Subtract(NewDocument()).AsMap())
+}
+
+func TestDocumentWithExpiration(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("nested.field", 1)
+	doc.Set("tags", []interface{}{"db"})
+	doc.Set("data", []byte("clover"))
+	require.Equal(t, time.Duration(-1), doc.TTL())
+
+	expiring := doc.WithExpiration(time.Hour)
+	require.Equal(t, time.Duration(-1), doc.TTL())
+	require.Nil(t, doc.ExpiresAt())
+
+	ttl := expiring.TTL()
+	require.Greater(t, ttl, time.Hour-time.Minute)
+	require.LessOrEqual(t, ttl, time.Hour)
+
+	expiring.SetExpiresAt(time.Now().Add(time.Hour + 123456))
+	require.NotZero(t, expiring.TTL()%time.Millisecond) // sub-millisecond precision is kept
+
+	expiring.SetExpiresAt(time.Now().Add(-time.Nanosecond))
+	require.Equal(t, time.Duration(0), expiring.TTL())
+
+	// the copy does not share nested values with the original, including arrays and byte slices, as with Clone
+	expiring.Set("nested.field", 2)
+	require.Equal(t, int64(1), doc.Get("nested.field"))
+
+	expiring.Get("tags").([]interface{})[0] = "kv"
+	expiring.Get("data").([]byte)[0] = 'C'
+	require.Equal(t, []interface{}{"db"}, doc.Get("tags"))
+	require.Equal(t, []byte("clover"), doc.Get("data"))
+
+	doc.SetExpiresAt(time.Now().Add(time.Minute))
+	notExpiring := doc.WithoutExpiration()
+	require.Equal(t, time.Duration(-1), notExpiring.TTL())
+	require.False(t, notExpiring.Has(ExpiresAtField))
+	require.NotNil(t, doc.ExpiresAt())
+	require.Equal(t, int64(1), notExpiring.Get("nested.field"))
+
+	notExpiring.Get("tags").([]interface{})[0] = "kv"
+	require.Equal(t, []interface{}{"db"}, doc.Get("tags"))
+}
+
+func TestDocumentURL(t *testing.T) {
+	u, err := url.Parse("https://example.com/path?q=1#top")
+	require.NoError(t, err)
+
+	doc := NewDocument()
+	doc.Set("url", u)
+	require.Equal(t, u.String(), doc.Get("url"))
+
+	var target struct {
+		URL url.URL `clover:"url"`
+	}
+	require.NoError(t, doc.Unmarshal(&target))
+	require.Equal(t, *u, target.URL)
+
+	var ptr *url.URL
+	require.NoError(t, doc.ScanFields(map[string]interface{}{"url": &ptr}))
+	require.Equal(t, u, ptr)
+}
+
+func TestDocumentIncrementInt(t *testing.T) {
+	doc := NewDocument()
+
+	v, err := doc.IncrementInt("counter", 5)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), v)
+
+	v, err = doc.IncrementInt("counter", -7)
+	require.NoError(t, err)
+	require.Equal(t, int64(-2), v)
+	require.Equal(t, int64(-2), doc.Get("counter"))
+
+	doc.Set("max", int64(math.MaxInt64-1))
+	v, err = doc.IncrementInt("max", 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(math.MaxInt64), v)
+
+	_, err = doc.IncrementInt("max", 1)
+	require.ErrorIs(t, err, ErrIntegerOverflow)
+	require.Equal(t, int64(math.MaxInt64), doc.Get("max"))
+
+	doc.Set("min", int64(math.MinInt64+1))
+	v, err = doc.IncrementInt("min", -1)
+	require.NoError(t, err)
+	require.Equal(t, int64(math.MinInt64), v)
+
+	_, err = doc.IncrementInt("min", -1)
+	require.ErrorIs(t, err, ErrIntegerOverflow)
+	require.Equal(t, int64(math.MinInt64), doc.Get("min"))
+
+	_, err = doc.IncrementInt("min", math.MaxInt64)
+	require.NoError(t, err)
+
+	doc.Set("unsigned", uint64(math.MaxUint64))
+	_, err = doc.IncrementInt("unsigned", -1)
+	require.ErrorIs(t, err, ErrIntegerOverflow)
+
+	doc.Set("string", "10")
+	_, err = doc.IncrementInt("string", 1)
+	require.Error(t, err)
+	require.Equal(t, "10", doc.Get("string"))
+
+	doc.Set("float", 1.5)
+	_, err = doc.IncrementInt("float", 1)
+	require.Error(t, err)
+}
+
+func TestDocumentTruncate(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("text", "héllo, wörld")
+	doc.Set("short", "ok")
+	doc.Set("nested.list", []int{1, 2, 3, 4, 5})
+	doc.Set("number", 123456)
+
+	original := doc.COW()
+
+	doc.Truncate(map[string]int{
+		"text":        8,
+		"short":       10,
+		"nested.list": 2,
+		"number":      1,
+		"missing":     1,
+	})
+
+	require.Equal(t, "héllo, w", doc.Get("text"))
+	require.Equal(t, "ok", doc.Get("short"))
+	require.Equal(t, []interface{}{int64(1), int64(2)}, doc.Get("nested.list"))
+	require.Equal(t, int64(123456), doc.Get("number"))
+	require.False(t, doc.Has("missing"))
+
+	// documents sharing the fields are not affected
+	require.Equal(t, "héllo, wörld", original.Get("text"))
+	require.Len(t, original.Get("nested.list"), 5)
+
+	doc.Truncate(map[string]int{"text": 0})
+	require.Equal(t, "", doc.Get("text"))
+}
+
+func newPatchTestDocument() *Document {
+	doc := NewDocument()
+	doc.Set("name", "john")
+	doc.Set("address.city", "Rome")
+	doc.Set("tags", []interface{}{"a", "b", "c"})
+	doc.Set("a/b", 1)
+	doc.Set("m~n", 2)
+	return doc
+}
+
+func TestDocumentApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		patch  string
+		expect func(doc *Document)
+	}{
+		{`[{"op": "add", "path": "/age", "value": 30}]`, func(doc *Document) { doc.Set("age", 30) }},
+		{`[{"op": "add", "path": "/tags/1", "value": "x"}]`, func(doc *Document) { doc.Set("tags", []interface{}{"a", "x", "b", "c"}) }},
+		{`[{"op": "add", "path": "/tags/-", "value": {"k": 1.5}}]`, func(doc *Document) {
+			doc.Set("tags", []interface{}{"a", "b", "c", map[string]interface{}{"k": 1.5}})
+		}},
+		{`[{"op": "add", "path": "/address/zip", "value": "00100"}]`, func(doc *Document) { doc.Set("address.zip", "00100") }},
+		{`[{"op": "remove", "path": "/address/city"}]`, func(doc *Document) { doc.Set("address", map[string]interface{}{}) }},
+		{`[{"op": "remove", "path": "/tags/0"}]`, func(doc *Document) { doc.Set("tags", []interface{}{"b", "c"}) }},
+		{`[{"op": "replace", "path": "/name", "value": null}]`, func(doc *Document) { doc.Set("name", nil) }},
+		{`[{"op": "replace", "path": "/a~1b", "value": 10}, {"op": "replace", "path": "/m~0n", "value": 20}]`, func(doc *Document) {
+			doc.Set("a/b", 10)
+			doc.Set("m~n", 20)
+		}},
+		{`[{"op": "move", "from": "/address/city", "path": "/city"}]`, func(doc *Document) {
+			doc.Set("address", map[string]interface{}{})
+			doc.Set("city", "Rome")
+		}},
+		{`[{"op": "move", "from": "/tags/0", "path": "/tags/2"}]`, func(doc *Document) { doc.Set("tags", []interface{}{"b", "c", "a"}) }},
+		{`[{"op": "copy", "from": "/address", "path": "/billing"}]`, func(doc *Document) { doc.Set("billing.city", "Rome") }},
+		{`[{"op": "test", "path": "/tags", "value": ["a", "b", "c"]}, {"op": "test", "path": "/a~1b", "value": 1}]`, func(doc *Document) {}},
+	}
+
+	for _, test := range tests {
+		doc := newPatchTestDocument()
+		require.NoError(t, doc.ApplyJSONPatch([]byte(test.patch)), test.patch)
+
+		expected := newPatchTestDocument()
+		test.expect(expected)
+		require.Equal(t, expected.AsMap(), doc.AsMap(), test.patch)
+	}
+
+	// copied values are not shared with their source
+	doc := newPatchTestDocument()
+	require.NoError(t, doc.ApplyJSONPatch([]byte(`[{"op": "copy", "from": "/address", "path": "/billing"}, {"op": "replace", "path": "/billing/city", "value": "Milan"}]`)))
+	require.Equal(t, "Rome", doc.Get("address.city"))
+	require.Equal(t, "Milan", doc.Get("billing.city"))
+}
+
+func TestDocumentApplyJSONPatchErrors(t *testing.T) {
+	patches := []string{
+		`[{"op": "add", "path": "/name", "value": "mark"}, {"op": "test", "path": "/name", "value": "john"}]`,
+		`[{"op": "remove", "path": "/missing"}]`,
+		`[{"op": "replace", "path": "/tags/3", "value": 1}]`,
+		`[{"op": "add", "path": "/tags/01", "value": 1}]`,
+		`[{"op": "add", "path": "/missing/field", "value": 1}]`,
+		`[{"op": "add", "path": "name", "value": 1}]`,
+		`[{"op": "add", "path": "/name"}]`,
+		`[{"op": "move", "from": "/address", "path": "/address/city"}]`,
+		`[{"op": "copy", "path": "/address"}]`,
+		`[{"op": "unknown", "path": "/name"}]`,
+		`[{"op": "replace", "path": "", "value": [1, 2]}]`,
+		`{"op": "add"}`,
+	}
+
+	for _, patch := range patches {
+		doc := newPatchTestDocument()
+		require.Error(t, doc.ApplyJSONPatch([]byte(patch)), patch)
+		require.Equal(t, newPatchTestDocument().AsMap(), doc.AsMap(), patch)
+	}
+
+	doc := newPatchTestDocument()
+	err := doc.ApplyJSONPatch([]byte(patches[0]))
+	require.ErrorIs(t, err, ErrPatchTestFailed)
+}
+
+func TestDocumentCompact(t *testing.T) {
+	doc := NewDocument()
+	for i := 0; i < 100; i++ {
+		doc.Set(fmt.Sprintf("field%d", i), i)
+	}
+	doc.Set("nested.b", "b")
+	doc.Set("nested.a", []interface{}{1, map[string]interface{}{"z": 1, "y": 2}})
+	doc.Set("time", time.Date(2020, 1, 1, 0, 0, 0, 1, time.UTC))
+
+	for i := 0; i < 100; i++ {
+		doc.Delete(fmt.Sprintf("field%d", i))
+	}
+
+	fresh := NewDocument()
+	fresh.Set("time", time.Date(2020, 1, 1, 0, 0, 0, 1, time.UTC))
+	fresh.Set("nested.a", []interface{}{1, map[string]interface{}{"y": 2, "z": 1}})
+	fresh.Set("nested.b", "b")
+
+	freshData, err := Encode(fresh)
+	require.NoError(t, err)
+
+	decoded, err := Decode(freshData)
+	require.NoError(t, err)
+
+	view := doc.COW()
+	view.Compact()
+	view.Set("nested.b", "changed")
+	require.Equal(t, "b", doc.Get("nested.b"))
+
+	doc.Compact()
+	require.Equal(t, decoded.AsMap(), doc.AsMap())
+
+	data, err := Encode(doc)
+	require.NoError(t, err)
+	require.Equal(t, freshData, data)
+
+	// compacting a clean document is a no-op
+	fields := reflect.ValueOf(doc.fields).Pointer()
+	doc.Compact()
+	require.Equal(t, fields, reflect.ValueOf(doc.fields).Pointer())
+
+	again, err := Encode(doc)
+	require.NoError(t, err)
+	require.Equal(t, data, again)
+
+	// while any change makes the document compactable again
+	doc.Set("nested.b", "c")
+	fields = reflect.ValueOf(doc.fields).Pointer()
+	doc.Compact()
+	require.NotEqual(t, fields, reflect.ValueOf(doc.fields).Pointer())
+	require.Equal(t, "c", doc.Get("nested.b"))
+}
+
+func TestDocumentSetRaw(t *testing.T) {
+	src := NewDocument()
+	src.Set("profile.name", "john")
+	src.Set("profile.birth", time.Date(1990, 5, 1, 10, 0, 0, 123, time.UTC))
+	src.Set("profile.tags", []interface{}{"a", 1, 2.5, true, nil, []byte{1, 2}})
+	src.Set("profile.address.city", "Rome")
+
+	encoded, err := src.GetRaw("profile")
+	require.NoError(t, err)
+
+	dst := NewDocument()
+	dst.Set("other", 1)
+	require.NoError(t, dst.SetRawE("copied.profile", encoded))
+
+	decodeCopy := NewDocument()
+	decodeCopy.Set("other", 1)
+	decodeCopy.Set("copied.profile", src.Get("profile"))
+	require.Equal(t, decodeCopy.AsMap(), dst.AsMap())
+
+	// the moved value is not shared with the source document
+	dst.Set("copied.profile.name", "mark")
+	require.Equal(t, "john", src.Get("profile.name"))
+
+	require.Error(t, dst.SetRawE("invalid", []byte{0xc1}))
+	require.Error(t, dst.SetRawE("truncated", encoded[:len(encoded)-1]))
+	require.Error(t, dst.SetRawE("trailing", append(append([]byte{}, encoded...), 0x01)))
+
+	dst.SetRaw("invalid", []byte{})
+	require.False(t, dst.Has("invalid"))
+}
+
+func TestDocumentFindPaths(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("name", "clover")
+	doc.Set("description", strings.Repeat("a", 150))
+	doc.Set("owner.name", "owner")
+	doc.Set("owner.email", nil)
+	doc.Set("owner.bio", strings.Repeat("b", 101))
+	doc.Set("tags", []interface{}{"db", nil, strings.Repeat("c", 200)})
+	doc.Set("versions", []interface{}{
+		map[string]interface{}{"number": 1, "notes": nil},
+		map[string]interface{}{"number": 2, "notes": "fix"},
+	})
+	doc.Set("stars", 10)
+
+	isNil := func(value interface{}) bool {
+		return value == nil
+	}
+	require.Equal(t, []string{"owner.email", "tags.1", "versions.0.notes"}, doc.FindPaths(isNil))
+
+	isLongString := func(value interface{}) bool {
+		s, isString := value.(string)
+		return isString && len(s) > 100
+	}
+	require.Equal(t, []string{"description", "owner.bio", "tags.2"}, doc.FindPaths(isLongString))
+
+	isInt := func(value interface{}) bool {
+		_, isInt := value.(int64)
+		return isInt
+	}
+	require.Equal(t, []string{"stars", "versions.0.number", "versions.1.number"}, doc.FindPaths(isInt))
+
+	require.Empty(t, doc.FindPaths(func(value interface{}) bool { return false }))
+	require.Empty(t, NewDocument().FindPaths(func(value interface{}) bool { return true }))
+}
+
+func TestDocumentClone(t *testing.T) {
+	now := time.Now()
+
+	doc := NewDocument()
+	doc.Set("blob", []byte{1, 2, 3})
+	doc.Set("nested.blob", []byte{4, 5})
+	doc.Set("nested.items", []interface{}{map[string]interface{}{"blob": []byte{6}}, "a"})
+	doc.Set("time", now)
+
+	clone := doc.Clone()
+	require.Equal(t, doc.AsMap(), clone.AsMap())
+
+	clone.Get("blob").([]byte)[0] = 9
+	clone.Get("nested.blob").([]byte)[0] = 9
+	items := clone.Get("nested.items").([]interface{})
+	items[0].(map[string]interface{})["blob"].([]byte)[0] = 9
+	items[1] = "b"
+	clone.Set("time", now.Add(time.Hour))
+
+	require.Equal(t, []byte{1, 2, 3}, doc.Get("blob"))
+	require.Equal(t, []byte{4, 5}, doc.Get("nested.blob"))
+	require.Equal(t, []interface{}{map[string]interface{}{"blob": []byte{6}}, "a"}, doc.Get("nested.items"))
+	require.True(t, now.Equal(doc.Get("time").(time.Time)))
+}
+
+func TestDocumentCompute(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("firstName", "John")
+	doc.Set("lastName", "Smith")
+	doc.Set("order.price", 2.5)
+	doc.Set("order.qty", 4)
+
+	res := doc.Compute(map[string]func(get func(path string) interface{}) interface{}{
+		"fullName": func(get func(path string) interface{}) interface{} {
+			return get("firstName").(string) + " " + get("lastName").(string)
+		},
+		"order.total": func(get func(path string) interface{}) interface{} {
+			return get("order.price").(float64) * float64(get("order.qty").(int64))
+		},
+		"missing": func(get func(path string) interface{}) interface{} {
+			return get("notExists")
+		},
+	})
+
+	require.Equal(t, "John Smith", res.Get("fullName"))
+	require.Equal(t, 10.0, res.Get("order.total"))
+	require.True(t, res.Has("missing"))
+	require.Nil(t, res.Get("missing"))
+	require.Equal(t, []string{"fullName", "missing", "order.total"}, res.Fields(true))
+
+	// the source document is left unchanged
+	require.Equal(t, []string{"firstName", "lastName", "order.price", "order.qty"}, doc.Fields(true))
+}
+
+func TestNormalize(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("age", 30)
+	doc.Set("tags", []string{"a", "b"})
+
+	age, err := Normalize(30)
+	require.NoError(t, err)
+	require.Equal(t, doc.Get("age"), age)
+
+	tags, err := Normalize([2]string{"a", "b"})
+	require.NoError(t, err)
+	require.Equal(t, doc.Get("tags"), tags)
+
+	_, err = Normalize(make(chan int))
+	require.Error(t, err)
+}
+
+func TestNormalizeMap(t *testing.T) {
+	m := map[string]interface{}{
+		"int":     int(1),
+		"int32":   int32(2),
+		"float32": float32(1.5),
+		"nested": map[string]interface{}{
+			"uint8": uint8(3),
+			"slice": []int{4, 5},
+		},
+	}
+
+	normalized, err := NormalizeMap(m)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"int":     int64(1),
+		"int32":   int64(2),
+		"float32": float64(1.5),
+		"nested": map[string]interface{}{
+			"uint8": int64(3),
+			"slice": []interface{}{int64(4), int64(5)},
+		},
+	}, normalized)
+
+	// the input map is left unchanged
+	require.Equal(t, int(1), m["int"])
+
+	doc := NewDocumentOf(m)
+	require.Equal(t, doc.AsMap(), normalized)
+
+	normalized, err = NormalizeMap(nil)
+	require.NoError(t, err)
+	require.Empty(t, normalized)
+
+	_, err = NormalizeMap(map[string]interface{}{"ch": make(chan int)})
+	require.Error(t, err)
+}
+
+func TestDocumentPointer(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("a.b", "c")
+	doc.Set("list", []interface{}{1, map[string]interface{}{"x": true}})
+	doc.Set("a/b", 1)
+	doc.Set("m~n", 2)
+
+	value, ok := doc.GetPointer("/a/b")
+	require.True(t, ok)
+	require.Equal(t, "c", value)
+
+	value, ok = doc.GetPointer("/list/1/x")
+	require.True(t, ok)
+	require.Equal(t, true, value)
+
+	value, ok = doc.GetPointer("/a~1b")
+	require.True(t, ok)
+	require.Equal(t, int64(1), value)
+
+	value, ok = doc.GetPointer("/m~0n")
+	require.True(t, ok)
+	require.Equal(t, int64(2), value)
+
+	value, ok = doc.GetPointer("")
+	require.True(t, ok)
+	require.Equal(t, doc.AsMap(), value)
+
+	for _, ptr := range []string{"/a/c", "/list/2", "/list/01", "/list/-", "/a/b/c", "a"} {
+		_, ok := doc.GetPointer(ptr)
+		require.False(t, ok, ptr)
+	}
+
+	require.NoError(t, doc.SetPointer("/a/d", 10))
+	require.Equal(t, int64(10), doc.Get("a.d"))
+
+	require.NoError(t, doc.SetPointer("/list/0", "first"))
+	require.NoError(t, doc.SetPointer("/list/-", 3))
+	require.NoError(t, doc.SetPointer("/list/1/y", false))
+	require.Equal(t, []interface{}{"first", map[string]interface{}{"x": true, "y": false}, int64(3)}, doc.Get("list"))
+
+	require.NoError(t, doc.SetPointer("/a~1b", "escaped"))
+	require.Equal(t, "escaped", doc.AsMap()["a/b"])
+	require.Equal(t, "c", doc.Get("a.b"))
+
+	require.Error(t, doc.SetPointer("/list/5", 1))
+	require.Error(t, doc.SetPointer("/missing/field", 1))
+	require.Error(t, doc.SetPointer("/a/b/c", 1))
+	require.Error(t, doc.SetPointer("", 1))
+
+	view := doc.COW()
+	require.NoError(t, view.SetPointer("/a/b", "changed"))
+	require.Equal(t, "c", doc.Get("a.b"))
+
+	require.NoError(t, doc.SetPointer("", map[string]interface{}{"k": 1}))
+	require.Equal(t, map[string]interface{}{"k": int64(1)}, doc.AsMap())
+}
+
+func TestDocumentValidateArrayTypes(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("tags", []interface{}{"a", "b"})
+	doc.Set("scores", []interface{}{1, 2.5, uint64(3)})
+	doc.Set("counts", []interface{}{1, 2, 3})
+	doc.Set("signed", []interface{}{1, -2})
+	doc.Set("nested.flags", []interface{}{true, false})
+	doc.Set("items", []interface{}{map[string]interface{}{"a": 1}, map[string]interface{}{}})
+	doc.Set("mixed", []interface{}{"a", 1, nil})
+	doc.Set("name", "clover")
+
+	err := doc.ValidateArrayTypes(map[string]reflect.Kind{
+		"tags":         reflect.String,
+		"scores":       reflect.Float64,
+		"counts":       reflect.Int,
+		"signed":       reflect.Int64,
+		"nested.flags": reflect.Bool,
+		"items":        reflect.Map,
+		"missing":      reflect.String,
+	})
+	require.NoError(t, err)
+
+	err = doc.ValidateArrayTypes(map[string]reflect.Kind{"counts": reflect.Uint})
+	require.NoError(t, err)
+
+	err = doc.ValidateArrayTypes(map[string]reflect.Kind{"signed": reflect.Uint})
+	require.ErrorIs(t, err, ErrArrayElementType)
+	require.Contains(t, err.Error(), "signed.1")
+
+	err = doc.ValidateArrayTypes(map[string]reflect.Kind{"scores": reflect.Int})
+	require.ErrorIs(t, err, ErrArrayElementType)
+	require.Contains(t, err.Error(), "scores.1")
+
+	err = doc.ValidateArrayTypes(map[string]reflect.Kind{"mixed": reflect.String})
+	require.ErrorIs(t, err, ErrArrayElementType)
+	require.Contains(t, err.Error(), "mixed.1 is int64")
+
+	err = doc.ValidateArrayTypes(map[string]reflect.Kind{"tags": reflect.Bool})
+	require.ErrorIs(t, err, ErrArrayElementType)
+	require.Contains(t, err.Error(), "tags.0")
+
+	err = doc.ValidateArrayTypes(map[string]reflect.Kind{"name": reflect.String})
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrArrayElementType)
+
+	err = doc.ValidateArrayTypes(map[string]reflect.Kind{"tags": reflect.Chan})
+	require.Error(t, err)
+}
+
+func TestDocumentClear(t *testing.T) {
+	doc := NewDocument()
+	doc.Set(ObjectIdField, "id")
+	doc.Set("a.b", 1)
+	doc.Set("c", "d")
+
+	view := doc.COW()
+	view.Clear(true)
+	require.Equal(t, map[string]interface{}{ObjectIdField: "id"}, view.AsMap())
+	require.Equal(t, int64(1), doc.Get("a.b"))
+
+	view.Set("e", true)
+	require.Equal(t, []string{ObjectIdField, "e"}, view.Fields(true))
+	require.False(t, doc.Has("e"))
+
+	doc.Clear(false)
+	require.Equal(t, NewDocument().AsMap(), doc.AsMap())
+
+	data, err := Encode(doc)
+	require.NoError(t, err)
+
+	emptyData, err := Encode(NewDocument())
+	require.NoError(t, err)
+	require.Equal(t, emptyData, data)
+
+	doc.Set("a.b", 2)
+	require.Equal(t, int64(2), doc.Get("a.b"))
+
+	// clearing a document without an id never adds one
+	doc.Clear(true)
+	require.False(t, doc.Has(ObjectIdField))
+}
+
+func TestDocumentMerge(t *testing.T) {
+	newDocs := func() (*Document, *Document) {
+		doc := NewDocument()
+		doc.Set("name", "order")
+		doc.Set("a.y", 2)
+		doc.Set("a.z", 3)
+		doc.Set("scalar", 1)
+
+		other := NewDocument()
+		other.Set("name", "updated")
+		other.Set("a.x", 1)
+		other.Set("a.z", 4)
+		other.Set("scalar.nested", 1)
+		other.Set("tags", []interface{}{"a"})
+		return doc, other
+	}
+
+	doc, other := newDocs()
+	doc.Merge(other, false)
+	require.Equal(t, map[string]interface{}{
+		"name":   "order",
+		"a":      map[string]interface{}{"x": int64(1), "y": int64(2), "z": int64(3)},
+		"scalar": int64(1),
+		"tags":   []interface{}{"a"},
+	}, doc.AsMap())
+
+	// the merged document does not share values with other
+	doc.Set("tags.0", "b")
+	require.Equal(t, "a", other.Get("tags.0"))
+
+	doc, other = newDocs()
+	doc.Merge(other, true)
+	require.Equal(t, map[string]interface{}{
+		"name":   "updated",
+		"a":      map[string]interface{}{"x": int64(1), "y": int64(2), "z": int64(4)},
+		"scalar": map[string]interface{}{"nested": int64(1)},
+		"tags":   []interface{}{"a"},
+	}, doc.AsMap())
+}
+
+func TestDocumentMergeWith(t *testing.T) {
+	newDocs := func() (*Document, *Document) {
+		doc := NewDocument()
+		doc.Set("name", "order")
+		doc.Set("meta.a", 1)
+		doc.Set("meta.tags", []interface{}{"x", "y"})
+		doc.Set("tags", []interface{}{"a", "b"})
+		doc.Set("items", []interface{}{
+			map[string]interface{}{"sku": "s1", "qty": 1, "price": 10},
+			map[string]interface{}{"sku": "s2", "qty": 2},
+			map[string]interface{}{"note": "no sku"},
+		})
+
+		other := NewDocument()
+		other.Set("name", "updated")
+		other.Set("meta.b", 2)
+		other.Set("meta.tags", []interface{}{"y", "z"})
+		other.Set("tags", []interface{}{"b", "c", "c"})
+		other.Set("items", []interface{}{
+			map[string]interface{}{"sku": "s2", "qty": 5},
+			map[string]interface{}{"sku": "s1", "qty": 3},
+			map[string]interface{}{"sku": "s3", "qty": 1},
+		})
+		return doc, other
+	}
+
+	doc, other := newDocs()
+	doc.MergeWith(other)
+	require.Equal(t, "updated", doc.Get("name"))
+	require.Equal(t, int64(1), doc.Get("meta.a"))
+	require.Equal(t, int64(2), doc.Get("meta.b"))
+	require.Equal(t, []interface{}{"y", "z"}, doc.Get("meta.tags"))
+	require.Equal(t, other.Get("items"), doc.Get("items"))
+
+	// the merged document does not share values with other
+	doc.Get("items").([]interface{})[0].(map[string]interface{})["qty"] = int64(100)
+	require.Equal(t, int64(5), other.Get("items").([]interface{})[0].(map[string]interface{})["qty"])
+
+	doc, other = newDocs()
+	doc.MergeWith(other, MergeArrays("tags", ConcatArrays), MergeArrays("meta.tags", UnionArrays))
+	require.Equal(t, []interface{}{"a", "b", "b", "c", "c"}, doc.Get("tags"))
+	require.Equal(t, []interface{}{"x", "y", "z"}, doc.Get("meta.tags"))
+
+	doc, other = newDocs()
+	doc.MergeWith(other, MergeArrays("tags", UnionArrays), MergeArrays("meta.tags", ReplaceArrays))
+	require.Equal(t, []interface{}{"a", "b", "c"}, doc.Get("tags"))
+	require.Equal(t, []interface{}{"y", "z"}, doc.Get("meta.tags"))
+
+	doc, other = newDocs()
+	doc.MergeWith(other, MergeArrays("items", MergeArraysByKey("sku")))
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"sku": "s1", "qty": int64(3), "price": int64(10)},
+		map[string]interface{}{"sku": "s2", "qty": int64(5)},
+		map[string]interface{}{"note": "no sku"},
+		map[string]interface{}{"sku": "s3", "qty": int64(1)},
+	}, doc.Get("items"))
+
+	// strategies only apply when both values are arrays
+	doc, other = newDocs()
+	other.Set("name", []interface{}{"a"})
+	doc.MergeWith(other, MergeArrays("name", ConcatArrays))
+	require.Equal(t, []interface{}{"a"}, doc.Get("name"))
+}
+
+// checkLimitContext is a context which is cancelled after its Err method has been called a given number of times.
+type checkLimitContext struct {
+	context.Context
+	checks int
+}
+
+func (ctx *checkLimitContext) Err() error {
+	if ctx.checks <= 0 {
+		return context.Canceled
+	}
+	ctx.checks--
+	return nil
+}
+
+func TestDocumentUnmarshalContext(t *testing.T) {
+	n := 10000
+
+	doc := NewDocument()
+	for i := 0; i < n; i++ {
+		doc.Set(fmt.Sprintf("field%d", i), []interface{}{i, "value"})
+	}
+
+	m := make(map[string]interface{})
+	require.NoError(t, doc.UnmarshalContext(context.Background(), &m))
+
+	expected := make(map[string]interface{})
+	require.NoError(t, doc.Unmarshal(&expected))
+	require.Equal(t, expected, m)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	m = make(map[string]interface{})
+	require.ErrorIs(t, doc.UnmarshalContext(ctx, &m), context.Canceled)
+	require.Empty(t, m)
+
+	m = make(map[string]interface{})
+	err := doc.UnmarshalContext(&checkLimitContext{Context: context.Background(), checks: 10}, &m)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, m, 10)
+
+	// targets which cannot be filled one field at a time are converted as a whole
+	var iface interface{}
+	require.NoError(t, doc.UnmarshalContext(context.Background(), &iface))
+	require.Equal(t, expected, iface)
+
+	iface = nil
+	require.ErrorIs(t, doc.UnmarshalContext(ctx, &iface), context.Canceled)
+	require.Nil(t, iface)
+
+	type withURL struct {
+		Name string
+		Link url.URL
+	}
+
+	u, err := url.Parse("https://example.com/path")
+	require.NoError(t, err)
+
+	urlDoc := NewDocumentOf(&withURL{Name: "a", Link: *u})
+
+	var res withURL
+	require.NoError(t, urlDoc.UnmarshalContext(context.Background(), &res))
+	require.Equal(t, withURL{Name: "a", Link: *u}, res)
+}
+
+func TestDocumentTypedGetters(t *testing.T) {
+	now := time.Now()
+
+	doc := NewDocument()
+	doc.Set("name", "clover")
+	doc.Set("nested.count", 10)
+	doc.Set("price", 2.5)
+	doc.Set("integralFloat", 3.0)
+	doc.Set("enabled", true)
+	doc.Set("created", now)
+	doc.Set("createdString", now.Format(time.RFC3339Nano))
+	doc.Set("null", nil)
+
+	s, ok := doc.GetString("name")
+	require.True(t, ok)
+	require.Equal(t, "clover", s)
+
+	_, ok = doc.GetString("nested.count")
+	require.False(t, ok)
+
+	n, ok := doc.GetInt64("nested.count")
+	require.True(t, ok)
+	require.Equal(t, int64(10), n)
+
+	n, ok = doc.GetInt64("integralFloat")
+	require.True(t, ok)
+	require.Equal(t, int64(3), n)
+
+	n, ok = doc.GetInt64("price")
+	require.False(t, ok)
+	require.Zero(t, n)
+
+	f, ok := doc.GetFloat64("price")
+	require.True(t, ok)
+	require.Equal(t, 2.5, f)
+
+	f, ok = doc.GetFloat64("nested.count")
+	require.True(t, ok)
+	require.Equal(t, 10.0, f)
+
+	_, ok = doc.GetFloat64("name")
+	require.False(t, ok)
+
+	b, ok := doc.GetBool("enabled")
+	require.True(t, ok)
+	require.True(t, b)
+
+	_, ok = doc.GetBool("name")
+	require.False(t, ok)
+
+	tm, ok := doc.GetTime("created")
+	require.True(t, ok)
+	require.True(t, now.Equal(tm))
+
+	tm, ok = doc.GetTime("createdString")
+	require.True(t, ok)
+	require.True(t, now.Equal(tm))
+
+	_, ok = doc.GetTime("name")
+	require.False(t, ok)
+
+	for _, name := range []string{"missing", "nested.missing", "null"} {
+		_, ok := doc.GetString(name)
+		require.False(t, ok)
+
+		_, ok = doc.GetInt64(name)
+		require.False(t, ok)
+	}
+}
+
+func TestDocumentRename(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("name", "clover")
+	doc.Set("address.city", "Rome")
+	doc.Set("tags", []interface{}{"a", "b"})
+
+	require.NoError(t, doc.Rename("name", "info.title"))
+	require.NoError(t, doc.Rename("address.city", "city"))
+	require.NoError(t, doc.Rename("tags", "tags"))
+	require.Equal(t, map[string]interface{}{
+		"info":    map[string]interface{}{"title": "clover"},
+		"address": map[string]interface{}{},
+		"city":    "Rome",
+		"tags":    []interface{}{"a", "b"},
+	}, doc.AsMap())
+
+	require.NoError(t, doc.Rename("city", "city.name"))
+	require.Equal(t, "Rome", doc.Get("city.name"))
+
+	require.NoError(t, doc.Rename("city.name", "city"))
+	require.Equal(t, "Rome", doc.Get("city"))
+
+	require.Error(t, doc.Rename("missing", "other"))
+	require.False(t, doc.Has("other"))
+
+	// renaming a field of a copy-on-write view does not affect the original document
+	view := doc.COW()
+	require.NoError(t, view.Rename("info", "meta"))
+	view.Set("meta.title", "changed")
+	require.Equal(t, "clover", doc.Get("info.title"))
+	require.False(t, doc.Has("meta"))
+}
+
+func TestDocumentDelete(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("a.b.c", 1)
+	doc.Set("a.b.d", 2)
+	doc.Set("a.e", 3)
+	doc.Set("f", "g")
+
+	doc.Delete("a.b.c")
+	require.False(t, doc.Has("a.b.c"))
+	require.True(t, doc.Has("a.b.d"))
+
+	// deleting missing fields is a no-op
+	doc.Delete("missing")
+	doc.Delete("a.missing.c")
+	doc.Delete("f.g")
+	require.Equal(t, []string{"a.b.d", "a.e", "f"}, doc.Fields(true))
+
+	view := doc.COW()
+	view.DeleteAll([]string{"a.b", "f", "missing"})
+	require.Equal(t, []string{"a.e"}, view.Fields(true))
+	require.Equal(t, []string{"a.b.d", "a.e", "f"}, doc.Fields(true))
+
+	doc.DeleteAll([]string{"a", "f"})
+	require.Empty(t, doc.AsMap())
+}
+
+func TestDocumentGetMany(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("name", "clover")
+	doc.Set("null", nil)
+	doc.Set("nested.value", 1)
+	doc.Set("tags", []interface{}{"a", "b"})
+
+	require.Equal(t, map[string]interface{}{
+		"name":         "clover",
+		"null":         nil,
+		"nested.value": int64(1),
+		"tags.1":       "b",
+	}, doc.GetMany("name", "null", "nested.value", "tags.1", "missing", "nested.missing"))
+
+	require.Empty(t, doc.GetMany())
+}
+
+func TestDocumentLookup(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("null", nil)
+	doc.Set("nested.null", nil)
+	doc.Set("nested.value", 1)
+	doc.Set("zero", 0)
+
+	v, ok := doc.Lookup("null")
+	require.True(t, ok)
+	require.Nil(t, v)
+
+	v, ok = doc.Lookup("nested.null")
+	require.True(t, ok)
+	require.Nil(t, v)
+
+	v, ok = doc.Lookup("nested.value")
+	require.True(t, ok)
+	require.Equal(t, int64(1), v)
+
+	v, ok = doc.Lookup("zero")
+	require.True(t, ok)
+	require.Equal(t, int64(0), v)
+
+	for _, name := range []string{"missing", "nested.missing", "null.missing", "nested.value.missing"} {
+		v, ok := doc.Lookup(name)
+		require.False(t, ok, name)
+		require.Nil(t, v)
+
+		// Get cannot tell missing fields from null ones
+		require.Equal(t, doc.Get("null"), doc.Get(name))
+	}
+}
+
+func TestDocumentSetAll(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("a.x", 0)
+	doc.Set("keep", true)
+
+	values := make(map[string]interface{})
+	for i := 0; i < 100; i++ {
+		values[fmt.Sprintf("field%d", i)] = i
+	}
+	values["a"] = map[string]interface{}{"y": 1}
+	values["a.z"] = 2
+	values["invalid"] = make(chan int)
+
+	view := doc.COW()
+
+	copies := atomic.LoadInt64(&cowCopies)
+	view.SetAll(values)
+	require.Equal(t, copies+1, atomic.LoadInt64(&cowCopies))
+
+	for i := 0; i < 100; i++ {
+		require.Equal(t, int64(i), view.Get(fmt.Sprintf("field%d", i)))
+	}
+	require.Equal(t, map[string]interface{}{"y": int64(1), "z": int64(2)}, view.Get("a"))
+	require.True(t, view.Get("keep").(bool))
+	require.False(t, view.Has("invalid"))
+
+	require.Equal(t, []string{"a.x", "keep"}, doc.Fields(true))
+
+	// no copy is made if there is nothing to write
+	view = doc.COW()
+	copies = atomic.LoadInt64(&cowCopies)
+	view.SetAll(map[string]interface{}{"invalid": make(chan int)})
+	require.Equal(t, copies, atomic.LoadInt64(&cowCopies))
+}
+
+func TestDocumentSetE(t *testing.T) {
+	doc := NewDocument()
+	require.NoError(t, doc.SetE("a.b", 1))
+	require.Equal(t, int64(1), doc.Get("a.b"))
+
+	type unsupported struct {
+		Ch chan int
+	}
+
+	err := doc.SetE("a.c", &unsupported{Ch: make(chan int)})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "a.c")
+	require.False(t, doc.Has("a.c"))
+
+	// Set silently ignores the same failure
+	doc.Set("a.c", &unsupported{Ch: make(chan int)})
+	require.False(t, doc.Has("a.c"))
+	require.Equal(t, []string{"a.b"}, doc.Fields(true))
+}
+
+type stringerChan chan int
+
+func (ch stringerChan) String() string {
+	return "chan"
+}
+
+func TestStringerFallback(t *testing.T) {
+	defer SetStringerFallback(StringerFallback())
+
+	require.True(t, StringerFallback())
+
+	doc := NewDocument()
+	require.NoError(t, doc.SetE("ch", make(stringerChan)))
+	require.Equal(t, "chan", doc.Get("ch"))
+
+	SetStringerFallback(false)
+
+	err := doc.SetE("other", make(stringerChan))
+	require.Error(t, err)
+	require.False(t, doc.Has("other"))
+
+	require.Nil(t, NewDocumentOf(map[string]interface{}{"ch": make(stringerChan)}))
+
+	_, err = Normalize(make(stringerChan))
+	require.Error(t, err)
+}
+
+func TestDocumentArrayPaths(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("tags", []string{"a", "b"})
+	doc.Set("items", []map[string]interface{}{{"price": 1}, {"price": 2}, {"price": 3}})
+
+	require.Equal(t, "a", doc.Get("tags.0"))
+	require.Equal(t, "b", doc.Get("tags.1"))
+	require.Equal(t, int64(3), doc.Get("items.2.price"))
+
+	for _, name := range []string{"tags.2", "tags.-1", "tags.x", "items.3.price", "items.0.missing"} {
+		v, ok := doc.Lookup(name)
+		require.False(t, ok, name)
+		require.Nil(t, v)
+	}
+
+	copied := doc.Copy()
+
+	doc.Set("items.2.price", 9.99)
+	require.Equal(t, 9.99, doc.Get("items.2.price"))
+	require.Equal(t, int64(3), copied.Get("items.2.price"))
+
+	doc.Set("tags.3", "d")
+	require.Equal(t, []interface{}{"a", "b", nil, "d"}, doc.Get("tags"))
+	require.Equal(t, []interface{}{"a", "b"}, copied.Get("tags"))
+
+	doc.Delete("tags.1")
+	require.Equal(t, []interface{}{"a", nil, nil, "d"}, doc.Get("tags"))
+	require.Equal(t, []interface{}{"a", "b"}, copied.Get("tags"))
+
+	// fields of objects are never treated as indices
+	doc.Set("obj.0", 1)
+	require.Equal(t, map[string]interface{}{"0": int64(1)}, doc.Get("obj"))
+
+	// arrays are neither replaced nor grown without bound
+	for _, name := range []string{"tags.-1", "tags.x", "tags.1000000000", "items.-1.price", "items.x.price"} {
+		require.ErrorIs(t, doc.SetE(name, "z"), ErrInvalidArrayIndex, name)
+		require.ErrorIs(t, doc.Rename("obj", name), ErrInvalidArrayIndex, name)
+	}
+	require.Equal(t, []interface{}{"a", nil, nil, "d"}, doc.Get("tags"))
+	require.Len(t, doc.Get("items"), 3)
+	require.True(t, doc.Has("obj"))
+
+	require.NoError(t, doc.SetE("tags.1028", "e"))
+	require.Len(t, doc.Get("tags"), 1029)
+}
+
+func TestDocumentIncrFloat(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("counter", 1)
+
+	require.Equal(t, 2.5, doc.IncrFloat("counter", 1.5))
+	require.Equal(t, 0.5, doc.IncrFloat("score", 0.5))
+	require.Equal(t, 2.5, doc.Get("counter"))
+
+	doc.Set("name", "clover")
+	require.Equal(t, float64(0), doc.IncrFloat("name", 1))
+	require.Equal(t, "clover", doc.Get("name"))
+
+	_, err := doc.IncrFloatE("name", 1)
+	require.Error(t, err)
+}
+
+func TestDocumentPushPull(t *testing.T) {
+	doc := NewDocument()
+	doc.Push("tags", "a", "b")
+	doc.Push("tags", 1, uint8(2))
+	require.Equal(t, []interface{}{"a", "b", int64(1), int64(2)}, doc.Get("tags"))
+
+	copied := doc.Copy()
+	doc.Push("tags", 1.0)
+	doc.Pull("tags", 1)
+	require.Equal(t, []interface{}{"a", "b", int64(2)}, doc.Get("tags"))
+	require.Equal(t, []interface{}{"a", "b", int64(1), int64(2)}, copied.Get("tags"))
+
+	doc.Pull("tags", int32(2))
+	doc.Pull("tags", "missing")
+	require.Equal(t, []interface{}{"a", "b"}, doc.Get("tags"))
+
+	doc.Set("name", "clover")
+	doc.Push("name", "x")
+	doc.Pull("name", "clover")
+	require.Equal(t, "clover", doc.Get("name"))
+
+	doc.Push("nested.values", 1)
+	require.Equal(t, []interface{}{int64(1)}, doc.Get("nested.values"))
+}
+
+func TestDocumentJSON(t *testing.T) {
+	date := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	doc := NewDocument()
+	doc.Set("name", "clover")
+	doc.Set("count", 10)
+	doc.Set("ratio", 0.5)
+	doc.Set("date", date)
+	doc.Set("nested.tags", []string{"a", "b"})
+
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"name":"clover","count":10,"ratio":0.5,"date":"2020-01-02T03:04:05Z","nested":{"tags":["a","b"]}}`, string(data))
+
+	decoded := NewDocument()
+	require.NoError(t, json.Unmarshal(data, decoded))
+	require.Equal(t, int64(10), decoded.Get("count"))
+	require.Equal(t, 0.5, decoded.Get("ratio"))
+	require.Equal(t, date.Format(time.RFC3339), decoded.Get("date"))
+	require.Equal(t, []interface{}{"a", "b"}, decoded.Get("nested.tags"))
+
+	var docs []*Document
+	require.NoError(t, json.Unmarshal([]byte(`[{"a":1},{"b":2}]`), &docs))
+	require.Len(t, docs, 2)
+	require.Equal(t, int64(2), docs[1].Get("b"))
+
+	require.Error(t, json.Unmarshal([]byte(`[1]`), decoded))
+	require.Equal(t, "clover", decoded.Get("name"))
+}
+
+func TestDocumentEqual(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("count", 1)
+	doc.Set("nested.values", []interface{}{1, 2.5, "a"})
+
+	other := NewDocument()
+	other.Set("count", 1.0)
+	other.Set("nested.values", []interface{}{uint8(1), 2.5, "a"})
+
+	require.True(t, doc.Equal(other))
+	require.True(t, doc.Equal(doc.Clone()))
+
+	other.Set(ObjectIdField, "id")
+	require.False(t, doc.Equal(other))
+	require.True(t, doc.EqualIgnoring(other, ObjectIdField, ExpiresAtField))
+
+	other.Set("nested.values.1", 3)
+	require.False(t, doc.EqualIgnoring(other, ObjectIdField))
+}
+
+func TestDocumentCopyIsIndependent(t *testing.T) {
+	doc := NewDocument()
+	doc.Set("blob", []byte{1, 2})
+	doc.Set("tags", []interface{}{"a", map[string]interface{}{"b": 1}})
+
+	copied := doc.Copy()
+	doc.Get("blob").([]byte)[0] = 9
+	doc.Get("tags").([]interface{})[0] = "changed"
+	doc.Get("tags").([]interface{})[1].(map[string]interface{})["b"] = 2
+
+	require.Equal(t, []byte{1, 2}, copied.Get("blob"))
+	require.Equal(t, "a", copied.Get("tags.0"))
+	require.Equal(t, int64(1), copied.Get("tags.1.b"))
+}
+
+func TestDocumentFlatten(t *testing.T) {
+	doc := NewDocumentOf(map[string]interface{}{
+		"name": "clover",
+		"a": map[string]interface{}{
+			"b":     map[string]interface{}{"c": 1},
+			"tags":  []interface{}{"x", map[string]interface{}{"y": 2}},
+			"empty": map[string]interface{}{},
+		},
+	})
+
+	flat := doc.Flatten()
+	require.Equal(t, map[string]interface{}{
+		"name":    "clover",
+		"a.b.c":   int64(1),
+		"a.tags":  []interface{}{"x", map[string]interface{}{"y": int64(2)}},
+		"a.empty": map[string]interface{}{},
+	}, flat)
+
+	require.Equal(t, doc.AsMap(), UnflattenMap(flat))
+
+	flat["a.tags"].([]interface{})[0] = "changed"
+	require.Equal(t, "x", doc.Get("a.tags.0"))
+
+	require.Equal(t, map[string]interface{}{"a": map[string]interface{}{"b": 1}}, UnflattenMap(map[string]interface{}{"a": 0, "a.b": 1}))
+}
+
+type account struct {
+	Id      *big.Int
+	Balance *big.Rat
+	Limit   big.Int
+	Missing *big.Int
+}
+
+func TestDocumentBigNumbers(t *testing.T) {
+	id, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	balance := big.NewRat(-1050, 100)
+
+	doc := NewDocumentOf(account{Id: id, Balance: balance, Limit: *big.NewInt(5000)})
+	require.Equal(t, "123456789012345678901234567890", doc.Get("Id"))
+	require.Equal(t, "-21/2", doc.Get("Balance"))
+	require.Equal(t, "5000", doc.Get("Limit"))
+	require.Nil(t, doc.Get("Missing"))
+
+	data, err := Encode(doc)
+	require.NoError(t, err)
+
+	decoded, err := Decode(data)
+	require.NoError(t, err)
+
+	var acc account
+	require.NoError(t, decoded.Unmarshal(&acc))
+	require.Zero(t, id.Cmp(acc.Id))
+	require.Zero(t, balance.Cmp(acc.Balance))
+	require.Zero(t, big.NewInt(5000).Cmp(&acc.Limit))
+	require.Nil(t, acc.Missing)
+}
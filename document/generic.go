@@ -0,0 +1,28 @@
+//go:build go1.18
+// +build go1.18
+
+package document
+
+import "reflect"
+
+// GetField retrieves the value of a field as a value of type T. Nested fields can be accessed using dot.
+// Numbers are converted to T if no information is lost (unless TypedGetterMode is NumericStrict), times can be retrieved from (and as) RFC3339 strings and URLs from strings.
+// If the field is missing or its value cannot be converted, the zero value of T and false are returned.
+func GetField[T any](doc *Document, name string) (T, bool) {
+	var zero T
+
+	if !doc.Has(name) {
+		return zero, false
+	}
+
+	v := doc.Get(name)
+	if value, ok := v.(T); ok {
+		return value, true
+	}
+
+	converted, ok := getConverted(v, reflect.TypeOf(zero))
+	if !ok {
+		return zero, false
+	}
+	return converted.(T), true
+}
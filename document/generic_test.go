@@ -0,0 +1,168 @@
+//go:build go1.18
+// +build go1.18
+
+package document
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetField(t *testing.T) {
+	now := time.Now()
+
+	doc := NewDocument()
+	doc.Set("int", 10)
+	doc.Set("float", 10.5)
+	doc.Set("integralFloat", 20.0)
+	doc.Set("string", "hello")
+	doc.Set("bool", true)
+	doc.Set("time", now)
+	doc.Set("timeString", now.Format(time.RFC3339Nano))
+	doc.Set("nested.int", -5)
+
+	i, ok := GetField[int64](doc, "int")
+	require.True(t, ok)
+	require.Equal(t, int64(10), i)
+
+	i, ok = GetField[int64](doc, "nested.int")
+	require.True(t, ok)
+	require.Equal(t, int64(-5), i)
+
+	i, ok = GetField[int64](doc, "integralFloat")
+	require.True(t, ok)
+	require.Equal(t, int64(20), i)
+
+	_, ok = GetField[int64](doc, "float")
+	require.False(t, ok)
+
+	_, ok = GetField[uint64](doc, "nested.int")
+	require.False(t, ok)
+
+	f, ok := GetField[float64](doc, "float")
+	require.True(t, ok)
+	require.Equal(t, 10.5, f)
+
+	f, ok = GetField[float64](doc, "int")
+	require.True(t, ok)
+	require.Equal(t, float64(10), f)
+
+	_, ok = GetField[float64](doc, "string")
+	require.False(t, ok)
+
+	s, ok := GetField[string](doc, "string")
+	require.True(t, ok)
+	require.Equal(t, "hello", s)
+
+	_, ok = GetField[string](doc, "int")
+	require.False(t, ok)
+
+	b, ok := GetField[bool](doc, "bool")
+	require.True(t, ok)
+	require.True(t, b)
+
+	b, ok = GetField[bool](doc, "int")
+	require.False(t, ok)
+	require.False(t, b)
+
+	tm, ok := GetField[time.Time](doc, "time")
+	require.True(t, ok)
+	require.True(t, now.Equal(tm))
+
+	tm, ok = GetField[time.Time](doc, "timeString")
+	require.True(t, ok)
+	require.True(t, now.Equal(tm))
+
+	_, ok = GetField[time.Time](doc, "string")
+	require.False(t, ok)
+
+	s, ok = GetField[string](doc, "time")
+	require.True(t, ok)
+	require.Equal(t, now.Format(time.RFC3339Nano), s)
+
+	i, ok = GetField[int64](doc, "missing")
+	require.False(t, ok)
+	require.Zero(t, i)
+
+	v, ok := GetField[interface{}](doc, "string")
+	require.True(t, ok)
+	require.Equal(t, "hello", v)
+}
+
+func TestGetFieldNumericMode(t *testing.T) {
+	defer SetTypedGetterMode(TypedGetterMode())
+
+	doc := NewDocument()
+	doc.Set("int", 10)
+	doc.Set("integralFloat", 20.0)
+	doc.Set("float", 2.5)
+
+	SetTypedGetterMode(NumericLenient)
+
+	i, ok := GetField[int64](doc, "integralFloat")
+	require.True(t, ok)
+	require.Equal(t, int64(20), i)
+
+	_, ok = GetField[int64](doc, "float")
+	require.False(t, ok)
+
+	f, ok := GetField[float64](doc, "int")
+	require.True(t, ok)
+	require.Equal(t, 10.0, f)
+
+	n, ok := GetField[int](doc, "int")
+	require.True(t, ok)
+	require.Equal(t, 10, n)
+
+	SetTypedGetterMode(NumericStrict)
+
+	i, ok = GetField[int64](doc, "int")
+	require.True(t, ok)
+	require.Equal(t, int64(10), i)
+
+	f, ok = GetField[float64](doc, "float")
+	require.True(t, ok)
+	require.Equal(t, 2.5, f)
+
+	_, ok = GetField[int64](doc, "integralFloat")
+	require.False(t, ok)
+
+	_, ok = GetField[int64](doc, "float")
+	require.False(t, ok)
+
+	_, ok = GetField[float64](doc, "int")
+	require.False(t, ok)
+
+	_, ok = GetField[int](doc, "int")
+	require.False(t, ok)
+}
+
+type host struct {
+	Name string
+	Addr netip.Addr
+	Prev *netip.Addr
+}
+
+func TestDocumentTextMarshaler(t *testing.T) {
+	addr := netip.MustParseAddr("192.168.1.10")
+	prev := netip.MustParseAddr("2001:db8::1")
+
+	doc := NewDocumentOf(host{Name: "server", Addr: addr, Prev: &prev})
+	require.Equal(t, "192.168.1.10", doc.Get("Addr"))
+	require.Equal(t, "2001:db8::1", doc.Get("Prev"))
+
+	var h host
+	require.NoError(t, doc.Unmarshal(&h))
+	require.Equal(t, addr, h.Addr)
+	require.Equal(t, prev, *h.Prev)
+
+	var scanned netip.Addr
+	require.NoError(t, doc.ScanFields(map[string]interface{}{"Addr": &scanned}))
+	require.Equal(t, addr, scanned)
+
+	doc.Set("Addr", "not an address")
+	require.Error(t, doc.ScanFields(map[string]interface{}{"Addr": &scanned}))
+}
@@ -0,0 +1,160 @@
+package document
+
+import (
+	"github.com/ostafen/clover/v2/internal"
+	"github.com/ostafen/clover/v2/util"
+)
+
+// ArrayMergeStrategy computes the result of merging the src array into the dst one.
+type ArrayMergeStrategy func(dst, src []interface{}) []interface{}
+
+// ReplaceArrays is the default ArrayMergeStrategy, which replaces the dst array with the src one.
+func ReplaceArrays(dst, src []interface{}) []interface{} {
+	return src
+}
+
+// ConcatArrays is an ArrayMergeStrategy which appends the elements of src to the dst array.
+func ConcatArrays(dst, src []interface{}) []interface{} {
+	res := make([]interface{}, 0, len(dst)+len(src))
+	res = append(res, dst...)
+	return append(res, src...)
+}
+
+// UnionArrays is an ArrayMergeStrategy treating arrays as sets: the result contains each distinct element of dst and src once,
+// in order of first occurrence. Elements are compared by value, thus numbers of different types are equal if their values are.
+func UnionArrays(dst, src []interface{}) []interface{} {
+	res := make([]interface{}, 0, len(dst)+len(src))
+	for _, elem := range append(append([]interface{}{}, dst...), src...) {
+		if indexOfValue(res, elem) < 0 {
+			res = append(res, elem)
+		}
+	}
+	return res
+}
+
+func indexOfValue(s []interface{}, value interface{}) int {
+	for i, elem := range s {
+		if internal.Compare(elem, value) == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// MergeArraysByKey returns an ArrayMergeStrategy for arrays of objects, which are matched using the value of their keyField.
+// Each object of src is merged (as by MergeWith) into the object of dst having the same key, if any, and appended otherwise.
+// Elements lacking the key field are kept if they belong to dst, and appended if they belong to src.
+func MergeArraysByKey(keyField string) ArrayMergeStrategy {
+	return func(dst, src []interface{}) []interface{} {
+		res := append(make([]interface{}, 0, len(dst)+len(src)), dst...)
+		for _, elem := range src {
+			if i := indexOfKey(res, keyField, elem); i >= 0 {
+				res[i] = mergeMaps(util.DeepCopyMap(res[i].(map[string]interface{})), elem.(map[string]interface{}), "", nil)
+				continue
+			}
+			res = append(res, elem)
+		}
+		return res
+	}
+}
+
+func indexOfKey(s []interface{}, keyField string, elem interface{}) int {
+	m, isMap := elem.(map[string]interface{})
+	if !isMap {
+		return -1
+	}
+
+	key, hasKey := m[keyField]
+	if !hasKey {
+		return -1
+	}
+
+	for i, other := range s {
+		otherMap, isMap := other.(map[string]interface{})
+		if !isMap {
+			continue
+		}
+
+		if otherKey, hasKey := otherMap[keyField]; hasKey && internal.Compare(key, otherKey) == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// MergeOption customizes the behaviour of MergeWith.
+type MergeOption func(strategies map[string]ArrayMergeStrategy)
+
+// MergeArrays makes MergeWith use the supplied strategy for the array located at path (in dot notation).
+func MergeArrays(path string, strategy ArrayMergeStrategy) MergeOption {
+	return func(strategies map[string]ArrayMergeStrategy) {
+		strategies[path] = strategy
+	}
+}
+
+// MergeWith merges the fields of other into the document. Nested objects are merged recursively,
+// while any other value of other replaces the corresponding one of the document.
+// Arrays are replaced as well, unless a different strategy is configured for their path through MergeArrays.
+// The document shares no values with other after the merge.
+func (doc *Document) MergeWith(other *Document, opts ...MergeOption) {
+	strategies := make(map[string]ArrayMergeStrategy)
+	for _, opt := range opts {
+		opt(strategies)
+	}
+
+	doc.beforeWrite("")
+	doc.fields = mergeMaps(doc.fields, other.fields, "", strategies)
+}
+
+// Merge copies the fields of other into the document, merging nested objects recursively.
+// If overwrite is true, it behaves as MergeWith without options. Otherwise, the values of the document are preserved,
+// and only the fields it does not have are copied, at any level of nesting.
+func (doc *Document) Merge(other *Document, overwrite bool) {
+	if overwrite {
+		doc.MergeWith(other)
+		return
+	}
+
+	doc.beforeWrite("")
+	doc.fields = fillMaps(doc.fields, other.fields)
+}
+
+// fillMaps copies the fields of src missing from dst into dst, recursing into the objects held by both maps.
+func fillMaps(dst, src map[string]interface{}) map[string]interface{} {
+	for key, srcValue := range src {
+		dstValue, exists := dst[key]
+		if !exists {
+			dst[key] = util.DeepCopyValue(srcValue)
+			continue
+		}
+
+		dstMap, dstIsMap := dstValue.(map[string]interface{})
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		if dstIsMap && srcIsMap {
+			dst[key] = fillMaps(dstMap, srcMap)
+		}
+	}
+	return dst
+}
+
+func mergeMaps(dst, src map[string]interface{}, prefix string, strategies map[string]ArrayMergeStrategy) map[string]interface{} {
+	for key, srcValue := range src {
+		path := joinPath(prefix, key)
+
+		switch srcType := srcValue.(type) {
+		case map[string]interface{}:
+			if dstMap, isMap := dst[key].(map[string]interface{}); isMap {
+				dst[key] = mergeMaps(dstMap, srcType, path, strategies)
+				continue
+			}
+		case []interface{}:
+			dstSlice, isSlice := dst[key].([]interface{})
+			if strategy := strategies[path]; isSlice && strategy != nil {
+				dst[key] = strategy(dstSlice, util.DeepCopyValue(srcType).([]interface{}))
+				continue
+			}
+		}
+		dst[key] = util.DeepCopyValue(srcValue)
+	}
+	return dst
+}
@@ -0,0 +1,376 @@
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ostafen/clover/v2/internal"
+	"github.com/ostafen/clover/v2/util"
+)
+
+// ErrPatchTestFailed is returned by ApplyJSONPatch when the value of a "test" operation does not match.
+var ErrPatchTestFailed = errors.New("json patch test failed")
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ApplyJSONPatch applies a JSON Patch (RFC 6902) to the document, supporting the add, remove, replace, move, copy and test operations.
+// Paths are JSON Pointers (RFC 6901), whose segments select either object fields or, by their index, array elements.
+// The patch is applied atomically: if any operation fails, the document is left unchanged.
+func (doc *Document) ApplyJSONPatch(patch []byte) error {
+	var ops []patchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return err
+	}
+
+	var root interface{} = util.DeepCopyMap(doc.fields)
+	for i, op := range ops {
+		var err error
+		root, err = applyPatchOperation(root, &op)
+		if err != nil {
+			return fmt.Errorf("json patch operation %d (%s): %w", i, op.Op, err)
+		}
+	}
+
+	fields, isMap := root.(map[string]interface{})
+	if !isMap {
+		return fmt.Errorf("json patch: document root must be an object")
+	}
+
+	doc.fields = fields
+	doc.shared = false
+	doc.owned = nil
+	doc.compacted = false
+	return nil
+}
+
+// GetPointer returns the value located by the supplied JSON Pointer (RFC 6901), and whether such a value exists.
+// The empty pointer refers to the whole document.
+func (doc *Document) GetPointer(ptr string) (interface{}, bool) {
+	path, err := parsePointer(ptr)
+	if err != nil {
+		return nil, false
+	}
+
+	value, err := getValue(doc.fields, path)
+	return value, err == nil
+}
+
+// SetPointer sets the value located by the supplied JSON Pointer (RFC 6901), creating the last segment of the path if it does not exist.
+// Array elements can be replaced by their index, while the "-" segment appends a new element.
+// The empty pointer replaces the whole document, thus its value must be an object.
+func (doc *Document) SetPointer(ptr string, value interface{}) error {
+	path, err := parsePointer(ptr)
+	if err != nil {
+		return err
+	}
+
+	normalized, err := internal.Normalize(value)
+	if err != nil {
+		return err
+	}
+
+	if len(path) == 0 {
+		fields, isMap := normalized.(map[string]interface{})
+		if !isMap {
+			return fmt.Errorf("document root must be an object")
+		}
+
+		doc.fields = fields
+		doc.shared = false
+		doc.owned = nil
+		doc.compacted = false
+		return nil
+	}
+
+	doc.beforeWrite("")
+
+	_, err = updateParent(doc.fields, path, func(parent interface{}, key string) (interface{}, error) {
+		switch parentType := parent.(type) {
+		case map[string]interface{}:
+			parentType[key] = normalized
+			return parentType, nil
+		case []interface{}:
+			i, err := parseArrayIndex(key, len(parentType), true)
+			if err != nil {
+				return nil, err
+			}
+
+			if i == len(parentType) {
+				return append(parentType, normalized), nil
+			}
+			parentType[i] = normalized
+			return parentType, nil
+		}
+		return nil, fmt.Errorf("cannot set %q on a value which is neither an object nor an array", key)
+	})
+	return err
+}
+
+func applyPatchOperation(root interface{}, op *patchOperation) (interface{}, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("missing path")
+	}
+
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		value, err := decodePatchValue(op.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op.Op {
+		case "add":
+			return addValue(root, path, value)
+		case "replace":
+			return replaceValue(root, path, value)
+		}
+
+		current, err := getValue(root, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if internal.Compare(current, value) != 0 {
+			return nil, fmt.Errorf("%w at path %q", ErrPatchTestFailed, *op.Path)
+		}
+		return root, nil
+	case "remove":
+		return removeValue(root, path)
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("missing from")
+		}
+
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := getValue(root, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "copy" {
+			return addValue(root, path, util.DeepCopyValue(value))
+		}
+
+		if isPathPrefix(from, path) && len(from) < len(path) {
+			return nil, fmt.Errorf("cannot move %q into one of its children", *op.From)
+		}
+
+		root, err = removeValue(root, from)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(root, path, value)
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// parsePointer splits a JSON Pointer into its unescaped segments.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid json pointer %q", pointer)
+	}
+
+	segments := strings.Split(pointer[1:], "/")
+	for i, s := range segments {
+		segments[i] = strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+	}
+	return segments, nil
+}
+
+func isPathPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// decodePatchValue decodes a JSON value, keeping integral numbers as int64 like the rest of the document.
+func decodePatchValue(data json.RawMessage) (interface{}, error) {
+	if data == nil {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return internal.Normalize(value)
+}
+
+func parseArrayIndex(key string, length int, allowEnd bool) (int, error) {
+	if allowEnd && key == "-" {
+		return length, nil
+	}
+
+	if key == "" || (len(key) > 1 && key[0] == '0') {
+		return -1, fmt.Errorf("invalid array index %q", key)
+	}
+
+	i, err := strconv.Atoi(key)
+	if err != nil || i < 0 {
+		return -1, fmt.Errorf("invalid array index %q", key)
+	}
+
+	if i > length || (i == length && !allowEnd) {
+		return -1, fmt.Errorf("array index %d out of bounds", i)
+	}
+	return i, nil
+}
+
+func getChild(node interface{}, key string) (interface{}, error) {
+	switch nodeType := node.(type) {
+	case map[string]interface{}:
+		value, exists := nodeType[key]
+		if !exists {
+			return nil, fmt.Errorf("field %q does not exist", key)
+		}
+		return value, nil
+	case []interface{}:
+		i, err := parseArrayIndex(key, len(nodeType), false)
+		if err != nil {
+			return nil, err
+		}
+		return nodeType[i], nil
+	}
+	return nil, fmt.Errorf("cannot select %q from a value which is neither an object nor an array", key)
+}
+
+func getValue(root interface{}, path []string) (interface{}, error) {
+	node := root
+	for _, key := range path {
+		var err error
+		node, err = getChild(node, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+// updateParent applies update to the container holding the last segment of path, and returns the updated root.
+// Since arrays may be resized by the update, each container is stored back into its own parent.
+func updateParent(root interface{}, path []string, update func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return update(root, path[0])
+	}
+
+	child, err := getChild(root, path[0])
+	if err != nil {
+		return nil, err
+	}
+
+	newChild, err := updateParent(child, path[1:], update)
+	if err != nil {
+		return nil, err
+	}
+
+	switch rootType := root.(type) {
+	case map[string]interface{}:
+		rootType[path[0]] = newChild
+	case []interface{}:
+		i, _ := parseArrayIndex(path[0], len(rootType), false)
+		rootType[i] = newChild
+	}
+	return root, nil
+}
+
+func addValue(root interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return updateParent(root, path, func(parent interface{}, key string) (interface{}, error) {
+		switch parentType := parent.(type) {
+		case map[string]interface{}:
+			parentType[key] = value
+			return parentType, nil
+		case []interface{}:
+			i, err := parseArrayIndex(key, len(parentType), true)
+			if err != nil {
+				return nil, err
+			}
+
+			res := make([]interface{}, 0, len(parentType)+1)
+			res = append(res, parentType[:i]...)
+			res = append(res, value)
+			return append(res, parentType[i:]...), nil
+		}
+		return nil, fmt.Errorf("cannot add %q to a value which is neither an object nor an array", key)
+	})
+}
+
+func removeValue(root interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the document root")
+	}
+
+	return updateParent(root, path, func(parent interface{}, key string) (interface{}, error) {
+		if _, err := getChild(parent, key); err != nil {
+			return nil, err
+		}
+
+		switch parentType := parent.(type) {
+		case map[string]interface{}:
+			delete(parentType, key)
+			return parentType, nil
+		case []interface{}:
+			i, _ := parseArrayIndex(key, len(parentType), false)
+			res := make([]interface{}, 0, len(parentType)-1)
+			res = append(res, parentType[:i]...)
+			return append(res, parentType[i+1:]...), nil
+		}
+		return parent, nil
+	})
+}
+
+func replaceValue(root interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return updateParent(root, path, func(parent interface{}, key string) (interface{}, error) {
+		if _, err := getChild(parent, key); err != nil {
+			return nil, err
+		}
+
+		switch parentType := parent.(type) {
+		case map[string]interface{}:
+			parentType[key] = value
+		case []interface{}:
+			i, _ := parseArrayIndex(key, len(parentType), false)
+			parentType[i] = value
+		}
+		return parent, nil
+	})
+}
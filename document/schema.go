@@ -0,0 +1,102 @@
+package document
+
+import (
+	"time"
+)
+
+// FieldStats describes the values observed for a field across a set of documents.
+type FieldStats struct {
+	// Count is the number of documents containing the field.
+	Count int
+	// Total is the number of analyzed documents.
+	Total int
+	// Types maps the name of each observed type (see TypeName) to the number of documents holding a value of that type.
+	Types map[string]int
+}
+
+// Presence returns the fraction of the analyzed documents which contain the field.
+func (s FieldStats) Presence() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Count) / float64(s.Total)
+}
+
+// TypeRatio returns the fraction of the values of the field having the supplied type.
+func (s FieldStats) TypeRatio(typeName string) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Types[typeName]) / float64(s.Count)
+}
+
+// TypeName returns the name of the type of a normalized value, as reported by AnalyzeSchema.
+func TypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case int64:
+		return "int64"
+	case uint64:
+		return "uint64"
+	case float64:
+		return "float64"
+	case string:
+		return "string"
+	case time.Time:
+		return "time"
+	case []byte:
+		return "bytes"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+// AnalyzeSchema reports, for each field path (in dot notation), the types observed across the documents supplied by forEach.
+// The forEach function must call consumer on each document, stopping as soon as it returns false, like DB.ForEach does.
+// Nested objects are analyzed recursively, while arrays are reported as a whole.
+// Documents are processed one at a time, so that memory usage only depends on the number of distinct paths.
+func AnalyzeSchema(forEach func(consumer func(doc *Document) bool) error) (map[string]FieldStats, error) {
+	stats := make(map[string]*FieldStats)
+	total := 0
+
+	err := forEach(func(doc *Document) bool {
+		total++
+		analyzeFields(doc.fields, "", stats)
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]FieldStats, len(stats))
+	for path, s := range stats {
+		s.Total = total
+		res[path] = *s
+	}
+	return res, nil
+}
+
+func analyzeFields(fields map[string]interface{}, prefix string, stats map[string]*FieldStats) {
+	for key, value := range fields {
+		path := joinPath(prefix, key)
+
+		s := stats[path]
+		if s == nil {
+			s = &FieldStats{Types: make(map[string]int)}
+			stats[path] = s
+		}
+		s.Count++
+		s.Types[TypeName(value)]++
+
+		if m, isMap := value.(map[string]interface{}); isMap {
+			analyzeFields(m, path, stats)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// AggregateFunc is a function computing a single result from the values of an index.
+type AggregateFunc int
+
+const (
+	AggSum AggregateFunc = iota
+	AggAvg
+	AggMin
+	AggMax
+)
+
+var (
+	ErrInvalidAggregateFunc = errors.New("invalid aggregate function")
+	ErrNotNumeric           = errors.New("indexed value is not numeric")
+)
+
+// Aggregate computes agg over the values of the index, which are read from the index entries without fetching the documents.
+// Each entry is taken into account, thus a document is counted once per value if its field crosses an array of objects.
+// Arrays are aggregated through the entries of their elements, while the entries holding them as a whole are skipped.
+// Nil values are ignored, while any other non numeric value causes an ErrNotNumeric error.
+// If there are no values, the sum is zero and the other functions return NaN.
+func (idx *badgerRangeIndex) Aggregate(agg AggregateFunc) (float64, error) {
+	defer idx.lock()()
+
+	if agg < AggSum || agg > AggMax {
+		return 0, ErrInvalidAggregateFunc
+	}
+
+	it := idx.txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	sum, count := 0.0, 0
+	min, max := math.Inf(1), math.Inf(-1)
+
+	prefix := idx.getKeyPrefix()
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		value, err := decodeEntryValue(it.Item())
+		if err != nil {
+			return 0, err
+		}
+
+		if _, isArray := value.([]interface{}); value == nil || isArray {
+			continue
+		}
+
+		x, err := toFloat64(value)
+		if err != nil {
+			return 0, err
+		}
+
+		sum += x
+		count++
+		min = math.Min(min, x)
+		max = math.Max(max, x)
+	}
+
+	if agg == AggSum {
+		return sum, nil
+	}
+
+	if count == 0 {
+		return math.NaN(), nil
+	}
+
+	switch agg {
+	case AggAvg:
+		return sum / float64(count), nil
+	case AggMin:
+		return min, nil
+	}
+	return max, nil
+}
+
+func toFloat64(value interface{}) (float64, error) {
+	switch vType := value.(type) {
+	case int64:
+		return float64(vType), nil
+	case uint64:
+		return float64(vType), nil
+	case float64:
+		return vType, nil
+	}
+	return 0, fmt.Errorf("%w: %T", ErrNotNumeric, value)
+}
@@ -0,0 +1,116 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// Batch accumulates updates to an index, writing them through as few transactions as possible,
+// which is much faster than using a separate transaction for each update when loading or updating many documents.
+// Updates are grouped within a transaction until it reaches the size limits of badger: the group is then committed atomically,
+// and the next updates go to a new transaction. Thus a batch is atomic per group of updates rather than as a whole:
+// if an update (or Commit) fails, the pending group is discarded, while the groups already committed are kept,
+// and it is up to the caller to undo them (for example, by dropping the index being built).
+// A Batch must be used by one goroutine at a time.
+type Batch struct {
+	db         *badger.DB
+	collection string
+	info       IndexInfo
+
+	txn     *badger.Txn
+	idx     Index
+	pending []func(idx Index) error // the updates of the current group, which are not committed yet
+
+	wrap func(idx Index) Index // wraps the index of each transaction, allowing tests to inject failures
+}
+
+// BeginBatch starts a batch of updates to the index described by info.
+func BeginBatch(db *badger.DB, collection string, info IndexInfo) (*Batch, error) {
+	b := &Batch{db: db, collection: collection, info: info}
+	if err := b.begin(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *Batch) begin() error {
+	txn := b.db.NewTransaction(true)
+
+	idx := CreateBadgerIndexWithInfo(b.collection, b.info, txn)
+	if idx == nil {
+		txn.Discard()
+		return fmt.Errorf("invalid index type: %d", b.info.Type)
+	}
+
+	if b.wrap != nil {
+		idx = b.wrap(idx)
+	}
+	b.txn, b.idx = txn, idx
+	return nil
+}
+
+// Add adds an entry for the document with the given id to the index, as Index.Add does.
+func (b *Batch) Add(docId string, v interface{}, ttl time.Duration) error {
+	return b.apply(func(idx Index) error {
+		return idx.Add(docId, v, ttl)
+	})
+}
+
+// Remove removes the entry of the document with the given id from the index, as Index.Remove does.
+func (b *Batch) Remove(docId string, v interface{}) error {
+	return b.apply(func(idx Index) error {
+		return idx.Remove(docId, v)
+	})
+}
+
+func (b *Batch) apply(update func(idx Index) error) error {
+	err := update(b.idx)
+	if errors.Is(err, badger.ErrTxnTooBig) && len(b.pending) > 0 {
+		// the update may have been partially written to the transaction, which cannot be committed as is
+		if err = b.flush(); err == nil {
+			err = update(b.idx)
+		}
+	}
+
+	if err != nil {
+		b.Discard()
+		return err
+	}
+	b.pending = append(b.pending, update)
+	return nil
+}
+
+// flush discards the current transaction, commits the pending updates through a new one and starts the next group.
+func (b *Batch) flush() error {
+	b.txn.Discard()
+	if err := b.begin(); err != nil {
+		return err
+	}
+
+	for _, update := range b.pending {
+		if err := update(b.idx); err != nil {
+			return err
+		}
+	}
+
+	if err := b.txn.Commit(); err != nil {
+		return err
+	}
+	b.pending = b.pending[:0]
+	return b.begin()
+}
+
+// Commit writes the updates of the last group. The batch cannot be used after the call.
+func (b *Batch) Commit() error {
+	b.pending = nil
+	return b.txn.Commit()
+}
+
+// Discard drops the updates of the current group. The batch cannot be used after the call.
+func (b *Batch) Discard() {
+	b.pending = nil
+	b.txn.Discard()
+}
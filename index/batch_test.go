@@ -0,0 +1,183 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestDB(t testing.TB) *badger.DB {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLoggingLevel(badger.ERROR))
+	require.NoError(t, err)
+	return db
+}
+
+// limitedIndex simulates the size limits of badger transactions, failing with badger.ErrTxnTooBig
+// once maxUpdates updates have been applied. Failing updates are still written, as updates writing several keys may be.
+type limitedIndex struct {
+	Index
+	updates    *int
+	maxUpdates int
+}
+
+func (idx *limitedIndex) update(write func() error) error {
+	if err := write(); err != nil {
+		return err
+	}
+
+	*idx.updates++
+	if *idx.updates > idx.maxUpdates {
+		return badger.ErrTxnTooBig
+	}
+	return nil
+}
+
+func (idx *limitedIndex) Add(docId string, v interface{}, ttl time.Duration) error {
+	return idx.update(func() error { return idx.Index.Add(docId, v, ttl) })
+}
+
+func (idx *limitedIndex) Remove(docId string, v interface{}) error {
+	return idx.update(func() error { return idx.Index.Remove(docId, v) })
+}
+
+// beginLimitedBatch starts a batch whose transactions are limited to maxUpdates updates, returning the number of started transactions.
+func beginLimitedBatch(t *testing.T, db *badger.DB, info IndexInfo, maxUpdates int) (*Batch, *int) {
+	batch, err := BeginBatch(db, "test", info)
+	require.NoError(t, err)
+
+	txns := 0
+	batch.wrap = func(idx Index) Index {
+		txns++
+		return &limitedIndex{Index: idx, updates: new(int), maxUpdates: maxUpdates}
+	}
+	batch.Discard()
+	require.NoError(t, batch.begin())
+	return batch, &txns
+}
+
+func countEntries(t *testing.T, db *badger.DB, info IndexInfo) int {
+	n := 0
+	err := db.View(func(txn *badger.Txn) error {
+		return CreateBadgerIndexWithInfo("test", info, txn).Iterate(false, func(docId string) error {
+			n++
+			return nil
+		})
+	})
+	require.NoError(t, err)
+	return n
+}
+
+func batchDocId(i int) string {
+	return fmt.Sprintf("doc-%06d", i)
+}
+
+func TestBatch(t *testing.T) {
+	db := openTestDB(t)
+	defer func() {
+		require.NoError(t, db.Close())
+	}()
+
+	info := IndexInfo{Field: "field", Type: IndexSingleField}
+
+	batch, txns := beginLimitedBatch(t, db, info, 100)
+
+	n := 1000
+	for i := 0; i < n; i++ {
+		require.NoError(t, batch.Add(batchDocId(i), int64(i), time.Duration(-1)))
+	}
+	require.NoError(t, batch.Commit())
+	require.Equal(t, n, countEntries(t, db, info))
+	require.Greater(t, *txns, n/100) // the batch was split over multiple transactions
+
+	batch, _ = beginLimitedBatch(t, db, info, 100)
+	for i := 0; i < n; i += 2 {
+		require.NoError(t, batch.Remove(batchDocId(i), int64(i)))
+	}
+	require.NoError(t, batch.Commit())
+	require.Equal(t, n/2, countEntries(t, db, info))
+
+	err := db.View(func(txn *badger.Txn) error {
+		i := 1
+		return CreateBadgerIndexWithInfo("test", info, txn).Iterate(false, func(docId string) error {
+			require.Equal(t, batchDocId(i), docId)
+			i += 2
+			return nil
+		})
+	})
+	require.NoError(t, err)
+}
+
+func TestBatchRollback(t *testing.T) {
+	db := openTestDB(t)
+	defer func() {
+		require.NoError(t, db.Close())
+	}()
+
+	info := IndexInfo{Field: "field", Type: IndexHash}
+
+	batch, err := BeginBatch(db, "test", info)
+	require.NoError(t, err)
+
+	require.NoError(t, batch.Add(batchDocId(0), "a", time.Duration(-1)))
+	require.NoError(t, batch.Add(batchDocId(1), "b", time.Duration(-1)))
+	require.Error(t, batch.Add(batchDocId(2), make(chan int), time.Duration(-1)))
+
+	require.Error(t, batch.Commit())
+	require.Zero(t, countEntries(t, db, info))
+
+	// a failure while committing a group fails the batch, keeping the groups already committed
+	batch, _ = beginLimitedBatch(t, db, info, 2)
+	require.NoError(t, batch.Add(batchDocId(0), "a", time.Duration(-1)))
+	require.NoError(t, batch.Add(batchDocId(1), "b", time.Duration(-1)))
+	require.NoError(t, batch.Add(batchDocId(2), "c", time.Duration(-1))) // commits the first group
+	require.NoError(t, batch.Add(batchDocId(3), "d", time.Duration(-1)))
+
+	batch.wrap = func(idx Index) Index {
+		return &limitedIndex{Index: idx, updates: new(int), maxUpdates: 0}
+	}
+	require.ErrorIs(t, batch.Add(batchDocId(4), "e", time.Duration(-1)), badger.ErrTxnTooBig)
+	require.Equal(t, 2, countEntries(t, db, info))
+
+	_, err = BeginBatch(db, "test", IndexInfo{Field: "field", Type: IndexType(100)})
+	require.Error(t, err)
+}
+
+func benchmarkIndexWrites(b *testing.B, batched bool) {
+	db := openTestDB(b)
+	defer db.Close()
+
+	info := IndexInfo{Field: "field", Type: IndexSingleField}
+	n := 1000
+
+	b.ResetTimer()
+	for k := 0; k < b.N; k++ {
+		if batched {
+			batch, err := BeginBatch(db, "test", info)
+			require.NoError(b, err)
+
+			for i := 0; i < n; i++ {
+				require.NoError(b, batch.Add(batchDocId(i), int64(k*n+i), time.Duration(-1)))
+			}
+			require.NoError(b, batch.Commit())
+			continue
+		}
+
+		for i := 0; i < n; i++ {
+			err := db.Update(func(txn *badger.Txn) error {
+				return CreateBadgerIndexWithInfo("test", info, txn).Add(batchDocId(i), int64(k*n+i), time.Duration(-1))
+			})
+			require.NoError(b, err)
+		}
+	}
+}
+
+func BenchmarkIndexPerEntryWrites(b *testing.B) {
+	benchmarkIndexWrites(b, false)
+}
+
+func BenchmarkIndexBatchWrites(b *testing.B) {
+	benchmarkIndexWrites(b, true)
+}
@@ -0,0 +1,294 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ostafen/clover/v2/internal"
+)
+
+// ErrMissingLeadingField is returned when adding to a compound index a document which lacks the first indexed field.
+var ErrMissingLeadingField = errors.New("document is missing the leading field of the compound index")
+
+// ErrParallelArrays is returned when adding to a compound index a document holding arrays in more than one indexed field,
+// whose entries would be as many as the combinations of their elements.
+var ErrParallelArrays = errors.New("compound index cannot index more than one array field")
+
+// CompoundValue holds the values of the fields of a compound index for a document, in the order of the fields.
+// Fields missing from the document are represented by MissingValue.
+type CompoundValue []interface{}
+
+type missingValue struct{}
+
+// MissingValue marks a field of a CompoundValue which is missing from the document.
+// Missing fields other than the leading one are indexed as null.
+var MissingValue interface{} = missingValue{}
+
+// CompoundIndexInfo returns the definition of a compound index on the supplied fields.
+// Its Field is the comma separated list of the fields, which identifies the index within the collection.
+func CompoundIndexInfo(fields ...string) IndexInfo {
+	return IndexInfo{
+		Field:  strings.Join(fields, ","),
+		Type:   IndexCompound,
+		Fields: fields,
+	}
+}
+
+// CompoundIndex is an index on multiple fields, whose entries are ordered by the values of the first field,
+// then by the values of the second field, and so on.
+type CompoundIndex interface {
+	Index
+	Fields() []string
+	IteratePrefix(values []interface{}, reverse bool, onValue func(docId string) error) error
+}
+
+// CompoundIndexQuery selects the entries of a compound index whose leading fields are equal to Prefix, ordered by the remaining fields.
+type CompoundIndexQuery struct {
+	Prefix  []interface{}
+	Reverse bool
+	Idx     CompoundIndex
+}
+
+func (q *CompoundIndexQuery) Run(onValue func(docId string) error) error {
+	return q.Idx.IteratePrefix(q.Prefix, q.Reverse, onValue)
+}
+
+type badgerCompoundIndex struct {
+	indexBase
+	txn *badger.Txn
+}
+
+func (idx *badgerCompoundIndex) Fields() []string {
+	return idx.info.Fields
+}
+
+func (idx *badgerCompoundIndex) getKeyPrefix() []byte {
+	return []byte(fmt.Sprintf("c:%s;x:%s;", idx.collection, idx.Field()))
+}
+
+// getMultikeyKey returns the key of the marker written when one of the fields of an indexed document is an array (see MultikeyIndex).
+func (idx *badgerCompoundIndex) getMultikeyKey() []byte {
+	return []byte(fmt.Sprintf("c:%s;xm:%s;", idx.collection, idx.Field()))
+}
+
+// getKey returns the prefix of the keys of the entries whose leading fields are equal to values.
+func (idx *badgerCompoundIndex) getKey(values []interface{}) ([]byte, error) {
+	keyValues := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		if v == MissingValue {
+			v = nil
+		}
+
+		keyValue, err := idx.keyValue(v)
+		if err != nil {
+			return nil, err
+		}
+		keyValues = append(keyValues, keyValue)
+	}
+	return internal.OrderedCodeTuple(idx.getKeyPrefix(), keyValues)
+}
+
+// entryKeys returns the keys of the entries of the document, or nil if the document must not be indexed.
+// As for range indexes, an array field is indexed both as a whole and once per element, which yields one entry for each of them.
+func (idx *badgerCompoundIndex) entryKeys(docId string, v interface{}) ([][]byte, error) {
+	values, isCompound := v.(CompoundValue)
+	if !isCompound || len(values) != len(idx.info.Fields) {
+		return nil, fmt.Errorf("compound index on %s requires a CompoundValue of %d values", idx.Field(), len(idx.info.Fields))
+	}
+
+	if values[0] == MissingValue {
+		return nil, nil
+	}
+
+	arrayPos := -1
+	for i, value := range values {
+		if _, isArray := value.([]interface{}); isArray {
+			if arrayPos >= 0 {
+				return nil, fmt.Errorf("%w: %s and %s", ErrParallelArrays, idx.info.Fields[arrayPos], idx.info.Fields[i])
+			}
+			arrayPos = i
+		}
+	}
+
+	tuples := []CompoundValue{values}
+	if arrayPos >= 0 {
+		for _, elem := range values[arrayPos].([]interface{}) {
+			tuple := append(CompoundValue{}, values...)
+			tuple[arrayPos] = elem
+			tuples = append(tuples, tuple)
+		}
+	}
+
+	keys := make([][]byte, 0, len(tuples))
+	for _, tuple := range tuples {
+		key, err := idx.getKey(tuple)
+		if err != nil {
+			return nil, err
+		}
+		key, err = appendDocId(key, docId)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (idx *badgerCompoundIndex) Add(docId string, v interface{}, ttl time.Duration) error {
+	defer idx.lock()()
+
+	if ttl == 0 {
+		return nil
+	}
+
+	keys, err := idx.entryKeys(docId, v)
+	if err != nil {
+		return err
+	}
+
+	if keys == nil {
+		return fmt.Errorf("%w: %s", ErrMissingLeadingField, idx.info.Fields[0])
+	}
+
+	// the document has several entries when one of its fields is a non-empty array
+	if len(keys) > 1 {
+		if err := setMultikey(idx.txn, idx.getMultikeyKey()); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range keys {
+		e := badger.NewEntry(key, nil)
+		if ttl > 0 {
+			e = e.WithTTL(ttl)
+		}
+
+		if err := idx.txn.SetEntry(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (idx *badgerCompoundIndex) Remove(docId string, v interface{}) error {
+	defer idx.lock()()
+
+	keys, err := idx.entryKeys(docId, v) // documents missing the leading field cannot have been indexed
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := idx.txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IteratePrefix invokes onValue for each entry whose leading fields are equal to values, in order of the remaining fields.
+// An empty list of values selects all the entries of the index.
+func (idx *badgerCompoundIndex) IteratePrefix(values []interface{}, reverse bool, onValue func(docId string) error) error {
+	defer idx.lock()()
+
+	if len(values) > len(idx.info.Fields) {
+		return fmt.Errorf("compound index on %s has only %d fields", idx.Field(), len(idx.info.Fields))
+	}
+
+	prefix, err := idx.getKey(values)
+	if err != nil {
+		return err
+	}
+	return idx.iteratePrefix(prefix, reverse, onValue)
+}
+
+func (idx *badgerCompoundIndex) iteratePrefix(prefix []byte, reverse bool, onValue func(docId string) error) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Reverse = reverse
+
+	it := idx.txn.NewIterator(opts)
+	defer it.Close()
+
+	seekPrefix := prefix
+	if reverse {
+		seekPrefix = append(append([]byte{}, prefix...), 255)
+	}
+
+	for it.Seek(seekPrefix); it.ValidForPrefix(prefix); it.Next() {
+		_, docId, err := extractDocId(it.Item().Key())
+		if err != nil {
+			return err
+		}
+
+		if err := onValue(string(docId)); err != nil {
+			if err == internal.ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Iterate invokes onValue for each entry of the index, in lexicographic order of the values of the indexed fields.
+func (idx *badgerCompoundIndex) Iterate(reverse bool, onValue func(docId string) error) error {
+	defer idx.lock()()
+
+	return idx.iteratePrefix(idx.getKeyPrefix(), reverse, onValue)
+}
+
+// ContainsDoc reports whether the index contains an entry for the document with the given id.
+// Since entries are ordered by the values of the indexed fields, all the index keys are scanned.
+func (idx *badgerCompoundIndex) ContainsDoc(docId string) (bool, error) {
+	defer idx.lock()()
+
+	return containsDoc(idx.txn, idx.getKeyPrefix(), docId)
+}
+
+// RemoveByDoc removes all the entries of the document with the given id, which may be several if one of the fields holds an array.
+// The whole index is scanned, since entries are ordered by the values of the indexed fields.
+func (idx *badgerCompoundIndex) RemoveByDoc(docId string) error {
+	defer idx.lock()()
+
+	return removeDocEntries(idx.txn, idx.getKeyPrefix(), docId)
+}
+
+func (idx *badgerCompoundIndex) Drop() error {
+	defer idx.lock()()
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := idx.txn.NewIterator(opts)
+	defer it.Close()
+
+	prefix := idx.getKeyPrefix()
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		if err := idx.txn.Delete(it.Item().KeyCopy(nil)); err != nil {
+			return err
+		}
+	}
+	return idx.txn.Delete(idx.getMultikeyKey())
+}
+
+// Multikey reports whether the index has ever indexed a document having an array field (see MultikeyIndex).
+func (idx *badgerCompoundIndex) Multikey() (bool, error) {
+	defer idx.lock()()
+
+	return hasMultikeyMarker(idx.txn, idx.getMultikeyKey())
+}
+
+// Stats returns the statistics of the entries of the index.
+func (idx *badgerCompoundIndex) Stats() (IndexStats, error) {
+	defer idx.lock()()
+
+	return scanStats(idx.txn, idx.getKeyPrefix())
+}
+
+func (idx *badgerCompoundIndex) Type() IndexType {
+	return IndexCompound
+}
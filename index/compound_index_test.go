@@ -0,0 +1,88 @@
+package index
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompoundIndex(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		info := CompoundIndexInfo("status", "createdAt")
+		require.Equal(t, "status,createdAt", info.Field)
+
+		idx := CreateBadgerIndexWithInfo("test", info, txn).(CompoundIndex)
+		require.Equal(t, IndexCompound, idx.Type())
+		require.Equal(t, []string{"status", "createdAt"}, idx.Fields())
+
+		entries := []CompoundValue{
+			{"open", int64(3)},
+			{"closed", int64(1)},
+			{"open", int64(1)},
+			{"open", MissingValue},
+			{"closed", "x"},
+			{"open", 2.5},
+		}
+
+		for i, value := range entries {
+			require.NoError(t, idx.Add(docIdOf(i), value, time.Duration(-1)))
+		}
+
+		err := idx.Add("missing", CompoundValue{MissingValue, int64(1)}, time.Duration(-1))
+		require.ErrorIs(t, err, ErrMissingLeadingField)
+
+		require.Error(t, idx.Add("invalid", "open", time.Duration(-1)))
+		require.Error(t, idx.Add("invalid", CompoundValue{"open"}, time.Duration(-1)))
+
+		collect := func(prefix []interface{}, reverse bool) []string {
+			docIds := make([]string, 0)
+			err := (&CompoundIndexQuery{Prefix: prefix, Reverse: reverse, Idx: idx}).Run(func(docId string) error {
+				docIds = append(docIds, docId)
+				return nil
+			})
+			require.NoError(t, err)
+			return docIds
+		}
+
+		// null sorts before numbers, which sort before strings
+		require.Equal(t, []string{docIdOf(3), docIdOf(2), docIdOf(5), docIdOf(0)}, collect([]interface{}{"open"}, false))
+		require.Equal(t, []string{docIdOf(0), docIdOf(5), docIdOf(2), docIdOf(3)}, collect([]interface{}{"open"}, true))
+		require.Equal(t, []string{docIdOf(1), docIdOf(4)}, collect([]interface{}{"closed"}, false))
+		require.Equal(t, []string{docIdOf(2)}, collect([]interface{}{"open", 1.0}, false))
+		require.Empty(t, collect([]interface{}{"missing"}, false))
+		require.Equal(t, []string{docIdOf(1), docIdOf(4), docIdOf(3), docIdOf(2), docIdOf(5), docIdOf(0)}, collect(nil, false))
+
+		require.Error(t, idx.IteratePrefix([]interface{}{"open", int64(1), "extra"}, false, func(string) error { return nil }))
+
+		require.NoError(t, idx.Remove(docIdOf(2), CompoundValue{"open", int64(1)}))
+		require.NoError(t, idx.Remove("missing", CompoundValue{MissingValue, int64(1)}))
+		require.Equal(t, []string{docIdOf(3), docIdOf(5), docIdOf(0)}, collect([]interface{}{"open"}, false))
+
+		contains, err := idx.ContainsDoc(docIdOf(2))
+		require.NoError(t, err)
+		require.False(t, contains)
+
+		require.NoError(t, idx.Drop())
+		require.Empty(t, collect(nil, false))
+	})
+}
+
+func TestCompoundIndexRemoveByDoc(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := CreateBadgerIndexWithInfo("test", CompoundIndexInfo("status", "tags"), txn)
+
+		require.NoError(t, idx.Add(docIdOf(0), CompoundValue{"open", []interface{}{"a", "b"}}, time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(1), CompoundValue{"open", "a"}, time.Duration(-1)))
+
+		require.NoError(t, idx.RemoveByDoc(docIdOf(0)))
+
+		docIds := make([]string, 0)
+		require.NoError(t, idx.Iterate(false, func(docId string) error {
+			docIds = append(docIds, docId)
+			return nil
+		}))
+		require.Equal(t, []string{docIdOf(1)}, docIds)
+	})
+}
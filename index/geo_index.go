@@ -0,0 +1,423 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ostafen/clover/v2/internal"
+)
+
+// Point is a geographic location, whose coordinates are expressed in degrees.
+// Geospatial indexes only index values which are objects holding a numeric "lat" and "lng" field, such as normalized points.
+type Point struct {
+	Lat float64 `clover:"lat" json:"lat"`
+	Lng float64 `clover:"lng" json:"lng"`
+}
+
+func (p Point) valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// GeoBox is a rectangular area, delimited by its south-west (Min) and north-east (Max) corners.
+// A box whose Min.Lng is greater than its Max.Lng crosses the antimeridian.
+type GeoBox struct {
+	Min, Max Point
+}
+
+func (box GeoBox) contains(p Point) bool {
+	if p.Lat < box.Min.Lat || p.Lat > box.Max.Lat {
+		return false
+	}
+
+	if box.Min.Lng <= box.Max.Lng {
+		return p.Lng >= box.Min.Lng && p.Lng <= box.Max.Lng
+	}
+	return p.Lng >= box.Min.Lng || p.Lng <= box.Max.Lng
+}
+
+// split returns a list of boxes covering the same area, none of which crosses the antimeridian.
+func (box GeoBox) split() []GeoBox {
+	if box.Min.Lng <= box.Max.Lng {
+		return []GeoBox{box}
+	}
+
+	return []GeoBox{
+		{Min: box.Min, Max: Point{Lat: box.Max.Lat, Lng: 180}},
+		{Min: Point{Lat: box.Min.Lat, Lng: -180}, Max: box.Max},
+	}
+}
+
+// EarthRadius is the mean radius of the Earth, in meters, used to compute distances between points.
+const EarthRadius = 6371008.8
+
+// Distance returns the great-circle distance between two points, in meters.
+func Distance(p1, p2 Point) float64 {
+	lat1, lat2 := p1.Lat*math.Pi/180, p2.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (p2.Lng - p1.Lng) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// boundingBox returns a box containing all the points whose distance from center is at most radius.
+func boundingBox(center Point, radius float64) GeoBox {
+	dLat := radius / EarthRadius * 180 / math.Pi
+
+	minLat, maxLat := center.Lat-dLat, center.Lat+dLat
+	if minLat <= -90 || maxLat >= 90 { // the circle contains a pole, thus all longitudes
+		return GeoBox{
+			Min: Point{Lat: math.Max(minLat, -90), Lng: -180},
+			Max: Point{Lat: math.Min(maxLat, 90), Lng: 180},
+		}
+	}
+
+	dLng := dLat / math.Cos(math.Max(math.Abs(minLat), math.Abs(maxLat))*math.Pi/180)
+	if dLng >= 180 {
+		return GeoBox{Min: Point{Lat: minLat, Lng: -180}, Max: Point{Lat: maxLat, Lng: 180}}
+	}
+	return GeoBox{
+		Min: Point{Lat: minLat, Lng: wrapLng(center.Lng - dLng)},
+		Max: Point{Lat: maxLat, Lng: wrapLng(center.Lng + dLng)},
+	}
+}
+
+func wrapLng(lng float64) float64 {
+	if lng < -180 {
+		return lng + 360
+	}
+	if lng > 180 {
+		return lng - 360
+	}
+	return lng
+}
+
+// toPoint returns the point held by a normalized value, if any.
+func toPoint(v interface{}) (Point, bool) {
+	m, isMap := v.(map[string]interface{})
+	if !isMap {
+		return Point{}, false
+	}
+
+	lat, err := toFloat64(m["lat"])
+	if err != nil {
+		return Point{}, false
+	}
+
+	lng, err := toFloat64(m["lng"])
+	if err != nil {
+		return Point{}, false
+	}
+
+	p := Point{Lat: lat, Lng: lng}
+	return p, p.valid()
+}
+
+// GeoIndex is an index on geographic points, which supports lookups of the points lying within an area.
+// Entries are ordered by the Z-order curve of their points, so that nearby points are usually close to each other within the index.
+type GeoIndex interface {
+	Index
+	IterateBox(box GeoBox, onValue func(docId string) error) error
+	IterateNear(center Point, radius float64, onValue func(docId string) error) error
+}
+
+// GeoIndexQuery selects the documents whose point lies within Box or, if Box is nil, within Radius meters from Center.
+type GeoIndexQuery struct {
+	Box    *GeoBox
+	Center Point
+	Radius float64
+	Idx    GeoIndex
+}
+
+func (q *GeoIndexQuery) Run(onValue func(docId string) error) error {
+	if q.Box != nil {
+		return q.Idx.IterateBox(*q.Box, onValue)
+	}
+	return q.Idx.IterateNear(q.Center, q.Radius, onValue)
+}
+
+type badgerGeoIndex struct {
+	indexBase
+	txn *badger.Txn
+}
+
+const zOrderSize = 8
+
+// spreadBits interleaves the bits of x with zeros, so that bit i of x becomes bit 2i of the result.
+func spreadBits(x uint32) uint64 {
+	v := uint64(x)
+	v = (v | v<<16) & 0x0000FFFF0000FFFF
+	v = (v | v<<8) & 0x00FF00FF00FF00FF
+	v = (v | v<<4) & 0x0F0F0F0F0F0F0F0F
+	v = (v | v<<2) & 0x3333333333333333
+	v = (v | v<<1) & 0x5555555555555555
+	return v
+}
+
+func quantize(value, min, max float64) uint32 {
+	return uint32((value - min) / (max - min) * math.MaxUint32)
+}
+
+// zOrder interleaves the bits of the quantized coordinates of p. Since quantization is monotonic,
+// the value of each point lying within a box is between the values of the corners of the box.
+func zOrder(p Point) uint64 {
+	return spreadBits(quantize(p.Lat, -90, 90))<<1 | spreadBits(quantize(p.Lng, -180, 180))
+}
+
+func (idx *badgerGeoIndex) getKeyPrefix() []byte {
+	return []byte(fmt.Sprintf("c:%s;g:%s;", idx.collection, idx.Field()))
+}
+
+func (idx *badgerGeoIndex) getKey(p Point) []byte {
+	var z [zOrderSize]byte
+	binary.BigEndian.PutUint64(z[:], zOrder(p))
+	return append(idx.getKeyPrefix(), z[:]...)
+}
+
+func encodePoint(p Point) []byte {
+	var data [16]byte
+	binary.BigEndian.PutUint64(data[:8], math.Float64bits(p.Lat))
+	binary.BigEndian.PutUint64(data[8:], math.Float64bits(p.Lng))
+	return data[:]
+}
+
+func decodePoint(data []byte) (Point, error) {
+	if len(data) != 16 {
+		return Point{}, fmt.Errorf("invalid point encoding of length %d", len(data))
+	}
+
+	return Point{
+		Lat: math.Float64frombits(binary.BigEndian.Uint64(data[:8])),
+		Lng: math.Float64frombits(binary.BigEndian.Uint64(data[8:])),
+	}, nil
+}
+
+func (idx *badgerGeoIndex) Add(docId string, v interface{}, ttl time.Duration) error {
+	defer idx.lock()()
+
+	return idx.add(docId, v, ttl)
+}
+
+func (idx *badgerGeoIndex) add(docId string, v interface{}, ttl time.Duration) error {
+	if ttl == 0 {
+		return nil
+	}
+
+	if values, isMulti := v.(MultiValue); isMulti {
+		for _, value := range values {
+			if err := idx.add(docId, value, ttl); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	p, isPoint := toPoint(v)
+	if !isPoint { // documents lacking a valid point are not indexed
+		return nil
+	}
+
+	// the exact point is stored along with the key, which only holds its quantized coordinates
+	key, err := appendDocId(idx.getKey(p), docId)
+	if err != nil {
+		return err
+	}
+
+	e := badger.NewEntry(key, encodePoint(p))
+	if ttl > 0 {
+		e = e.WithTTL(ttl)
+	}
+	return idx.txn.SetEntry(e)
+}
+
+func (idx *badgerGeoIndex) Remove(docId string, v interface{}) error {
+	defer idx.lock()()
+
+	return idx.remove(docId, v)
+}
+
+func (idx *badgerGeoIndex) remove(docId string, v interface{}) error {
+	if values, isMulti := v.(MultiValue); isMulti {
+		for _, value := range values {
+			if err := idx.remove(docId, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	p, isPoint := toPoint(v)
+	if !isPoint {
+		return nil
+	}
+	key, err := appendDocId(idx.getKey(p), docId)
+	if err != nil {
+		return err
+	}
+	return idx.txn.Delete(key)
+}
+
+// IterateBox invokes onValue for the id of each document having a point within box.
+// A document with multiple points within the box is reported once for each of them.
+func (idx *badgerGeoIndex) IterateBox(box GeoBox, onValue func(docId string) error) error {
+	defer idx.lock()()
+
+	err := idx.iterateBox(box, func(_ Point, docId string) error {
+		return onValue(docId)
+	})
+
+	if err == internal.ErrStopIteration {
+		return nil
+	}
+	return err
+}
+
+// IterateNear invokes onValue for the id of each document having a point whose distance from center is at most radius meters.
+// A document with multiple such points is reported once for each of them.
+func (idx *badgerGeoIndex) IterateNear(center Point, radius float64, onValue func(docId string) error) error {
+	defer idx.lock()()
+
+	err := idx.iterateBox(boundingBox(center, radius), func(p Point, docId string) error {
+		if Distance(center, p) <= radius {
+			return onValue(docId)
+		}
+		return nil
+	})
+
+	if err == internal.ErrStopIteration {
+		return nil
+	}
+	return err
+}
+
+func (idx *badgerGeoIndex) iterateBox(box GeoBox, onValue func(p Point, docId string) error) error {
+	it := idx.txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for _, b := range box.split() {
+		if err := idx.scanBox(it, b, onValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanBox scans the entries whose key lies between the keys of the corners of box, which include all the points within it,
+// and calls onValue for the ones actually within box.
+func (idx *badgerGeoIndex) scanBox(it *badger.Iterator, box GeoBox, onValue func(p Point, docId string) error) error {
+	endKey := idx.getKey(box.Max)
+
+	prefix := idx.getKeyPrefix()
+	for it.Seek(idx.getKey(box.Min)); it.ValidForPrefix(prefix); it.Next() {
+		key, docId, err := extractDocId(it.Item().Key())
+		if err != nil {
+			return err
+		}
+
+		if bytes.Compare(key, endKey) > 0 {
+			break
+		}
+
+		data, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		p, err := decodePoint(data)
+		if err != nil {
+			return err
+		}
+
+		if !box.contains(p) {
+			continue
+		}
+
+		if err := onValue(p, string(docId)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Iterate invokes onValue for each entry of the index, following the Z-order curve of the points.
+func (idx *badgerGeoIndex) Iterate(reverse bool, onValue func(docId string) error) error {
+	defer idx.lock()()
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Reverse = reverse
+
+	it := idx.txn.NewIterator(opts)
+	defer it.Close()
+
+	prefix := idx.getKeyPrefix()
+
+	seekPrefix := prefix
+	if reverse {
+		seekPrefix = append(seekPrefix, 255)
+	}
+
+	for it.Seek(seekPrefix); it.ValidForPrefix(prefix); it.Next() {
+		_, docId, err := extractDocId(it.Item().Key())
+		if err != nil {
+			return err
+		}
+
+		if err := onValue(string(docId)); err != nil {
+			if err == internal.ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ContainsDoc reports whether the index contains at least one entry for the document with the given id.
+// Since entries are ordered by the z-order of their points, all the index keys are scanned.
+func (idx *badgerGeoIndex) ContainsDoc(docId string) (bool, error) {
+	defer idx.lock()()
+
+	return containsDoc(idx.txn, idx.getKeyPrefix(), docId)
+}
+
+// RemoveByDoc removes all the entries of the document with the given id, which may be several if the field holds an array of points.
+func (idx *badgerGeoIndex) RemoveByDoc(docId string) error {
+	defer idx.lock()()
+
+	return removeDocEntries(idx.txn, idx.getKeyPrefix(), docId)
+}
+
+func (idx *badgerGeoIndex) Drop() error {
+	defer idx.lock()()
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := idx.txn.NewIterator(opts)
+	defer it.Close()
+
+	prefix := idx.getKeyPrefix()
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		if err := idx.txn.Delete(it.Item().KeyCopy(nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats returns the statistics of the entries of the index. Keys encode the cell of the grid which points fall into,
+// thus Distinct is the number of distinct cells.
+func (idx *badgerGeoIndex) Stats() (IndexStats, error) {
+	defer idx.lock()()
+
+	return scanStats(idx.txn, idx.getKeyPrefix())
+}
+
+func (idx *badgerGeoIndex) Type() IndexType {
+	return IndexGeoSpatial
+}
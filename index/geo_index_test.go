@@ -0,0 +1,130 @@
+package index
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func pointValue(lat, lng float64) map[string]interface{} {
+	return map[string]interface{}{"lat": lat, "lng": lng}
+}
+
+func TestGeoIndex(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "location", Type: IndexGeoSpatial}, txn).(GeoIndex)
+		require.Equal(t, IndexGeoSpatial, idx.Type())
+
+		r := rand.New(rand.NewSource(0))
+
+		points := make(map[string]Point)
+		for i := 0; i < 2000; i++ {
+			p := Point{Lat: r.Float64()*180 - 90, Lng: r.Float64()*360 - 180}
+			points[docIdOf(i)] = p
+			require.NoError(t, idx.Add(docIdOf(i), pointValue(p.Lat, p.Lng), time.Duration(-1)))
+		}
+
+		// values which are not valid points are ignored
+		require.NoError(t, idx.Add("invalid", pointValue(100, 0), time.Duration(-1)))
+		require.NoError(t, idx.Add("invalid", "not a point", time.Duration(-1)))
+
+		collect := func(run func(onValue func(docId string) error) error) []string {
+			docIds := make([]string, 0)
+			require.NoError(t, run(func(docId string) error {
+				docIds = append(docIds, docId)
+				return nil
+			}))
+			sort.Strings(docIds)
+			return docIds
+		}
+
+		expected := func(pred func(p Point) bool) []string {
+			docIds := make([]string, 0)
+			for docId, p := range points {
+				if pred(p) {
+					docIds = append(docIds, docId)
+				}
+			}
+			sort.Strings(docIds)
+			return docIds
+		}
+
+		boxes := []GeoBox{
+			{Min: Point{Lat: 10, Lng: 20}, Max: Point{Lat: 40, Lng: 60}},
+			{Min: Point{Lat: -90, Lng: -180}, Max: Point{Lat: 90, Lng: 180}},
+			{Min: Point{Lat: -30, Lng: 170}, Max: Point{Lat: 30, Lng: -160}}, // crosses the antimeridian
+		}
+
+		for _, box := range boxes {
+			box := box
+			res := collect(func(onValue func(docId string) error) error {
+				return (&GeoIndexQuery{Box: &box, Idx: idx}).Run(onValue)
+			})
+			require.Equal(t, expected(box.contains), res)
+			require.NotEmpty(t, res)
+		}
+
+		centers := []Point{{Lat: 45, Lng: 9}, {Lat: 0, Lng: 179.5}, {Lat: 89, Lng: 0}}
+		for _, center := range centers {
+			radius := 2000e3
+			res := collect(func(onValue func(docId string) error) error {
+				return (&GeoIndexQuery{Center: center, Radius: radius, Idx: idx}).Run(onValue)
+			})
+			require.Equal(t, expected(func(p Point) bool { return Distance(center, p) <= radius }), res)
+			require.NotEmpty(t, res)
+		}
+
+		all := collect(func(onValue func(docId string) error) error {
+			return idx.Iterate(false, onValue)
+		})
+		require.Len(t, all, len(points))
+
+		require.NoError(t, idx.Remove(docIdOf(0), pointValue(points[docIdOf(0)].Lat, points[docIdOf(0)].Lng)))
+
+		contains, err := idx.ContainsDoc(docIdOf(0))
+		require.NoError(t, err)
+		require.False(t, contains)
+
+		contains, err = idx.ContainsDoc(docIdOf(1))
+		require.NoError(t, err)
+		require.True(t, contains)
+
+		require.NoError(t, idx.Drop())
+		require.Empty(t, collect(func(onValue func(docId string) error) error {
+			return idx.Iterate(false, onValue)
+		}))
+	})
+}
+
+func TestGeoDistance(t *testing.T) {
+	rome := Point{Lat: 41.9028, Lng: 12.4964}
+	milan := Point{Lat: 45.4642, Lng: 9.19}
+
+	require.InDelta(t, 477e3, Distance(rome, milan), 2e3)
+	require.Zero(t, Distance(rome, rome))
+	require.InDelta(t, Distance(Point{Lng: 179.9}, Point{Lng: -179.9}), Distance(Point{Lng: 0}, Point{Lng: 0.2}), 1e-6)
+}
+
+func TestGeoIndexStats(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "location", Type: IndexGeoSpatial}, txn).(StatsIndex)
+
+		stats, err := idx.Stats()
+		require.NoError(t, err)
+		require.Equal(t, IndexStats{}, stats)
+
+		require.NoError(t, idx.Add(docIdOf(1), pointValue(45.46, 9.19), time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(2), pointValue(45.46, 9.19), time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(3), pointValue(-33.87, 151.21), time.Duration(-1)))
+
+		stats, err = idx.Stats()
+		require.NoError(t, err)
+		require.Equal(t, 3, stats.Entries)
+		require.Equal(t, 2, stats.Distinct)
+		require.Less(t, string(stats.MinKey), string(stats.MaxKey))
+	})
+}
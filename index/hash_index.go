@@ -0,0 +1,259 @@
+package index
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ostafen/clover/v2/internal"
+	"github.com/ostafen/clover/v2/util"
+)
+
+// HashIndex is an index which only supports equality lookups. Rather than the values themselves,
+// it stores a fixed-size hash of each value, which saves space on fields holding long values (such as URLs or tokens).
+type HashIndex interface {
+	Index
+	Lookup(value interface{}, onValue func(docId string) error) error
+}
+
+type HashIndexQuery struct {
+	Value interface{}
+	Idx   HashIndex
+}
+
+func (q *HashIndexQuery) Run(onValue func(docId string) error) error {
+	return q.Idx.Lookup(q.Value, onValue)
+}
+
+type badgerHashIndex struct {
+	indexBase
+	txn *badger.Txn
+}
+
+const hashSize = 8
+
+// hashBytes computes the hash of an encoded value.
+var hashBytes = xxhash.Sum64
+
+func (idx *badgerHashIndex) getKeyPrefix() []byte {
+	return []byte(fmt.Sprintf("c:%s;h:%s;", idx.collection, idx.Field()))
+}
+
+// getHashKey returns the prefix shared by the keys of all the entries whose value hashes as v.
+func (idx *badgerHashIndex) getHashKey(v interface{}) ([]byte, error) {
+	keyValue, err := idx.keyValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := internal.EncodeValue(canonicalHashValue(keyValue))
+	if err != nil {
+		return nil, err
+	}
+
+	var hash [hashSize]byte
+	binary.BigEndian.PutUint64(hash[:], hashBytes(data))
+	return append(idx.getKeyPrefix(), hash[:]...), nil
+}
+
+// canonicalHashValue converts each number within v to float64, as range indexes do when encoding their keys,
+// so that values comparing as equal (such as int64(1) and float64(1)) share the same hash.
+func canonicalHashValue(v interface{}) interface{} {
+	if util.IsNumber(v) {
+		return util.ToFloat64(v)
+	}
+
+	switch vType := v.(type) {
+	case []interface{}:
+		values := make([]interface{}, len(vType))
+		for i, elem := range vType {
+			values[i] = canonicalHashValue(elem)
+		}
+		return values
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(vType))
+		for key, elem := range vType {
+			m[key] = canonicalHashValue(elem)
+		}
+		return m
+	}
+	return v
+}
+
+// Add adds to the index the entries of the document with the given id. As for range indexes,
+// arrays are indexed both as a whole and once per element.
+func (idx *badgerHashIndex) Add(docId string, v interface{}, ttl time.Duration) error {
+	defer idx.lock()()
+
+	return idx.add(docId, v, ttl)
+}
+
+func (idx *badgerHashIndex) add(docId string, v interface{}, ttl time.Duration) error {
+	if ttl == 0 {
+		return nil
+	}
+
+	if values, isMulti := v.(MultiValue); isMulti {
+		for _, value := range values {
+			if err := idx.add(docId, value, ttl); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if elems, isArray := v.([]interface{}); isArray {
+		for _, value := range elems {
+			if err := idx.addEntry(docId, value, ttl); err != nil {
+				return err
+			}
+		}
+	}
+	return idx.addEntry(docId, v, ttl)
+}
+
+func (idx *badgerHashIndex) addEntry(docId string, v interface{}, ttl time.Duration) error {
+	hashKey, err := idx.getHashKey(v)
+	if err != nil {
+		return err
+	}
+
+	// only the key is stored, since values cannot be recovered from their hash anyway
+	key, err := appendDocId(hashKey, docId)
+	if err != nil {
+		return err
+	}
+
+	e := badger.NewEntry(key, nil)
+	if ttl > 0 {
+		e = e.WithTTL(ttl)
+	}
+	return idx.txn.SetEntry(e)
+}
+
+func (idx *badgerHashIndex) Remove(docId string, v interface{}) error {
+	defer idx.lock()()
+
+	return idx.remove(docId, v)
+}
+
+func (idx *badgerHashIndex) remove(docId string, v interface{}) error {
+	if values, isMulti := v.(MultiValue); isMulti {
+		for _, value := range values {
+			if err := idx.remove(docId, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if elems, isArray := v.([]interface{}); isArray {
+		for _, value := range elems {
+			if err := idx.removeEntry(docId, value); err != nil {
+				return err
+			}
+		}
+	}
+	return idx.removeEntry(docId, v)
+}
+
+func (idx *badgerHashIndex) removeEntry(docId string, v interface{}) error {
+	hashKey, err := idx.getHashKey(v)
+	if err != nil {
+		return err
+	}
+	key, err := appendDocId(hashKey, docId)
+	if err != nil {
+		return err
+	}
+	return idx.txn.Delete(key)
+}
+
+// Lookup invokes onValue for the id of each document whose value may be equal to the supplied one.
+// Since distinct values can have the same hash, the candidates must be confirmed against the actual documents.
+func (idx *badgerHashIndex) Lookup(value interface{}, onValue func(docId string) error) error {
+	defer idx.lock()()
+
+	hashKey, err := idx.getHashKey(value)
+	if err != nil {
+		return err
+	}
+	return idx.iteratePrefix(hashKey, onValue)
+}
+
+// Iterate invokes onValue for each entry of the index. Entries are ordered by the hash of their values, thus in no meaningful order.
+func (idx *badgerHashIndex) Iterate(reverse bool, onValue func(docId string) error) error {
+	defer idx.lock()()
+
+	return idx.iteratePrefix(idx.getKeyPrefix(), onValue)
+}
+
+func (idx *badgerHashIndex) iteratePrefix(prefix []byte, onValue func(docId string) error) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := idx.txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		_, docId, err := extractDocId(it.Item().Key())
+		if err != nil {
+			return err
+		}
+
+		if err := onValue(string(docId)); err != nil {
+			if err == internal.ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ContainsDoc reports whether the index contains at least one entry for the document with the given id.
+// Since entries are grouped by the hash of their value, all the index keys are scanned.
+func (idx *badgerHashIndex) ContainsDoc(docId string) (bool, error) {
+	defer idx.lock()()
+
+	return containsDoc(idx.txn, idx.getKeyPrefix(), docId)
+}
+
+// RemoveByDoc removes all the entries of the document with the given id, without requiring its indexed value.
+func (idx *badgerHashIndex) RemoveByDoc(docId string) error {
+	defer idx.lock()()
+
+	return removeDocEntries(idx.txn, idx.getKeyPrefix(), docId)
+}
+
+func (idx *badgerHashIndex) Drop() error {
+	defer idx.lock()()
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := idx.txn.NewIterator(opts)
+	defer it.Close()
+
+	prefix := idx.getKeyPrefix()
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		if err := idx.txn.Delete(it.Item().KeyCopy(nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats returns the statistics of the entries of the index. Keys hold the hashes of the values,
+// thus Distinct is the number of distinct hashes, which may be lower than the number of distinct values.
+func (idx *badgerHashIndex) Stats() (IndexStats, error) {
+	defer idx.lock()()
+
+	return scanStats(idx.txn, idx.getKeyPrefix())
+}
+
+func (idx *badgerHashIndex) Type() IndexType {
+	return IndexHash
+}
@@ -0,0 +1,124 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashIndex(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "field", Type: IndexHash}, txn).(HashIndex)
+		require.Equal(t, IndexHash, idx.Type())
+
+		lookup := func(value interface{}) []string {
+			docIds := make([]string, 0)
+			err := idx.Lookup(value, func(docId string) error {
+				docIds = append(docIds, docId)
+				return nil
+			})
+			require.NoError(t, err)
+			sort.Strings(docIds)
+			return docIds
+		}
+
+		long := "https://example.com/" + strings.Repeat("a", 1000)
+		require.NoError(t, idx.Add(docIdOf(0), long, time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(1), "short", time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(2), long, time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(3), MultiValue{"short", int64(1)}, time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(4), nil, time.Duration(-1)))
+
+		require.Equal(t, []string{docIdOf(0), docIdOf(2)}, lookup(long))
+		require.Equal(t, []string{docIdOf(1), docIdOf(3)}, lookup("short"))
+		require.Equal(t, []string{docIdOf(3)}, lookup(int64(1)))
+		require.Equal(t, []string{docIdOf(4)}, lookup(nil))
+		require.Empty(t, lookup("missing"))
+
+		// entries have a fixed size, regardless of the size of the indexed value
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		prefix := []byte("c:test;h:field;")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			require.Len(t, it.Item().Key(), len(prefix)+hashSize+len(docIdOf(0))+docIdLenSize)
+			require.Zero(t, it.Item().ValueSize())
+		}
+		it.Close()
+
+		require.NoError(t, idx.Remove(docIdOf(0), long))
+		require.Equal(t, []string{docIdOf(2)}, lookup(long))
+
+		contains, err := idx.ContainsDoc(docIdOf(0))
+		require.NoError(t, err)
+		require.False(t, contains)
+
+		contains, err = idx.ContainsDoc(docIdOf(2))
+		require.NoError(t, err)
+		require.True(t, contains)
+
+		require.NoError(t, idx.Drop())
+		require.Empty(t, lookup(long))
+	})
+}
+
+func TestHashIndexCollisions(t *testing.T) {
+	defer func(hash func([]byte) uint64) {
+		hashBytes = hash
+	}(hashBytes)
+
+	// values of the same encoded length collide
+	hashBytes = func(data []byte) uint64 {
+		return uint64(len(data))
+	}
+
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "field", Type: IndexHash}, txn).(HashIndex)
+
+		require.NoError(t, idx.Add(docIdOf(0), "aaa", time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(1), "bbb", time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(2), "cccc", time.Duration(-1)))
+
+		docIds := make([]string, 0)
+		err := idx.Lookup("aaa", func(docId string) error {
+			docIds = append(docIds, docId)
+			return nil
+		})
+		require.NoError(t, err)
+
+		// both candidates are returned, since they cannot be told apart by their hash
+		require.Equal(t, []string{docIdOf(0), docIdOf(1)}, docIds)
+	})
+}
+
+func TestHashIndexMixedNumbers(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "field", Type: IndexHash}, txn).(HashIndex)
+
+		require.NoError(t, idx.Add(docIdOf(0), int64(1), time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(1), uint64(1), time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(2), float64(1), time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(3), float64(1.5), time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(4), []interface{}{int64(1), "a"}, time.Duration(-1)))
+
+		lookup := func(value interface{}) []string {
+			docIds := make([]string, 0)
+			err := idx.Lookup(value, func(docId string) error {
+				docIds = append(docIds, docId)
+				return nil
+			})
+			require.NoError(t, err)
+			sort.Strings(docIds)
+			return docIds
+		}
+
+		all := []string{docIdOf(0), docIdOf(1), docIdOf(2), docIdOf(4)}
+		require.Equal(t, all, lookup(int64(1)))
+		require.Equal(t, all, lookup(uint64(1)))
+		require.Equal(t, all, lookup(float64(1)))
+		require.Equal(t, []string{docIdOf(3)}, lookup(float64(1.5)))
+		require.Equal(t, []string{docIdOf(4)}, lookup([]interface{}{float64(1), "a"}))
+	})
+}
@@ -1,34 +1,99 @@
 package index
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
+	"github.com/ostafen/clover/v2/internal"
 )
 
 type IndexType int
 
+// ErrDuplicateKey is returned when adding to a unique index an entry whose key is already held by another document.
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// KeyFormatVersion is the version of the layout of index keys.
+// Indexes written with an older layout must be rebuilt before being used.
+// Version 3 introduced the markers of multikey indexes (see MultikeyIndex).
+const KeyFormatVersion = 3
+
 const (
 	IndexSingleField IndexType = iota
+	// IndexHash is the type of the indexes which only support equality lookups (see HashIndex).
+	IndexHash
+	// IndexGeoSpatial is the type of the indexes on geographic points (see GeoIndex).
+	IndexGeoSpatial
+	// IndexCompound is the type of the indexes on multiple fields (see CompoundIndex).
+	IndexCompound
 )
 
+// IndexInfo is the definition of an index, which holds all the settings needed to rebuild it.
+// It is stored as JSON along with the collection metadata.
 type IndexInfo struct {
 	Field string
 	Type  IndexType
+
+	// Fields lists the indexed fields of compound indexes, while Field holds their comma separated list (see CompoundIndexInfo).
+	Fields []string `json:",omitempty"`
+
+	// KeyFunc is the name of the registered KeyFunc used to derive index keys from values, if any.
+	KeyFunc string `json:",omitempty"`
+
+	// Unique makes the index refuse entries whose key is already held by a different document (see ErrDuplicateKey).
+	// It is only supported by indexes of type IndexSingleField.
+	Unique bool `json:",omitempty"`
+
+	// Filter is the name of the registered filter selecting the documents covered by a partial index, if any.
+	Filter string `json:",omitempty"`
 }
 
+// MultiValue holds multiple values of the same document, which is indexed once per value.
+// It is used for fields whose path crosses an array of objects, such as "items.sku".
+type MultiValue []interface{}
+
 type Index interface {
 	Add(docId string, v interface{}, ttl time.Duration) error
 	Remove(docId string, v interface{}) error
+	RemoveByDoc(docId string) error
 	Iterate(reverse bool, onValue func(docId string) error) error
+	ContainsDoc(docId string) (bool, error)
 	Drop() error
 	Type() IndexType
 	Collection() string
 	Field() string
+	Info() IndexInfo
 }
 
 type indexBase struct {
-	collection, field string
+	collection string
+	info       IndexInfo
+	mu         *sync.Mutex
+}
+
+// Option customizes an index instance.
+type Option func(idx *indexBase)
+
+// WithLocking makes all the operations of the index instance mutually exclusive, so that it can be shared by multiple goroutines.
+// Note that an index cannot be accessed from the callbacks of its own iteration methods when locking is enabled.
+func WithLocking() Option {
+	return func(idx *indexBase) {
+		idx.mu = &sync.Mutex{}
+	}
+}
+
+// lock acquires the mutex of the index, if any, and returns the function releasing it.
+func (idx *indexBase) lock() func() {
+	if idx.mu == nil {
+		return func() {}
+	}
+
+	idx.mu.Lock()
+	return idx.mu.Unlock
 }
 
 func (idx *indexBase) Collection() string {
@@ -36,21 +101,248 @@ func (idx *indexBase) Collection() string {
 }
 
 func (idx *indexBase) Field() string {
-	return idx.field
+	return idx.info.Field
+}
+
+func (idx *indexBase) Info() IndexInfo {
+	return idx.info
+}
+
+// keyValue returns the value the index key of v is built from, which is derived from v if the index has a KeyFunc.
+func (idx *indexBase) keyValue(v interface{}) (interface{}, error) {
+	if idx.info.KeyFunc == "" {
+		return v, nil
+	}
+
+	keyFunc := GetKeyFunc(idx.info.KeyFunc)
+	if keyFunc == nil {
+		return nil, fmt.Errorf("%w: %s", ErrKeyFuncNotExist, idx.info.KeyFunc)
+	}
+
+	if key, ok := keyFunc(v); ok {
+		return key, nil
+	}
+	return v, nil
+}
+
+// SortDocIds sorts a set of document ids by the value of the indexed field, without fetching the documents.
+// It performs a single pass over the whole index, thus its cost depends on the size of the index rather than on the number of ids:
+// it pays off when the set is large, while small sets are better sorted by loading the documents.
+// Ids having no entry in the index are placed at the end, in their original order.
+func SortDocIds(ids []string, idx Index, reverse bool) ([]string, error) {
+	pending := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		pending[id] = true
+	}
+
+	sorted := make([]string, 0, len(ids))
+	if len(ids) == 0 {
+		return sorted, nil
+	}
+
+	err := idx.Iterate(reverse, func(docId string) error {
+		if pending[docId] {
+			delete(pending, docId) // documents can have multiple entries
+			sorted = append(sorted, docId)
+
+			if len(pending) == 0 {
+				return internal.ErrStopIteration
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if pending[id] {
+			delete(pending, id)
+			sorted = append(sorted, id)
+		}
+	}
+	return sorted, nil
+}
+
+// contextCheckInterval is the number of entries IterateContext visits between two checks of the context.
+const contextCheckInterval = 64
+
+// IterateContext is like Index.Iterate, but it can be cancelled through ctx, which is checked every few entries.
+// If ctx is done, the iteration is aborted and the context error is returned.
+func IterateContext(ctx context.Context, idx Index, reverse bool, onValue func(docId string) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	n := 0
+	return idx.Iterate(reverse, func(docId string) error {
+		n++
+		if n%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		return onValue(docId)
+	})
+}
+
+// IndexStats holds statistics about the entries of an index, which allow to compare the selectivity of different indexes.
+type IndexStats struct {
+	// Entries is the number of entries of the index. A document can have multiple entries (see MultiValue).
+	Entries int
+	// Distinct is the number of distinct keys of the entries, regardless of the documents they belong to.
+	Distinct int
+	// MinKey and MaxKey are the lowest and the highest encoded keys of the entries, without the document ids.
+	// They are nil if the index is empty.
+	MinKey, MaxKey []byte
+}
+
+// StatsIndex is implemented by the indexes which are able to report statistics about their entries.
+type StatsIndex interface {
+	Index
+	Stats() (IndexStats, error)
+}
+
+// MultikeyIndex is implemented by the indexes which are able to tell whether a document may have several entries in them.
+type MultikeyIndex interface {
+	Index
+	// Multikey reports whether the index has ever indexed an array or a MultiValue, in which case iterating it doesn't visit
+	// the documents in the order of the indexed field: a document comes up at the first of its elements or sub-values,
+	// rather than at the array as a whole (or at nil, which is the value of a field crossing an array of objects).
+	// It keeps reporting true after such documents are removed, until the index is dropped.
+	Multikey() (bool, error)
+}
+
+// setMultikey writes the marker key recording that the index has multikey entries. The marker never expires.
+func setMultikey(txn *badger.Txn, markerKey []byte) error {
+	return txn.Set(markerKey, nil)
+}
+
+// hasMultikeyMarker reports whether the marker key written by setMultikey exists.
+func hasMultikeyMarker(txn *badger.Txn, markerKey []byte) (bool, error) {
+	_, err := txn.Get(markerKey)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// scanStats computes the statistics of the entries whose keys start with prefix, scanning the keys in order.
+// Since document ids follow the encoded values within keys, the entries having the same key are adjacent.
+func scanStats(txn *badger.Txn, prefix []byte) (IndexStats, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var stats IndexStats
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		key, _, err := extractDocId(it.Item().Key())
+		if err != nil {
+			return IndexStats{}, err
+		}
+
+		if stats.MaxKey == nil || !bytes.Equal(key, stats.MaxKey) {
+			stats.Distinct++
+			stats.MaxKey = append([]byte{}, key...)
+		}
+
+		if stats.MinKey == nil {
+			stats.MinKey = stats.MaxKey
+		}
+		stats.Entries++
+	}
+	return stats, nil
+}
+
+// containsDoc reports whether any of the keys starting with prefix belongs to the document with the given id.
+// As for removeDocEntries, all the keys having the prefix may have to be scanned.
+func containsDoc(txn *badger.Txn, prefix []byte, docId string) (bool, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		_, id, err := extractDocId(it.Item().Key())
+		if err != nil {
+			return false, err
+		}
+
+		if string(id) == docId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// removeDocEntries deletes the entries of the document with the given id among the ones whose keys start with prefix.
+// Since entries are ordered by value rather than by document, all the keys having the prefix are scanned.
+func removeDocEntries(txn *badger.Txn, prefix []byte, docId string) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		_, id, err := extractDocId(it.Item().Key())
+		if err != nil {
+			return err
+		}
+
+		if string(id) == docId {
+			if err := txn.Delete(it.Item().KeyCopy(nil)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 type IndexQuery interface {
 	Run(onValue func(docId string) error) error
 }
 
+// CreateBadgerIndex returns an instance of the index of the given type on field, which operates within the supplied transaction.
+// Indexes having other settings, such as a KeyFunc, are created by CreateBadgerIndexWithInfo.
 func CreateBadgerIndex(collection, field string, idxType IndexType, txn *badger.Txn) Index {
-	indexBase := indexBase{collection: collection, field: field}
-	switch idxType {
+	return CreateBadgerIndexWithInfo(collection, IndexInfo{Field: field, Type: idxType}, txn)
+}
+
+// CreateBadgerIndexWithInfo returns an instance of the index described by info, which operates within the supplied transaction.
+// Since badger transactions are not safe for concurrent use, an index instance must be used by one goroutine at a time,
+// unless it is created using the WithLocking option.
+func CreateBadgerIndexWithInfo(collection string, info IndexInfo, txn *badger.Txn, opts ...Option) Index {
+	indexBase := indexBase{collection: collection, info: info}
+	for _, opt := range opts {
+		opt(&indexBase)
+	}
+
+	switch info.Type {
 	case IndexSingleField:
 		return &badgerRangeIndex{
 			indexBase: indexBase,
 			txn:       txn,
 		}
+	case IndexHash:
+		return &badgerHashIndex{
+			indexBase: indexBase,
+			txn:       txn,
+		}
+	case IndexGeoSpatial:
+		return &badgerGeoIndex{
+			indexBase: indexBase,
+			txn:       txn,
+		}
+	case IndexCompound:
+		return &badgerCompoundIndex{
+			indexBase: indexBase,
+			txn:       txn,
+		}
 	}
 	return nil
 }
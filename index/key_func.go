@@ -0,0 +1,91 @@
+package index
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrKeyFuncNotExist is returned when an index refers to a KeyFunc which has not been registered.
+var ErrKeyFuncNotExist = errors.New("no such key function")
+
+// KeyFunc derives an order-preserving key from the value of an indexed field, so that index entries
+// (and range queries over them) follow a custom ordering. Keys are compared as byte strings.
+// The second return value is false if the value cannot be mapped (for example, because it has an unexpected type):
+// in this case, the value is indexed as is.
+type KeyFunc func(value interface{}) ([]byte, bool)
+
+// VersionKeyFunc is the name of the builtin KeyFunc ordering version strings (such as "1.9" and "1.10") by their numeric segments.
+const VersionKeyFunc = "version"
+
+// CaseInsensitiveKeyFunc is the name of the builtin KeyFunc ordering strings regardless of their case.
+// Since entries still store the original values, they preserve their casing when read through IterateWithValue or Top.
+const CaseInsensitiveKeyFunc = "caseInsensitive"
+
+var keyFuncs sync.Map
+
+func init() {
+	RegisterKeyFunc(VersionKeyFunc, versionKey)
+	RegisterKeyFunc(CaseInsensitiveKeyFunc, caseInsensitiveKey)
+}
+
+// RegisterKeyFunc makes a KeyFunc available, under the supplied name, to the indexes created with it.
+// Since only the name of the function is persisted along with the index, it must be registered each time the database is opened.
+func RegisterKeyFunc(name string, fn KeyFunc) {
+	keyFuncs.Store(name, fn)
+}
+
+// GetKeyFunc returns the KeyFunc registered with the supplied name, or nil if no such function exists.
+func GetKeyFunc(name string) KeyFunc {
+	if fn, ok := keyFuncs.Load(name); ok {
+		return fn.(KeyFunc)
+	}
+	return nil
+}
+
+const versionSegmentWidth = 20
+
+// versionKey zero-pads each numeric segment of a version string, so that segments compare numerically.
+func versionKey(value interface{}) ([]byte, bool) {
+	s, isString := value.(string)
+	if !isString {
+		return nil, false
+	}
+
+	var sb strings.Builder
+	var digits strings.Builder
+
+	flushDigits := func() {
+		if digits.Len() == 0 {
+			return
+		}
+
+		n := strings.TrimLeft(digits.String(), "0")
+		if len(n) < versionSegmentWidth {
+			sb.WriteString(strings.Repeat("0", versionSegmentWidth-len(n)))
+		}
+		sb.WriteString(n)
+		digits.Reset()
+	}
+
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+			continue
+		}
+
+		flushDigits()
+		sb.WriteRune(r)
+	}
+	flushDigits()
+
+	return []byte(sb.String()), true
+}
+
+func caseInsensitiveKey(value interface{}) ([]byte, bool) {
+	s, isString := value.(string)
+	if !isString {
+		return nil, false
+	}
+	return []byte(strings.ToLower(s)), true
+}
@@ -1,9 +1,42 @@
 package index
 
 import (
+	"errors"
+	"sort"
+
 	"github.com/ostafen/clover/v2/internal"
 )
 
+// Operator is a comparison operator between the value of an indexed field and a given value.
+type Operator int
+
+const (
+	OpEq Operator = iota
+	OpLt
+	OpLtEq
+	OpGt
+	OpGtEq
+)
+
+var ErrInvalidOperator = errors.New("invalid operator")
+
+// toRange returns the range of values satisfying the comparison with value.
+func (op Operator) toRange(value interface{}) (*Range, error) {
+	switch op {
+	case OpEq:
+		return &Range{Start: value, End: value, StartIncluded: true, EndIncluded: true}, nil
+	case OpLt:
+		return &Range{End: value}, nil
+	case OpLtEq:
+		return &Range{End: value, EndIncluded: true}, nil
+	case OpGt:
+		return &Range{Start: value}, nil
+	case OpGtEq:
+		return &Range{Start: value, StartIncluded: true}, nil
+	}
+	return nil, ErrInvalidOperator
+}
+
 type Range struct {
 	Start, End                 interface{}
 	StartIncluded, EndIncluded bool
@@ -53,3 +86,75 @@ func (r1 *Range) Intersect(r2 *Range) *Range {
 	}
 	return intersection
 }
+
+func (r *Range) hasStart() bool {
+	return r.Start != nil || r.StartIncluded
+}
+
+func (r *Range) hasEnd() bool {
+	return r.End != nil || r.EndIncluded
+}
+
+// compareStarts compares the lower bounds of two ranges, an unbounded start being the smallest one.
+func compareStarts(r1, r2 *Range) int {
+	if !r1.hasStart() || !r2.hasStart() {
+		return boolToInt(r1.hasStart()) - boolToInt(r2.hasStart())
+	}
+
+	if res := internal.Compare(r1.Start, r2.Start); res != 0 {
+		return res
+	}
+	return boolToInt(r2.StartIncluded) - boolToInt(r1.StartIncluded)
+}
+
+// touches reports whether r2, whose start is not lower than the start of r1, overlaps r1 or is adjacent to it.
+func (r1 *Range) touches(r2 *Range) bool {
+	if !r1.hasEnd() || !r2.hasStart() {
+		return true
+	}
+
+	res := internal.Compare(r2.Start, r1.End)
+	return res < 0 || (res == 0 && (r1.EndIncluded || r2.StartIncluded))
+}
+
+// mergeRanges sorts a list of non empty ranges by their start, merging the ones which overlap or are adjacent.
+func mergeRanges(ranges []*Range) []*Range {
+	sorted := append([]*Range{}, ranges...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareStarts(sorted[i], sorted[j]) < 0
+	})
+
+	merged := make([]*Range, 0, len(sorted))
+	for _, r := range sorted {
+		if len(merged) == 0 || !merged[len(merged)-1].touches(r) {
+			rCopy := *r
+			merged = append(merged, &rCopy)
+			continue
+		}
+
+		last := merged[len(merged)-1]
+		if !last.hasEnd() {
+			continue
+		}
+
+		if !r.hasEnd() {
+			last.End, last.EndIncluded = nil, false
+			continue
+		}
+
+		res := internal.Compare(r.End, last.End)
+		if res > 0 {
+			last.End, last.EndIncluded = r.End, r.EndIncluded
+		} else if res == 0 {
+			last.EndIncluded = last.EndIncluded || r.EndIncluded
+		}
+	}
+	return merged
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -2,7 +2,10 @@ package index
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
@@ -12,6 +15,15 @@ import (
 type RangeIndex interface {
 	Index
 	IterateRange(vRange *Range, reverse bool, onValue func(docId string) error) error
+	IterateRanges(ranges []*Range, reverse bool, onValue func(docId string) error) error
+	IterateFrom(start interface{}, reverse bool, onValue func(docId string) error) error
+	Top(n int, onValue func(value interface{}, docId string) error) error
+	EstimateCost(op Operator, value interface{}) (int, error)
+	NotEqual(value interface{}, onValue func(docId string) error) error
+	Aggregate(agg AggregateFunc) (float64, error)
+	IterateWithValue(reverse bool, onValue func(value interface{}, docId string) error) error
+	Count() (int, error)
+	CountRange(vRange *Range) (int, error)
 }
 
 type RangeIndexQuery struct {
@@ -32,19 +44,63 @@ type badgerRangeIndex struct {
 	txn *badger.Txn
 }
 
-func extractDocId(key []byte) ([]byte, []byte) {
-	if len(key) < 36 {
-		panic(string(key))
+// index keys end with the document id followed by its length, encoded as a big-endian uint16,
+// so that ids of any scheme can be extracted from them. Since the id directly follows the encoded value,
+// entries having equal values are iterated in (byte-wise) docId order, or in reverse docId order when iterating backwards.
+const docIdLenSize = 2
+
+// ErrDocIdTooLong is returned when adding to an index a document whose id is longer than math.MaxUint16 bytes.
+var ErrDocIdTooLong = errors.New("document id too long")
+
+// ErrInvalidKey is returned when an index key does not end with a well-formed document id, which is the case of corrupted keys.
+var ErrInvalidKey = errors.New("invalid index key")
+
+func appendDocId(key []byte, docId string) ([]byte, error) {
+	if len(docId) > math.MaxUint16 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrDocIdTooLong, len(docId))
 	}
-	return key[:len(key)-36], key[len(key)-36:]
+
+	var idLen [docIdLenSize]byte
+	binary.BigEndian.PutUint16(idLen[:], uint16(len(docId)))
+
+	key = append(key, []byte(docId)...)
+	return append(key, idLen[:]...), nil
+}
+
+func extractDocId(key []byte) ([]byte, []byte, error) {
+	if len(key) < docIdLenSize {
+		return nil, nil, fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+
+	idLen := int(binary.BigEndian.Uint16(key[len(key)-docIdLenSize:]))
+	idStart := len(key) - docIdLenSize - idLen
+	if idStart < 0 {
+		return nil, nil, fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return key[:idStart], key[idStart : len(key)-docIdLenSize], nil
 }
 
 func (idx *badgerRangeIndex) getKeyPrefix() []byte {
-	return []byte(fmt.Sprintf("c:%s;i:%s", idx.collection, idx.field))
+	return []byte(fmt.Sprintf("c:%s;i:%s;", idx.collection, idx.Field()))
+}
+
+// getUniqueKeyPrefix returns the prefix of the markers written by unique indexes, one per indexed value.
+func (idx *badgerRangeIndex) getUniqueKeyPrefix() []byte {
+	return []byte(fmt.Sprintf("c:%s;u:%s;", idx.collection, idx.Field()))
+}
+
+// getUniqueKey returns the key of the marker of the value whose entries share the value key valueKey.
+func (idx *badgerRangeIndex) getUniqueKey(valueKey []byte) []byte {
+	return append(idx.getUniqueKeyPrefix(), valueKey[len(idx.getKeyPrefix()):]...)
+}
+
+// getMultikeyKey returns the key of the marker written when the index gets the entries of an array or a MultiValue (see MultikeyIndex).
+func (idx *badgerRangeIndex) getMultikeyKey() []byte {
+	return []byte(fmt.Sprintf("c:%s;m:%s;", idx.collection, idx.Field()))
 }
 
 func (idx *badgerRangeIndex) getKeyPrefixForType(typeId int) []byte {
-	return []byte(fmt.Sprintf("%s;t:%d;v:", idx.getKeyPrefix(), typeId))
+	return []byte(fmt.Sprintf("%st:%d;v:", idx.getKeyPrefix(), typeId))
 }
 
 func (idx *badgerRangeIndex) getKey(v interface{}) ([]byte, error) {
@@ -53,53 +109,228 @@ func (idx *badgerRangeIndex) getKey(v interface{}) ([]byte, error) {
 }
 
 func (idx *badgerRangeIndex) encodeValueAndId(value interface{}, docId string) ([]byte, error) {
-	encodedKey, err := idx.getKey(value)
+	keyValue, err := idx.keyValue(value)
 	if err != nil {
 		return nil, err
 	}
-	encodedKey = append(encodedKey, []byte(docId)...)
-	return encodedKey, nil
+
+	encodedKey, err := idx.getKey(keyValue)
+	if err != nil {
+		return nil, err
+	}
+	return appendDocId(encodedKey, docId)
 }
 
+// Add adds to the index the entries of the document with the given id. Arrays are indexed both as a whole and once per element
+// (multikey indexing), so that the index serves the criteria matching either the whole array or any of its elements, such as tags = "go".
 func (idx *badgerRangeIndex) Add(docId string, v interface{}, ttl time.Duration) error {
+	defer idx.lock()()
+
+	return idx.add(docId, v, ttl)
+}
+
+func (idx *badgerRangeIndex) add(docId string, v interface{}, ttl time.Duration) error {
 	if ttl == 0 {
 		return nil
 	}
 
+	if values, isMulti := v.(MultiValue); isMulti {
+		if err := setMultikey(idx.txn, idx.getMultikeyKey()); err != nil {
+			return err
+		}
+
+		for _, value := range values {
+			if err := idx.add(docId, value, ttl); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if elems, isArray := v.([]interface{}); isArray {
+		if err := setMultikey(idx.txn, idx.getMultikeyKey()); err != nil {
+			return err
+		}
+
+		for _, value := range elems {
+			if err := idx.addEntry(docId, value, ttl); err != nil {
+				return err
+			}
+		}
+	}
+	return idx.addEntry(docId, v, ttl)
+}
+
+func (idx *badgerRangeIndex) addEntry(docId string, v interface{}, ttl time.Duration) error {
 	encodedKey, err := idx.encodeValueAndId(v, docId)
 	if err != nil {
 		return err
 	}
 
-	e := badger.NewEntry(encodedKey, nil)
+	if idx.info.Unique && v != nil {
+		if err := idx.checkUnique(encodedKey, docId, v, ttl); err != nil {
+			return err
+		}
+	}
+
+	// the value is stored along with the key, so that it can be retrieved without fetching the document
+	encodedValue, err := internal.EncodeValue(v)
+	if err != nil {
+		return err
+	}
+
+	e := badger.NewEntry(encodedKey, encodedValue)
 	if ttl > 0 {
 		e = e.WithTTL(ttl)
 	}
 	return idx.txn.SetEntry(e)
 }
 
+// checkUnique returns ErrDuplicateKey if a document other than docId has an entry with the same key of encodedKey.
+// It also reads and writes the marker of the value, so that concurrent transactions adding the same value conflict
+// with each other (see badger.ErrConflict): badger doesn't detect conflicts on reads of keys which are absent.
+func (idx *badgerRangeIndex) checkUnique(encodedKey []byte, docId string, v interface{}, ttl time.Duration) error {
+	valueKey, _, err := extractDocId(encodedKey)
+	if err != nil {
+		return err
+	}
+
+	uniqueKey := idx.getUniqueKey(valueKey)
+	if _, err := idx.txn.Get(uniqueKey); err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		return err
+	}
+
+	e := badger.NewEntry(uniqueKey, []byte(docId))
+	if ttl > 0 {
+		e = e.WithTTL(ttl)
+	}
+
+	if err := idx.txn.SetEntry(e); err != nil {
+		return err
+	}
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := idx.txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek(valueKey); it.ValidForPrefix(valueKey); it.Next() {
+		key, id, err := extractDocId(it.Item().Key())
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(key, valueKey) && string(id) != docId {
+			return fmt.Errorf("%w: field %q has value %v in document %s", ErrDuplicateKey, idx.Field(), v, id)
+		}
+	}
+	return nil
+}
+
 func (idx *badgerRangeIndex) Remove(docId string, value interface{}) error {
+	defer idx.lock()()
+
+	return idx.remove(docId, value)
+}
+
+func (idx *badgerRangeIndex) remove(docId string, value interface{}) error {
+	if values, isMulti := value.(MultiValue); isMulti {
+		for _, v := range values {
+			if err := idx.remove(docId, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if elems, isArray := value.([]interface{}); isArray {
+		for _, v := range elems {
+			if err := idx.removeEntry(docId, v); err != nil {
+				return err
+			}
+		}
+	}
+	return idx.removeEntry(docId, value)
+}
+
+func (idx *badgerRangeIndex) removeEntry(docId string, value interface{}) error {
 	encodedKey, err := idx.encodeValueAndId(value, docId)
 	if err != nil {
 		return err
 	}
+
+	if idx.info.Unique && value != nil {
+		valueKey, _, err := extractDocId(encodedKey)
+		if err != nil {
+			return err
+		}
+
+		if err := idx.txn.Delete(idx.getUniqueKey(valueKey)); err != nil {
+			return err
+		}
+	}
 	return idx.txn.Delete(encodedKey)
 }
 
-func (idx *badgerRangeIndex) Drop() error {
+// RemoveByDoc removes all the entries of the document with the given id, without requiring its indexed value.
+// Unlike Remove, it requires a scan of the index keys, whose cost is linear in the size of the index.
+func (idx *badgerRangeIndex) RemoveByDoc(docId string) error {
+	defer idx.lock()()
+
+	if err := idx.removeDocMarkers(docId); err != nil {
+		return err
+	}
+	return removeDocEntries(idx.txn, idx.getKeyPrefix(), docId)
+}
+
+// removeDocMarkers removes the markers of the values held by the document with the given id.
+func (idx *badgerRangeIndex) removeDocMarkers(docId string) error {
 	it := idx.txn.NewIterator(badger.DefaultIteratorOptions)
 	defer it.Close()
 
-	prefix := idx.getKeyPrefix()
+	prefix := idx.getUniqueKeyPrefix()
 	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-		key := it.Item().Key()
-		if err := idx.txn.Delete(key); err != nil {
+		item := it.Item()
+
+		owner, err := item.ValueCopy(nil)
+		if err != nil {
 			return err
 		}
+
+		if string(owner) == docId {
+			if err := idx.txn.Delete(item.KeyCopy(nil)); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
+func (idx *badgerRangeIndex) Drop() error {
+	defer idx.lock()()
+
+	it := idx.txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for _, prefix := range [][]byte{idx.getKeyPrefix(), idx.getUniqueKeyPrefix()} {
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			// the key must be copied, since the iterator reuses its buffer
+			if err := idx.txn.Delete(it.Item().KeyCopy(nil)); err != nil {
+				return err
+			}
+		}
+	}
+	return idx.txn.Delete(idx.getMultikeyKey())
+}
+
+// Multikey reports whether the index has ever indexed an array or a MultiValue (see MultikeyIndex).
+func (idx *badgerRangeIndex) Multikey() (bool, error) {
+	defer idx.lock()()
+
+	return hasMultikeyMarker(idx.txn, idx.getMultikeyKey())
+}
+
 func (idx *badgerRangeIndex) encodeRange(vRange *Range) ([]byte, []byte, error) {
 	var err error
 	var startKey, endKey []byte
@@ -121,24 +352,159 @@ func (idx *badgerRangeIndex) encodeRange(vRange *Range) ([]byte, []byte, error)
 	return startKey, endKey, nil
 }
 
+// keyRange returns the range of the index keys corresponding to the supplied range of values.
+func (idx *badgerRangeIndex) keyRange(vRange *Range) (*Range, error) {
+	keyRange := *vRange
+
+	// numbers are encoded as float64 values, thus large integers share their keys with the nearby numbers:
+	// excluded bounds must be included, so that nearby values are not skipped, leaving to the caller the check of the actual values
+	if !hasExactKey(vRange.Start) {
+		keyRange.StartIncluded = true
+	}
+
+	if !hasExactKey(vRange.End) {
+		keyRange.EndIncluded = true
+	}
+
+	if idx.info.KeyFunc == "" {
+		return &keyRange, nil
+	}
+
+	if vRange.Start != nil {
+		start, err := idx.keyValue(vRange.Start)
+		if err != nil {
+			return nil, err
+		}
+		keyRange.Start = start
+	}
+
+	if vRange.End != nil {
+		end, err := idx.keyValue(vRange.End)
+		if err != nil {
+			return nil, err
+		}
+		keyRange.End = end
+	}
+	return &keyRange, nil
+}
+
+// maxExactInteger is the lowest magnitude of the integers which may be encoded as the same float64 value as a different integer.
+const maxExactInteger = 1 << 53
+
+// hasExactKey reports whether the key of v is only shared by values equal to v, which is not the case for numbers
+// whose magnitude reaches maxExactInteger.
+func hasExactKey(v interface{}) bool {
+	switch vType := v.(type) {
+	case int64:
+		return vType > -maxExactInteger && vType < maxExactInteger
+	case uint64:
+		return vType < maxExactInteger
+	case float64:
+		return math.Abs(vType) < maxExactInteger
+	}
+	return true
+}
+
 func (idx *badgerRangeIndex) IterateRange(vRange *Range, reverse bool, onValue func(docId string) error) error {
+	defer idx.lock()()
+
+	return idx.iterateRange(vRange, reverse, onValue)
+}
+
+func (idx *badgerRangeIndex) iterateRange(vRange *Range, reverse bool, onValue func(docId string) error) error {
+	vRange, err := idx.keyRange(vRange)
+	if err != nil {
+		return err
+	}
+
 	if vRange.IsEmpty() {
 		return nil
 	}
 
-	startKey, endKey, err := idx.encodeRange(vRange)
-	if err != nil {
-		return err
+	it := idx.newRangeIterator(reverse)
+	defer it.Close()
+
+	err = idx.scanRange(it, vRange, reverse, onValue)
+	if err == internal.ErrStopIteration {
+		return nil
 	}
+	return err
+}
 
-	seekPrefix := startKey
+// IterateFrom invokes onValue for the entries whose value is greater than or equal to start, in increasing order or,
+// if reverse is true, for the entries whose value is less than or equal to start, in decreasing order.
+// The iteration seeks directly to start, thus the entries preceding it are not scanned.
+func (idx *badgerRangeIndex) IterateFrom(start interface{}, reverse bool, onValue func(docId string) error) error {
+	vRange := &Range{Start: start, StartIncluded: true}
+	if reverse {
+		// null is the lowest value, thus only null values are less than or equal to it
+		vRange = &Range{End: start, StartIncluded: start == nil, EndIncluded: true}
+	}
+	return idx.IterateRange(vRange, reverse, onValue)
+}
+
+// IterateRanges is like IterateRange, but it visits the entries of multiple ranges through a single iterator.
+// Ranges are sorted and overlapping or adjacent ones are merged, so that each entry is visited at most once.
+func (idx *badgerRangeIndex) IterateRanges(ranges []*Range, reverse bool, onValue func(docId string) error) error {
+	defer idx.lock()()
+
+	keyRanges := make([]*Range, 0, len(ranges))
+	for _, vRange := range ranges {
+		keyRange, err := idx.keyRange(vRange)
+		if err != nil {
+			return err
+		}
+
+		if !keyRange.IsEmpty() {
+			keyRanges = append(keyRanges, keyRange)
+		}
+	}
+
+	keyRanges = mergeRanges(keyRanges)
+	if len(keyRanges) == 0 {
+		return nil
+	}
+
+	it := idx.newRangeIterator(reverse)
+	defer it.Close()
 
+	for i := range keyRanges {
+		vRange := keyRanges[i]
+		if reverse {
+			vRange = keyRanges[len(keyRanges)-1-i]
+		}
+
+		if err := idx.scanRange(it, vRange, reverse, onValue); err != nil {
+			if err == internal.ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (idx *badgerRangeIndex) newRangeIterator(reverse bool) *badger.Iterator {
 	opts := badger.DefaultIteratorOptions
 	opts.PrefetchValues = false
+	opts.Reverse = reverse
+	return idx.txn.NewIterator(opts)
+}
+
+// scanRange seeks it to the beginning of the supplied range of keys, and calls onValue for each of its entries.
+func (idx *badgerRangeIndex) scanRange(it *badger.Iterator, vRange *Range, reverse bool, onValue func(docId string) error) error {
+	startKey, endKey, err := idx.encodeRange(vRange)
+	if err != nil {
+		return err
+	}
 
+	seekPrefix := startKey
 	if reverse {
 		seekPrefix = endKey
-		opts.Reverse = true
+
+		if endKey != nil { // keys of entries equal to the end of the range follow endKey, since they are suffixed by the docId
+			seekPrefix = append(append([]byte{}, endKey...), 255)
+		}
 	}
 
 	if seekPrefix == nil {
@@ -148,9 +514,6 @@ func (idx *badgerRangeIndex) IterateRange(vRange *Range, reverse bool, onValue f
 		}
 	}
 
-	it := idx.txn.NewIterator(opts)
-	defer it.Close()
-
 	it.Seek(seekPrefix)
 
 	if !reverse {
@@ -169,7 +532,10 @@ func (idx *badgerRangeIndex) IterateRange(vRange *Range, reverse bool, onValue f
 	for ; it.ValidForPrefix(prefix); it.Next() {
 		key := it.Item().Key()
 
-		p, docId := extractDocId(key)
+		p, docId, err := extractDocId(key)
+		if err != nil {
+			return err
+		}
 
 		if !reverse {
 			endCmp := bytes.Compare(p, endKey)
@@ -184,9 +550,6 @@ func (idx *badgerRangeIndex) IterateRange(vRange *Range, reverse bool, onValue f
 		}
 
 		if err := onValue(string(docId)); err != nil {
-			if err == internal.ErrStopIteration {
-				return nil
-			}
 			return err
 		}
 	}
@@ -194,8 +557,25 @@ func (idx *badgerRangeIndex) IterateRange(vRange *Range, reverse bool, onValue f
 }
 
 func (idx *badgerRangeIndex) Iterate(reverse bool, onValue func(docId string) error) error {
+	defer idx.lock()()
+
+	return idx.iterate(reverse, false, func(_ interface{}, docId string) error {
+		return onValue(docId)
+	})
+}
+
+// IterateWithValue is like Iterate, but it also supplies onValue with the indexed value of each entry, which is read from the index itself.
+// The value is the original one, even when the entries are ordered by the keys of a KeyFunc (such as CaseInsensitiveKeyFunc).
+func (idx *badgerRangeIndex) IterateWithValue(reverse bool, onValue func(value interface{}, docId string) error) error {
+	defer idx.lock()()
+
+	return idx.iterate(reverse, true, onValue)
+}
+
+func (idx *badgerRangeIndex) iterate(reverse bool, withValue bool, onValue func(value interface{}, docId string) error) error {
 	opts := badger.DefaultIteratorOptions
 	opts.Reverse = reverse
+	opts.PrefetchValues = withValue
 
 	it := idx.txn.NewIterator(opts)
 	defer it.Close()
@@ -212,17 +592,222 @@ func (idx *badgerRangeIndex) Iterate(reverse bool, onValue func(docId string) er
 	for ; it.ValidForPrefix(prefix); it.Next() {
 		key := it.Item().Key()
 
-		_, docId := extractDocId(key)
-		if err := onValue(string(docId)); err != nil {
+		_, docId, err := extractDocId(key)
+		if err != nil {
+			return err
+		}
+
+		var value interface{}
+		if withValue {
+			if value, err = decodeEntryValue(it.Item()); err != nil {
+				return err
+			}
+		}
+
+		if err := onValue(value, string(docId)); err != nil {
+			if err == internal.ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ContainsDoc reports whether the index contains at least one entry for the document with the given id.
+// Since entries are ordered by value, this requires a scan of the index keys, whose cost is linear in the size of the index.
+func (idx *badgerRangeIndex) ContainsDoc(docId string) (bool, error) {
+	defer idx.lock()()
+
+	return containsDoc(idx.txn, idx.getKeyPrefix(), docId)
+}
+
+// Top invokes onValue for the n entries having the highest values, in descending order.
+func (idx *badgerRangeIndex) Top(n int, onValue func(value interface{}, docId string) error) error {
+	defer idx.lock()()
+
+	if n <= 0 {
+		return nil
+	}
+
+	opts := badger.DefaultIteratorOptions
+	opts.Reverse = true
+
+	it := idx.txn.NewIterator(opts)
+	defer it.Close()
+
+	prefix := idx.getKeyPrefix()
+	for it.Seek(append(prefix, 255)); it.ValidForPrefix(prefix) && n > 0; it.Next() {
+		item := it.Item()
+		_, docId, err := extractDocId(item.Key())
+		if err != nil {
+			return err
+		}
+
+		value, err := decodeEntryValue(item)
+		if err != nil {
+			return err
+		}
+
+		if err := onValue(value, string(docId)); err != nil {
 			if err == internal.ErrStopIteration {
 				return nil
 			}
 			return err
 		}
+		n--
 	}
 	return nil
 }
 
+func decodeEntryValue(item *badger.Item) (interface{}, error) {
+	var value interface{}
+	err := item.Value(func(data []byte) error {
+		if len(data) == 0 { // entry created without storing the value
+			return nil
+		}
+
+		var err error
+		value, err = internal.DecodeValue(data)
+		return err
+	})
+	return value, err
+}
+
+// Stats returns the statistics of the entries of the index.
+func (idx *badgerRangeIndex) Stats() (IndexStats, error) {
+	defer idx.lock()()
+
+	return scanStats(idx.txn, idx.getKeyPrefix())
+}
+
+// Count returns the number of entries of the index, through a key-only scan. Documents holding arrays have an entry per element (see Add).
+func (idx *badgerRangeIndex) Count() (int, error) {
+	defer idx.lock()()
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := idx.txn.NewIterator(opts)
+	defer it.Close()
+
+	n := 0
+	prefix := idx.getKeyPrefix()
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		n++
+	}
+	return n, nil
+}
+
+// CountRange returns the number of entries whose value falls within the supplied range, through a key-only scan.
+// Since large integers share their keys with the nearby numbers (see hasExactKey), the count may include the entries
+// of numbers close to a bound of at least 2^53 in magnitude.
+func (idx *badgerRangeIndex) CountRange(vRange *Range) (int, error) {
+	defer idx.lock()()
+
+	n := 0
+	err := idx.iterateRange(vRange, false, func(docId string) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
 func (idx *badgerRangeIndex) Type() IndexType {
 	return IndexSingleField
 }
+
+// CostProbeLimit is the maximum number of index entries visited by EstimateCost.
+var CostProbeLimit = 10000
+
+// EstimateCost estimates the number of index entries a query comparing the field with value through op would touch.
+// Entries are counted through a key-only probe, which stops after CostProbeLimit entries:
+// as a consequence, the estimate is exact when lower than the limit, which is returned otherwise.
+func (idx *badgerRangeIndex) EstimateCost(op Operator, value interface{}) (int, error) {
+	defer idx.lock()()
+
+	normValue, err := internal.Normalize(value)
+	if err != nil {
+		return -1, err
+	}
+
+	vRange, err := op.toRange(normValue)
+	if err != nil {
+		return -1, err
+	}
+
+	n := 0
+	err = idx.iterateRange(vRange, false, func(docId string) error {
+		n++
+		if n >= CostProbeLimit {
+			return internal.ErrStopIteration
+		}
+		return nil
+	})
+	return n, err
+}
+
+// NotEqual invokes onValue, in index order, for the documents having no entry equal to value.
+// The entries matching the value are skipped through a seek, so that documents are never loaded.
+// Each document is reported once, even if it has multiple entries.
+func (idx *badgerRangeIndex) NotEqual(value interface{}, onValue func(docId string) error) error {
+	defer idx.lock()()
+
+	normValue, err := internal.Normalize(value)
+	if err != nil {
+		return err
+	}
+
+	keyValue, err := idx.keyValue(normValue)
+	if err != nil {
+		return err
+	}
+
+	valueKey, err := idx.getKey(keyValue)
+	if err != nil {
+		return err
+	}
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := idx.txn.NewIterator(opts)
+	defer it.Close()
+
+	// documents having a matching entry must be excluded even if they have other entries
+	visited := make(map[string]bool)
+	for it.Seek(valueKey); it.ValidForPrefix(valueKey); it.Next() {
+		_, docId, err := extractDocId(it.Item().Key())
+		if err != nil {
+			return err
+		}
+		visited[string(docId)] = true
+	}
+
+	prefix := idx.getKeyPrefix()
+	for it.Seek(prefix); it.ValidForPrefix(prefix); {
+		key := it.Item().Key()
+		if bytes.HasPrefix(key, valueKey) {
+			it.Seek(append(append([]byte{}, valueKey...), 255))
+			continue
+		}
+
+		_, docId, err := extractDocId(key)
+		if err != nil {
+			return err
+		}
+
+		if !visited[string(docId)] {
+			visited[string(docId)] = true
+
+			if err := onValue(string(docId)); err != nil {
+				if err == internal.ErrStopIteration {
+					return nil
+				}
+				return err
+			}
+		}
+		it.Next()
+	}
+	return nil
+}
@@ -0,0 +1,984 @@
+package index
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ostafen/clover/v2/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func runIndexTest(t *testing.T, test func(t *testing.T, txn *badger.Txn)) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLoggingLevel(badger.ERROR))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, db.Close())
+	}()
+
+	txn := db.NewTransaction(true)
+	defer txn.Discard()
+
+	test(t, txn)
+}
+
+func newTestRangeIndex(txn *badger.Txn) RangeIndex {
+	return CreateBadgerIndex("test", "field", IndexSingleField, txn).(RangeIndex)
+}
+
+func docIdOf(i int) string {
+	return "00000000-0000-0000-0000-0000000000" + string(rune('0'+i/10)) + string(rune('0'+i%10))
+}
+
+func TestRangeIndexTop(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		n := 20
+		for i := 0; i < n; i++ {
+			require.NoError(t, idx.Add(docIdOf(i), int64(i*10), time.Duration(-1)))
+		}
+
+		values := make([]interface{}, 0)
+		docIds := make([]string, 0)
+		err := idx.Top(5, func(value interface{}, docId string) error {
+			values = append(values, value)
+			docIds = append(docIds, docId)
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []interface{}{int64(190), int64(180), int64(170), int64(160), int64(150)}, values)
+		require.Equal(t, []string{docIdOf(19), docIdOf(18), docIdOf(17), docIdOf(16), docIdOf(15)}, docIds)
+
+		count := 0
+		err = idx.Top(n*2, func(value interface{}, docId string) error {
+			count++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, n, count)
+	})
+}
+
+func TestRangeIndexTimePrecision(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		base := time.Date(2022, 8, 1, 10, 30, 0, 0, time.UTC)
+		// insert times differing only by their nanosecond component, in reverse order
+		for i := 9; i >= 0; i-- {
+			require.NoError(t, idx.Add(docIdOf(i), base.Add(time.Duration(i)), time.Duration(-1)))
+		}
+
+		docIds := make([]string, 0)
+		vRange := &Range{Start: base.Add(2), End: base.Add(5), StartIncluded: true, EndIncluded: false}
+		err := idx.IterateRange(vRange, false, func(docId string) error {
+			docIds = append(docIds, docId)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{docIdOf(2), docIdOf(3), docIdOf(4)}, docIds)
+
+		values := make([]interface{}, 0)
+		err = idx.Top(3, func(value interface{}, docId string) error {
+			values = append(values, value)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{base.Add(9), base.Add(8), base.Add(7)}, values)
+	})
+}
+
+func TestRangeIndexMultiValue(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		require.NoError(t, idx.Add(docIdOf(1), MultiValue{"a", "c"}, time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(2), MultiValue{"b"}, time.Duration(-1)))
+
+		docIds := make([]string, 0)
+		err := idx.Iterate(false, func(docId string) error {
+			docIds = append(docIds, docId)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{docIdOf(1), docIdOf(2), docIdOf(1)}, docIds)
+
+		docIds = docIds[:0]
+		err = idx.IterateRange(&Range{Start: "c", End: "c", StartIncluded: true, EndIncluded: true}, false, func(docId string) error {
+			docIds = append(docIds, docId)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{docIdOf(1)}, docIds)
+
+		require.NoError(t, idx.Remove(docIdOf(1), MultiValue{"a", "c"}))
+
+		docIds = docIds[:0]
+		err = idx.Iterate(false, func(docId string) error {
+			docIds = append(docIds, docId)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{docIdOf(2)}, docIds)
+	})
+}
+
+func TestRangeIndexArrayValue(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		require.NoError(t, idx.Add(docIdOf(1), []interface{}{"go", "rust"}, time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(2), "go", time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(3), []interface{}{"c"}, time.Duration(-1)))
+
+		lookup := func(value interface{}) []string {
+			docIds := make([]string, 0)
+			err := idx.IterateRange(&Range{Start: value, End: value, StartIncluded: true, EndIncluded: true}, false, func(docId string) error {
+				docIds = append(docIds, docId)
+				return nil
+			})
+			require.NoError(t, err)
+			return docIds
+		}
+
+		require.Equal(t, []string{docIdOf(1), docIdOf(2)}, lookup("go"))
+		require.Equal(t, []string{docIdOf(1)}, lookup("rust"))
+		require.Equal(t, []string{docIdOf(1)}, lookup([]interface{}{"go", "rust"}))
+
+		require.NoError(t, idx.Remove(docIdOf(1), []interface{}{"go", "rust"}))
+
+		require.Equal(t, []string{docIdOf(2)}, lookup("go"))
+		require.Empty(t, lookup("rust"))
+		require.Empty(t, lookup([]interface{}{"go", "rust"}))
+
+		contains, err := idx.ContainsDoc(docIdOf(1))
+		require.NoError(t, err)
+		require.False(t, contains)
+	})
+}
+
+func TestRangeIndexMultikey(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		isMultikey := func() bool {
+			multikey, err := idx.(MultikeyIndex).Multikey()
+			require.NoError(t, err)
+			return multikey
+		}
+
+		require.NoError(t, idx.Add(docIdOf(1), "go", time.Duration(-1)))
+		require.False(t, isMultikey())
+
+		require.NoError(t, idx.Add(docIdOf(2), []interface{}{"go", "rust"}, time.Duration(-1)))
+		require.True(t, isMultikey())
+
+		// removing the array doesn't clear the marker
+		require.NoError(t, idx.Remove(docIdOf(2), []interface{}{"go", "rust"}))
+		require.True(t, isMultikey())
+
+		require.NoError(t, idx.Drop())
+		require.False(t, isMultikey())
+
+		// a MultiValue makes the index multikey even if it holds a single value
+		require.NoError(t, idx.Add(docIdOf(3), MultiValue{"go"}, time.Duration(-1)))
+		require.True(t, isMultikey())
+	})
+}
+
+func TestRangeIndexKeyFunc(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "field", Type: IndexSingleField, KeyFunc: VersionKeyFunc}, txn).(RangeIndex)
+
+		versions := []string{"1.10.0", "1.9.2", "2.0.0", "1.9.10", "0.1"}
+		for i, v := range versions {
+			require.NoError(t, idx.Add(docIdOf(i), v, time.Duration(-1)))
+		}
+		require.NoError(t, idx.Add(docIdOf(len(versions)), int64(10), time.Duration(-1)))
+
+		docIds := make([]string, 0)
+		err := idx.IterateRange(&Range{Start: "1.9", End: "1.10.0", StartIncluded: true, EndIncluded: true}, false, func(docId string) error {
+			docIds = append(docIds, docId)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{docIdOf(1), docIdOf(3), docIdOf(0)}, docIds)
+
+		docIds = docIds[:0]
+		err = idx.IterateRange(&Range{Start: "1.10.0", End: "1.10.0", StartIncluded: true, EndIncluded: true}, false, func(docId string) error {
+			docIds = append(docIds, docId)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{docIdOf(0)}, docIds)
+
+		require.NoError(t, idx.Remove(docIdOf(0), "1.10.0"))
+
+		values := make([]interface{}, 0)
+		err = idx.Top(2, func(value interface{}, docId string) error {
+			values = append(values, value)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{"2.0.0", "1.9.10"}, values)
+
+		other := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "other", Type: IndexSingleField, KeyFunc: "missing"}, txn)
+		require.ErrorIs(t, other.Add(docIdOf(0), "1.0", time.Duration(-1)), ErrKeyFuncNotExist)
+	})
+}
+
+func TestRangeIndexEstimateCost(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		n := 100
+		for i := 0; i < n; i++ {
+			require.NoError(t, idx.Add(docIdOf(i), int64(i%10), time.Duration(-1)))
+		}
+
+		cost, err := idx.EstimateCost(OpEq, 3)
+		require.NoError(t, err)
+		require.Equal(t, 10, cost)
+
+		cost, err = idx.EstimateCost(OpEq, 100)
+		require.NoError(t, err)
+		require.Zero(t, cost)
+
+		cost, err = idx.EstimateCost(OpLt, 3)
+		require.NoError(t, err)
+		require.Equal(t, 30, cost)
+
+		cost, err = idx.EstimateCost(OpLtEq, 3)
+		require.NoError(t, err)
+		require.Equal(t, 40, cost)
+
+		cost, err = idx.EstimateCost(OpGt, 3)
+		require.NoError(t, err)
+		require.Equal(t, 60, cost)
+
+		cost, err = idx.EstimateCost(OpGtEq, uint8(3))
+		require.NoError(t, err)
+		require.Equal(t, 70, cost)
+
+		defer func(limit int) {
+			CostProbeLimit = limit
+		}(CostProbeLimit)
+
+		CostProbeLimit = 25
+		cost, err = idx.EstimateCost(OpGtEq, 0)
+		require.NoError(t, err)
+		require.Equal(t, CostProbeLimit, cost)
+
+		_, err = idx.EstimateCost(Operator(-1), 0)
+		require.ErrorIs(t, err, ErrInvalidOperator)
+	})
+}
+
+func TestRangeIndexEqualValuesOrder(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		docIds := []string{"c", "a", "ab", "b", "abc", "aa", docIdOf(1), docIdOf(0)}
+		for _, docId := range docIds {
+			require.NoError(t, idx.Add(docId, "same", time.Duration(-1)))
+		}
+		require.NoError(t, idx.Add("z", "other", time.Duration(-1)))
+
+		sorted := append([]string{}, docIds...)
+		sort.Strings(sorted)
+
+		collect := func(run func(onValue func(docId string) error) error) []string {
+			res := make([]string, 0)
+			require.NoError(t, run(func(docId string) error {
+				res = append(res, docId)
+				return nil
+			}))
+			return res
+		}
+
+		for i := 0; i < 2; i++ {
+			ids := collect(func(onValue func(docId string) error) error {
+				return idx.Iterate(false, onValue)
+			})
+			require.Equal(t, append([]string{"z"}, sorted...), ids)
+
+			ids = collect(func(onValue func(docId string) error) error {
+				return idx.IterateRange(&Range{Start: "same", End: "same", StartIncluded: true, EndIncluded: true}, false, onValue)
+			})
+			require.Equal(t, sorted, ids)
+
+			ids = collect(func(onValue func(docId string) error) error {
+				return idx.IterateRange(&Range{Start: "same", End: "same", StartIncluded: true, EndIncluded: true}, true, onValue)
+			})
+
+			reversed := make([]string, 0, len(sorted))
+			for j := len(sorted) - 1; j >= 0; j-- {
+				reversed = append(reversed, sorted[j])
+			}
+			require.Equal(t, reversed, ids)
+		}
+	})
+}
+
+func TestRangeIndexNotEqual(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		statuses := []string{"active", "archived", "draft"}
+
+		expected := make([]string, 0)
+		for i := 0; i < 30; i++ {
+			status := statuses[i%len(statuses)]
+			require.NoError(t, idx.Add(docIdOf(i), status, time.Duration(-1)))
+
+			if status != "archived" {
+				expected = append(expected, docIdOf(i))
+			}
+		}
+
+		// multikey entries: the first document also has a matching entry, while the second has two non-matching ones
+		require.NoError(t, idx.Add(docIdOf(30), MultiValue{"active", "archived"}, time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(31), MultiValue{"active", "draft"}, time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(32), nil, time.Duration(-1)))
+		expected = append(expected, docIdOf(31), docIdOf(32))
+
+		docIds := make([]string, 0)
+		err := idx.NotEqual("archived", func(docId string) error {
+			docIds = append(docIds, docId)
+			return nil
+		})
+		require.NoError(t, err)
+		require.ElementsMatch(t, expected, docIds)
+
+		docIds = docIds[:0]
+		err = idx.NotEqual("missing", func(docId string) error {
+			docIds = append(docIds, docId)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, docIds, 33)
+
+		n := 0
+		err = idx.NotEqual("archived", func(docId string) error {
+			n++
+			if n == 5 {
+				return internal.ErrStopIteration
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 5, n)
+	})
+}
+
+func TestSortDocIds(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		values := make(map[string]int64)
+		for i := 0; i < 50; i++ {
+			v := int64((i * 37) % 50)
+			values[docIdOf(i)] = v
+			require.NoError(t, idx.Add(docIdOf(i), v, time.Duration(-1)))
+		}
+
+		ids := make([]string, 0)
+		for i := 0; i < 50; i += 3 {
+			ids = append(ids, docIdOf(i))
+		}
+		ids = append(ids, "missing-2", "missing-1")
+
+		sorted, err := SortDocIds(ids, idx, false)
+		require.NoError(t, err)
+
+		expected := append([]string{}, ids[:len(ids)-2]...)
+		sort.Slice(expected, func(i, j int) bool {
+			return values[expected[i]] < values[expected[j]]
+		})
+		require.Equal(t, append(expected, "missing-2", "missing-1"), sorted)
+
+		sorted, err = SortDocIds(ids, idx, true)
+		require.NoError(t, err)
+
+		sort.SliceStable(expected, func(i, j int) bool {
+			return values[expected[i]] > values[expected[j]]
+		})
+		require.Equal(t, append(expected, "missing-2", "missing-1"), sorted)
+
+		sorted, err = SortDocIds(nil, idx, false)
+		require.NoError(t, err)
+		require.Empty(t, sorted)
+	})
+}
+
+func TestIterateContext(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+		for i := 0; i < 500; i++ {
+			require.NoError(t, idx.Add(docIdOf(i), int64(i), time.Duration(-1)))
+		}
+
+		n := 0
+		err := IterateContext(context.Background(), idx, false, func(docId string) error {
+			n++
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 500, n)
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		n = 0
+		err = IterateContext(ctx, idx, true, func(docId string) error {
+			n++
+			if n == 10 {
+				cancel()
+			}
+			return nil
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		require.Less(t, n, 10+contextCheckInterval)
+
+		n = 0
+		err = IterateContext(ctx, idx, false, func(docId string) error {
+			n++
+			return nil
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		require.Zero(t, n)
+	})
+}
+
+func TestRangeIndexLocking(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "field", Type: IndexSingleField}, txn, WithLocking()).(RangeIndex)
+
+		n := 50
+		errs := make(chan error, n*3)
+
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				errs <- idx.Add(docIdOf(i), int64(i), time.Duration(-1))
+				if i%2 == 0 {
+					errs <- idx.Remove(docIdOf(i), int64(i))
+				}
+				errs <- idx.Iterate(false, func(docId string) error { return nil })
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		docIds := make([]string, 0)
+		err := idx.Iterate(false, func(docId string) error {
+			docIds = append(docIds, docId)
+			return nil
+		})
+		require.NoError(t, err)
+
+		expected := make([]string, 0)
+		for i := 1; i < n; i += 2 {
+			expected = append(expected, docIdOf(i))
+		}
+		require.Equal(t, expected, docIds)
+	})
+}
+
+func TestRangeIndexIterateRanges(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		n := 100
+		for i := 0; i < n; i++ {
+			require.NoError(t, idx.Add(docIdOf(i), int64(i), time.Duration(-1)))
+		}
+
+		docIdsOf := func(values ...int) []string {
+			ids := make([]string, 0, len(values))
+			for _, v := range values {
+				ids = append(ids, docIdOf(v))
+			}
+			return ids
+		}
+
+		iterate := func(ranges []*Range, reverse bool) []string {
+			docIds := make([]string, 0)
+			err := idx.IterateRanges(ranges, reverse, func(docId string) error {
+				docIds = append(docIds, docId)
+				return nil
+			})
+			require.NoError(t, err)
+			return docIds
+		}
+
+		// disjoint ranges, supplied out of order
+		disjoint := []*Range{
+			{Start: int64(60), End: int64(62), StartIncluded: true, EndIncluded: true},
+			{Start: int64(18), End: int64(20), StartIncluded: true, EndIncluded: false},
+		}
+		require.Equal(t, docIdsOf(18, 19, 60, 61, 62), iterate(disjoint, false))
+		require.Equal(t, docIdsOf(62, 61, 60, 19, 18), iterate(disjoint, true))
+
+		// overlapping ranges
+		overlapping := []*Range{
+			{Start: int64(10), End: int64(14), StartIncluded: true, EndIncluded: true},
+			{Start: int64(12), End: int64(16), StartIncluded: false, EndIncluded: false},
+			{Start: int64(11), End: int64(13), StartIncluded: true, EndIncluded: true},
+		}
+		require.Equal(t, docIdsOf(10, 11, 12, 13, 14, 15), iterate(overlapping, false))
+
+		// adjacent ranges, sharing a bound included by only one of them
+		adjacent := []*Range{
+			{Start: int64(30), End: int64(32), StartIncluded: true, EndIncluded: false},
+			{Start: int64(32), End: int64(34), StartIncluded: true, EndIncluded: false},
+			{Start: int64(34), End: int64(35), StartIncluded: false, EndIncluded: true},
+		}
+		require.Equal(t, docIdsOf(30, 31, 32, 33, 35), iterate(adjacent, false))
+		require.Equal(t, docIdsOf(35, 33, 32, 31, 30), iterate(adjacent, true))
+
+		// unbounded ranges
+		unbounded := []*Range{
+			{End: int64(2), EndIncluded: true},
+			{Start: int64(97), StartIncluded: false},
+			{Start: int64(1), End: int64(3)},
+		}
+		require.Equal(t, docIdsOf(0, 1, 2, 98, 99), iterate(unbounded, false))
+		require.Equal(t, docIdsOf(99, 98, 2, 1, 0), iterate(unbounded, true))
+
+		// empty ranges are ignored
+		empty := []*Range{
+			{Start: int64(5), End: int64(4), StartIncluded: true, EndIncluded: true},
+			{Start: int64(5), End: int64(5)},
+		}
+		require.Empty(t, iterate(empty, false))
+		require.Empty(t, iterate(nil, false))
+
+		docIds := make([]string, 0)
+		err := idx.IterateRanges(disjoint, false, func(docId string) error {
+			docIds = append(docIds, docId)
+			if len(docIds) == 3 {
+				return internal.ErrStopIteration
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, docIdsOf(18, 19, 60), docIds)
+	})
+}
+
+func TestRangeIndexIterateFrom(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		for i := 0; i < 10; i++ {
+			require.NoError(t, idx.Add(docIdOf(i), int64(i), time.Duration(-1)))
+		}
+		require.NoError(t, idx.Add(docIdOf(10), nil, time.Duration(-1)))
+
+		iterate := func(start interface{}, reverse bool) []string {
+			docIds := make([]string, 0)
+			err := idx.IterateFrom(start, reverse, func(docId string) error {
+				docIds = append(docIds, docId)
+				return nil
+			})
+			require.NoError(t, err)
+			return docIds
+		}
+
+		require.Equal(t, []string{docIdOf(7), docIdOf(8), docIdOf(9)}, iterate(int64(7), false))
+		require.Equal(t, []string{docIdOf(2), docIdOf(1), docIdOf(0), docIdOf(10)}, iterate(int64(2), true))
+		require.Equal(t, []string{docIdOf(8), docIdOf(9)}, iterate(7.5, false))
+		require.Empty(t, iterate(int64(10), false))
+
+		require.Len(t, iterate(nil, false), 11)
+		require.Equal(t, []string{docIdOf(10)}, iterate(nil, true))
+	})
+}
+
+func TestRangeIndexStats(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn).(StatsIndex)
+
+		stats, err := idx.Stats()
+		require.NoError(t, err)
+		require.Equal(t, IndexStats{}, stats)
+
+		for i := 0; i < 10; i++ {
+			require.NoError(t, idx.Add(docIdOf(i), int64(i%4), time.Duration(-1)))
+		}
+		require.NoError(t, idx.Add(docIdOf(10), MultiValue{"a", "b"}, time.Duration(-1)))
+
+		// entries of an index on a field having the indexed one as a prefix are not counted
+		other := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "field2", Type: IndexSingleField}, txn)
+		require.NoError(t, other.Add(docIdOf(11), int64(100), time.Duration(-1)))
+
+		stats, err = idx.Stats()
+		require.NoError(t, err)
+		require.Equal(t, 12, stats.Entries)
+		require.Equal(t, 6, stats.Distinct)
+
+		minKey, err := idx.(*badgerRangeIndex).getKey(int64(0))
+		require.NoError(t, err)
+		require.Equal(t, minKey, stats.MinKey)
+
+		maxKey, err := idx.(*badgerRangeIndex).getKey("b")
+		require.NoError(t, err)
+		require.Equal(t, maxKey, stats.MaxKey)
+	})
+}
+
+func TestRangeIndexCount(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		n, err := idx.Count()
+		require.NoError(t, err)
+		require.Zero(t, n)
+
+		for i := 0; i < 10; i++ {
+			require.NoError(t, idx.Add(docIdOf(i), int64(i), time.Duration(-1)))
+		}
+		require.NoError(t, idx.Add(docIdOf(10), MultiValue{"a", "b"}, time.Duration(-1)))
+
+		other := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "field2", Type: IndexSingleField}, txn)
+		require.NoError(t, other.Add(docIdOf(11), int64(100), time.Duration(-1)))
+
+		n, err = idx.Count()
+		require.NoError(t, err)
+		require.Equal(t, 12, n)
+
+		n, err = idx.CountRange(&Range{Start: int64(2), End: int64(5), StartIncluded: true})
+		require.NoError(t, err)
+		require.Equal(t, 3, n)
+
+		n, err = idx.CountRange(&Range{Start: int64(7), StartIncluded: true, End: int64(7), EndIncluded: true})
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		n, err = idx.CountRange(&Range{Start: "a", StartIncluded: true})
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+
+		n, err = idx.CountRange(&Range{Start: int64(5), End: int64(2)})
+		require.NoError(t, err)
+		require.Zero(t, n)
+	})
+}
+
+func TestRangeIndexContainsDoc(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		for i := 0; i < 10; i++ {
+			require.NoError(t, idx.Add(docIdOf(i), int64(i%3), time.Duration(-1)))
+		}
+		require.NoError(t, idx.Add(docIdOf(10), MultiValue{int64(1), int64(2)}, time.Duration(-1)))
+		require.NoError(t, idx.Remove(docIdOf(5), int64(2)))
+
+		for i := 0; i <= 10; i++ {
+			contains, err := idx.ContainsDoc(docIdOf(i))
+			require.NoError(t, err)
+			require.Equal(t, i != 5, contains)
+		}
+
+		contains, err := idx.ContainsDoc(docIdOf(11))
+		require.NoError(t, err)
+		require.False(t, contains)
+
+		require.NoError(t, idx.Remove(docIdOf(10), MultiValue{int64(1)}))
+		contains, err = idx.ContainsDoc(docIdOf(10))
+		require.NoError(t, err)
+		require.True(t, contains)
+	})
+}
+
+func TestRangeIndexRemoveByDoc(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		for i := 0; i < 10; i++ {
+			require.NoError(t, idx.Add(docIdOf(i), int64(i%3), time.Duration(-1)))
+		}
+		require.NoError(t, idx.Add(docIdOf(10), []interface{}{"a", "b"}, time.Duration(-1)))
+
+		// entries of an index on a field having the indexed one as a prefix are left untouched
+		other := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "field2", Type: IndexSingleField}, txn)
+		require.NoError(t, other.Add(docIdOf(10), int64(100), time.Duration(-1)))
+
+		require.NoError(t, idx.RemoveByDoc(docIdOf(10)))
+		require.NoError(t, idx.RemoveByDoc(docIdOf(4)))
+		require.NoError(t, idx.RemoveByDoc("missing"))
+
+		for i := 0; i <= 10; i++ {
+			contains, err := idx.ContainsDoc(docIdOf(i))
+			require.NoError(t, err)
+			require.Equal(t, i != 4 && i != 10, contains)
+		}
+
+		n, err := idx.Count()
+		require.NoError(t, err)
+		require.Equal(t, 9, n)
+
+		contains, err := other.ContainsDoc(docIdOf(10))
+		require.NoError(t, err)
+		require.True(t, contains)
+	})
+}
+
+func TestRangeIndexDocIdTooLong(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		docId := strings.Repeat("a", math.MaxUint16+1)
+		require.ErrorIs(t, idx.Add(docId, int64(1), time.Duration(-1)), ErrDocIdTooLong)
+
+		require.NoError(t, idx.Add(docId[:1024], int64(1), time.Duration(-1)))
+
+		contains, err := idx.ContainsDoc(docId[:1024])
+		require.NoError(t, err)
+		require.True(t, contains)
+	})
+}
+
+func TestRangeIndexInvalidKey(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+		require.NoError(t, idx.Add(docIdOf(0), int64(1), time.Duration(-1)))
+
+		// a key written with the legacy layout, which lacks the trailing id length
+		key := append(idx.(*badgerRangeIndex).getKeyPrefix(), 0xff)
+		require.NoError(t, txn.Set(key, nil))
+
+		err := idx.Iterate(false, func(docId string) error { return nil })
+		require.ErrorIs(t, err, ErrInvalidKey)
+
+		_, err = idx.ContainsDoc(docIdOf(1))
+		require.ErrorIs(t, err, ErrInvalidKey)
+	})
+}
+
+func TestRangeIndexPrefixedFields(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		a := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "a", Type: IndexSingleField}, txn).(RangeIndex)
+		ab := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "ab", Type: IndexSingleField}, txn).(RangeIndex)
+
+		for i := 0; i < 5; i++ {
+			require.NoError(t, a.Add(docIdOf(i), int64(i), time.Duration(-1)))
+			require.NoError(t, ab.Add(docIdOf(i+5), int64(100+i), time.Duration(-1)))
+		}
+
+		collect := func(idx RangeIndex, reverse bool) []string {
+			docIds := make([]string, 0)
+			require.NoError(t, idx.Iterate(reverse, func(docId string) error {
+				docIds = append(docIds, docId)
+				return nil
+			}))
+			return docIds
+		}
+
+		require.Len(t, collect(a, false), 5)
+		require.Len(t, collect(a, true), 5)
+
+		contains, err := a.ContainsDoc(docIdOf(5))
+		require.NoError(t, err)
+		require.False(t, contains)
+
+		max, err := a.Aggregate(AggMax)
+		require.NoError(t, err)
+		require.Equal(t, float64(4), max)
+
+		var top []interface{}
+		require.NoError(t, a.Top(1, func(value interface{}, docId string) error {
+			top = append(top, value)
+			return nil
+		}))
+		require.Equal(t, []interface{}{int64(4)}, top)
+
+		n := 0
+		require.NoError(t, a.NotEqual(int64(0), func(docId string) error {
+			n++
+			return nil
+		}))
+		require.Equal(t, 4, n)
+
+		n, err = a.CountRange(&Range{Start: int64(0), StartIncluded: true})
+		require.NoError(t, err)
+		require.Equal(t, 5, n)
+
+		require.NoError(t, a.Drop())
+		require.Empty(t, collect(a, false))
+		require.Len(t, collect(ab, false), 5)
+	})
+}
+
+func TestRangeIndexAggregate(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := newTestRangeIndex(txn)
+
+		sum, err := idx.Aggregate(AggSum)
+		require.NoError(t, err)
+		require.Equal(t, 0.0, sum)
+
+		avg, err := idx.Aggregate(AggAvg)
+		require.NoError(t, err)
+		require.True(t, math.IsNaN(avg))
+
+		values := []interface{}{int64(-3), 2.5, int64(10), uint64(7), int64(0), 4.25}
+
+		expectedSum := 0.0
+		expectedMin, expectedMax := math.Inf(1), math.Inf(-1)
+		for i, v := range values {
+			require.NoError(t, idx.Add(docIdOf(i), v, time.Duration(-1)))
+
+			x, err := toFloat64(v)
+			require.NoError(t, err)
+
+			expectedSum += x
+			expectedMin = math.Min(expectedMin, x)
+			expectedMax = math.Max(expectedMax, x)
+		}
+		require.NoError(t, idx.Add(docIdOf(len(values)), nil, time.Duration(-1)))
+
+		sum, err = idx.Aggregate(AggSum)
+		require.NoError(t, err)
+		require.Equal(t, expectedSum, sum)
+
+		avg, err = idx.Aggregate(AggAvg)
+		require.NoError(t, err)
+		require.Equal(t, expectedSum/float64(len(values)), avg)
+
+		min, err := idx.Aggregate(AggMin)
+		require.NoError(t, err)
+		require.Equal(t, expectedMin, min)
+
+		max, err := idx.Aggregate(AggMax)
+		require.NoError(t, err)
+		require.Equal(t, expectedMax, max)
+
+		_, err = idx.Aggregate(AggregateFunc(10))
+		require.ErrorIs(t, err, ErrInvalidAggregateFunc)
+
+		// arrays are aggregated through their elements
+		require.NoError(t, idx.Add(docIdOf(19), []interface{}{int64(1), 2.5}, time.Duration(-1)))
+		sum, err = idx.Aggregate(AggSum)
+		require.NoError(t, err)
+		require.Equal(t, expectedSum+3.5, sum)
+
+		require.NoError(t, idx.Add(docIdOf(20), "abc", time.Duration(-1)))
+		_, err = idx.Aggregate(AggSum)
+		require.ErrorIs(t, err, ErrNotNumeric)
+	})
+}
+
+func TestRangeIndexCaseInsensitive(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "field", Type: IndexSingleField, KeyFunc: CaseInsensitiveKeyFunc}, txn).(RangeIndex)
+
+		names := []string{"bob", "Alice", "carol", "ALICE", "Bob", "dave"}
+		for i, name := range names {
+			require.NoError(t, idx.Add(docIdOf(i), name, time.Duration(-1)))
+		}
+
+		values := make([]interface{}, 0)
+		docIds := make([]string, 0)
+		err := idx.IterateWithValue(false, func(value interface{}, docId string) error {
+			values = append(values, value)
+			docIds = append(docIds, docId)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{"Alice", "ALICE", "bob", "Bob", "carol", "dave"}, values)
+		require.Equal(t, []string{docIdOf(1), docIdOf(3), docIdOf(0), docIdOf(4), docIdOf(2), docIdOf(5)}, docIds)
+
+		values = values[:0]
+		err = idx.IterateWithValue(true, func(value interface{}, docId string) error {
+			values = append(values, value)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{"dave", "carol", "Bob", "bob", "ALICE", "Alice"}, values)
+
+		docIds = docIds[:0]
+		err = idx.IterateRange(&Range{Start: "BOB", End: "BOB", StartIncluded: true, EndIncluded: true}, false, func(docId string) error {
+			docIds = append(docIds, docId)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{docIdOf(0), docIdOf(4)}, docIds)
+	})
+}
+
+func TestRangeIndexUnique(t *testing.T) {
+	runIndexTest(t, func(t *testing.T, txn *badger.Txn) {
+		idx := CreateBadgerIndexWithInfo("test", IndexInfo{Field: "email", Type: IndexSingleField, Unique: true, KeyFunc: CaseInsensitiveKeyFunc}, txn)
+
+		require.NoError(t, idx.Add(docIdOf(0), "a@example.com", time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(1), "ab@example.com", time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(0), "a@example.com", time.Duration(-1))) // re-adding the same document is allowed
+
+		err := idx.Add(docIdOf(2), "A@example.com", time.Duration(-1))
+		require.ErrorIs(t, err, ErrDuplicateKey)
+		require.Contains(t, err.Error(), docIdOf(0))
+
+		require.ErrorIs(t, idx.Add(docIdOf(2), MultiValue{"c@example.com", "ab@example.com"}, time.Duration(-1)), ErrDuplicateKey)
+
+		// null values are not checked
+		require.NoError(t, idx.Add(docIdOf(3), nil, time.Duration(-1)))
+		require.NoError(t, idx.Add(docIdOf(4), nil, time.Duration(-1)))
+
+		require.NoError(t, idx.Remove(docIdOf(0), "a@example.com"))
+		require.NoError(t, idx.Add(docIdOf(2), "A@example.com", time.Duration(-1)))
+	})
+}
+
+func TestRangeIndexUniqueConflict(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLoggingLevel(badger.ERROR))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, db.Close())
+	}()
+
+	info := IndexInfo{Field: "email", Type: IndexSingleField, Unique: true}
+
+	// both transactions see no entry for the value, thus only the first commit can succeed
+	txn1 := db.NewTransaction(true)
+	defer txn1.Discard()
+
+	txn2 := db.NewTransaction(true)
+	defer txn2.Discard()
+
+	require.NoError(t, CreateBadgerIndexWithInfo("test", info, txn1).Add(docIdOf(0), "a@example.com", time.Duration(-1)))
+	require.NoError(t, CreateBadgerIndexWithInfo("test", info, txn2).Add(docIdOf(1), "a@example.com", time.Duration(-1)))
+
+	require.NoError(t, txn1.Commit())
+	require.ErrorIs(t, txn2.Commit(), badger.ErrConflict)
+
+	// the marker is removed along with the entry, as well as when dropping the index
+	txn := db.NewTransaction(true)
+	defer txn.Discard()
+
+	idx := CreateBadgerIndexWithInfo("test", info, txn)
+	require.NoError(t, idx.Add(docIdOf(1), "b@example.com", time.Duration(-1)))
+	require.NoError(t, idx.Remove(docIdOf(0), "a@example.com"))
+	require.NoError(t, idx.RemoveByDoc(docIdOf(1)))
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	prefix := []byte("c:test;u:email;")
+	it.Seek(prefix)
+	require.False(t, it.ValidForPrefix(prefix))
+	it.Close()
+}
@@ -17,6 +17,8 @@ func getEncodeValue(value interface{}) interface{} {
 		return uint64(util.BoolToInt(vType))
 	case time.Time:
 		return uint64(vType.UnixNano())
+	case []byte:
+		return string(vType)
 	}
 	return value
 }
@@ -48,6 +50,19 @@ func OrderedCode(buf []byte, v interface{}) ([]byte, error) {
 	return orderedCode(buf, v, false)
 }
 
+// OrderedCodeTuple appends the encodings of the supplied values, each prefixed by its type, so that the encoded tuples
+// are ordered like their values compared one at a time. The encoding of a tuple is a prefix of the encoding of any longer tuple
+// starting with the same values.
+func OrderedCodeTuple(buf []byte, values []interface{}) ([]byte, error) {
+	for _, v := range values {
+		var err error
+		if buf, err = orderedCode(buf, v, true); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
 func orderedCode(buf []byte, v interface{}, includeType bool) ([]byte, error) {
 	switch vType := v.(type) {
 	case map[string]interface{}:
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"bytes"
 	"math/big"
 	"reflect"
 	"strings"
@@ -17,6 +18,7 @@ var typesMap map[string]int = map[string]int{
 	"slice":  4,
 	"bool":   5,
 	"time":   6,
+	"binary": 7,
 }
 
 func TypeName(v interface{}) string {
@@ -29,6 +31,8 @@ func TypeName(v interface{}) string {
 		return "null"
 	case time.Time:
 		return "time"
+	case []byte:
+		return "binary"
 	}
 
 	return reflect.TypeOf(v).Kind().String()
@@ -61,18 +65,37 @@ func compareNumbers(v1 interface{}, v2 interface{}) int {
 		return big.NewFloat(v1Float).Cmp(big.NewFloat(v2Float))
 	}
 
-	_, isV1Int64 := v1.(int64)
-	_, isV2Int64 := v2.(int64)
+	return compareIntegers(v1, v2)
+}
+
+// compareIntegers compares two integers, each of which is either an int64 or a uint64, without overflowing.
+func compareIntegers(v1 interface{}, v2 interface{}) int {
+	u1, isV1Uint := v1.(uint64)
+	u2, isV2Uint := v2.(uint64)
+
+	switch {
+	case isV1Uint && isV2Uint:
+		return compareOrdered(u1 > u2, u1 < u2)
+	case isV1Uint:
+		i2 := v2.(int64)
+		return compareOrdered(i2 < 0 || u1 > uint64(i2), i2 >= 0 && u1 < uint64(i2))
+	case isV2Uint:
+		return -compareIntegers(v2, v1)
+	}
+
+	i1, i2 := v1.(int64), v2.(int64)
+	return compareOrdered(i1 > i2, i1 < i2)
+}
 
-	if isV1Int64 || isV2Int64 {
-		v1Int64 := util.ToInt64(v1)
-		v2Int64 := util.ToInt64(v2)
-		return int(v1Int64 - v2Int64)
+func compareOrdered(greater, less bool) int {
+	if greater {
+		return 1
 	}
 
-	v1Uint64 := v1.(uint64)
-	v2Uint64 := v2.(uint64)
-	return int(v1Uint64 - v2Uint64)
+	if less {
+		return -1
+	}
+	return 0
 }
 
 func Compare(v1 interface{}, v2 interface{}) int {
@@ -102,6 +125,11 @@ func Compare(v1 interface{}, v2 interface{}) int {
 		return int(v1Time.UnixNano() - v2Time.UnixNano())
 	}
 
+	v1Bytes, isBytes := v1.([]byte)
+	if isBytes {
+		return bytes.Compare(v1Bytes, v2.([]byte))
+	}
+
 	v1Slice, isSlice := v1.([]interface{})
 	if isSlice {
 		return compareSlices(v1Slice, v2.([]interface{}))
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -27,6 +28,22 @@ func TestCompareNumbers(t *testing.T) {
 	require.Zero(t, Compare(int64(10), float64(10.0)))
 }
 
+func TestCompareIntegerBoundaries(t *testing.T) {
+	maxInt := int64(math.MaxInt64)
+	aboveMaxInt := uint64(math.MaxInt64) + 1
+
+	require.Negative(t, Compare(maxInt, aboveMaxInt))
+	require.Positive(t, Compare(aboveMaxInt, maxInt))
+	require.Positive(t, Compare(aboveMaxInt, int64(-1)))
+	require.Negative(t, Compare(int64(math.MinInt64), uint64(0)))
+	require.Zero(t, Compare(uint64(math.MaxInt64), maxInt))
+	require.Positive(t, Compare(uint64(math.MaxUint64), aboveMaxInt))
+
+	// differences exceeding the range of int do not overflow
+	require.Positive(t, Compare(maxInt, int64(-1)))
+	require.Negative(t, Compare(int64(math.MinInt64), maxInt))
+}
+
 func TestCompareBooleans(t *testing.T) {
 	require.Zero(t, Compare(true, true))
 	require.Negative(t, Compare(false, true))
@@ -79,3 +96,10 @@ func TestCompareObjects(t *testing.T) {
 	require.Positive(t, Compare(b, c))
 	require.Positive(t, Compare(b, d))
 }
+
+func TestCompareBinary(t *testing.T) {
+	require.Zero(t, Compare([]byte("clover"), []byte("clover")))
+	require.Negative(t, Compare([]byte("c"), []byte("clover")))
+	require.Positive(t, Compare([]byte("clover"), []byte("c")))
+	require.Negative(t, Compare([]interface{}{}, []byte("clover")))
+}
@@ -1,10 +1,18 @@
 package internal
 
 import (
+	"bytes"
+	"context"
+	"encoding"
 	"encoding/json"
 	"fmt"
+	"math"
+	"net/url"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/vmihailenco/msgpack/v5"
@@ -14,11 +22,17 @@ type Value struct {
 	V interface{}
 }
 
-func processStructTag(tagStr string) (string, bool) {
+// processStructTag parses a struct tag, returning the field name, whether the field is omitted if empty,
+// and whether the field must be skipped. As in encoding/json, a tag of "-" skips the field, while "-," names it "-".
+func processStructTag(tagStr string) (string, bool, bool) {
+	if tagStr == "-" {
+		return "", false, true
+	}
+
 	tags := strings.Split(tagStr, ",")
 	name := tags[0] // when tagStr is "", tags[0] will also be ""
 	omitempty := len(tags) > 1 && tags[1] == "omitempty"
-	return name, omitempty
+	return name, omitempty, false
 }
 
 func isEmptyValue(v reflect.Value) bool {
@@ -39,53 +53,319 @@ func isEmptyValue(v reflect.Value) bool {
 	return false
 }
 
-func normalizeStruct(structValue reflect.Value) (map[string]interface{}, error) {
-	m := make(map[string]interface{})
-	for i := 0; i < structValue.NumField(); i++ {
-		fieldType := structValue.Type().Field(i)
-		fieldValue := structValue.Field(i)
+// NormalizeOptions allows to restrict the values accepted by normalization.
+// The zero value accepts every supported type.
+type NormalizeOptions struct {
+	DisallowFloat    bool // reject floating point numbers
+	DisallowNil      bool // reject nil values (including nil pointers)
+	MaxStringLen     int  // if positive, reject strings longer than MaxStringLen bytes
+	DisallowStringer bool // reject values of unsupported types, rather than storing the result of their String method
+}
 
-		if fieldType.PkgPath == "" {
-			fieldName := fieldType.Name
+var stringerFallback int32 = 1
+
+// SetStringerFallback sets whether values of unsupported types implementing fmt.Stringer are normalized to the result of their String method,
+// which is the default. When disabled, they are rejected by every normalization, as with NormalizeOptions.DisallowStringer.
+func SetStringerFallback(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&stringerFallback, v)
+}
+
+// StringerFallback reports whether the fmt.Stringer fallback is enabled (see SetStringerFallback).
+func StringerFallback() bool {
+	return atomic.LoadInt32(&stringerFallback) != 0
+}
+
+type normalizer struct {
+	opts *NormalizeOptions
+
+	// visiting holds the maps, slices and pointers currently being normalized, which are the ancestors of the current value:
+	// finding one of them again means that the value contains itself.
+	visiting map[visitKey]bool
+}
+
+// visitKey identifies a map, slice or pointer. The type and the length are needed to tell apart values sharing the same address,
+// such as a struct and its first field, or a slice and its subslices.
+type visitKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// enter marks the supplied map, slice or pointer as being normalized, returning the function unmarking it.
+// It returns ErrCyclicReference if the value is already being normalized.
+func (n *normalizer) enter(rv reflect.Value) (func(), error) {
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Ptr:
+		if rv.IsNil() {
+			return func() {}, nil
+		}
+	default:
+		return func() {}, nil
+	}
+
+	key := visitKey{ptr: rv.Pointer(), typ: rv.Type()}
+	if rv.Kind() == reflect.Slice {
+		key.len = rv.Len()
+	}
+
+	if n.visiting[key] {
+		return nil, fmt.Errorf("%w: %s", ErrCyclicReference, rv.Type())
+	}
+
+	if n.visiting == nil {
+		n.visiting = make(map[visitKey]bool)
+	}
+	n.visiting[key] = true
+	return func() { delete(n.visiting, key) }, nil
+}
+
+// structField holds the information needed to normalize an exported struct field.
+type structField struct {
+	index     int
+	name      string
+	omitempty bool
+	anonymous bool
+	tagged    bool // the name is set by the struct tag
+}
+
+// structTag is the name of the struct tag specifying the names and options of struct fields.
+var structTag = "clover"
+
+// SetStructTag sets the name of the struct tag read by normalization and conversion, which is "clover" by default.
+// This allows to reuse the tags of other libraries, such as "json" or "bson", which follow the same "name,omitempty" format.
+// It is not safe to call SetStructTag concurrently with any encoding operation.
+func SetStructTag(name string) {
+	structTag = name
+}
+
+type structFieldsKey struct {
+	structType reflect.Type
+	tag        string
+}
+
+// structFieldsCache maps each struct type (and tag name) to its []structField, so that tags are parsed only once per type.
+var structFieldsCache sync.Map
 
-			cloverTag := fieldType.Tag.Get("clover")
-			name, omitempty := processStructTag(cloverTag)
+func getStructFields(structType reflect.Type) []structField {
+	key := structFieldsKey{structType: structType, tag: structTag}
+	if fields, ok := structFieldsCache.Load(key); ok {
+		return fields.([]structField)
+	}
+
+	fields := make([]structField, 0, structType.NumField())
+	for i := 0; i < structType.NumField(); i++ {
+		fieldType := structType.Field(i)
+
+		name, omitempty, skip := processStructTag(fieldType.Tag.Get(structTag))
+		if fieldType.PkgPath == "" && !skip {
+			fieldName := fieldType.Name
 			if name != "" {
 				fieldName = name
 			}
 
-			if !omitempty || !isEmptyValue(fieldValue) {
-				normalized, err := Normalize(structValue.Field(i).Interface())
+			fields = append(fields, structField{
+				index:     i,
+				name:      fieldName,
+				omitempty: omitempty,
+				anonymous: fieldType.Anonymous,
+				tagged:    name != "",
+			})
+		}
+	}
+
+	cached, _ := structFieldsCache.LoadOrStore(key, fields)
+	return cached.([]structField)
+}
+
+func (n *normalizer) normalizeStruct(structValue reflect.Value) (map[string]interface{}, error) {
+	return n.normalizeStructFields(structValue, nil)
+}
+
+// structEntry is a field of a struct being normalized, either declared directly in the struct or promoted from an embedded struct.
+type structEntry struct {
+	name    string
+	value   interface{}
+	depth   int  // the number of embedded structs the field is promoted through
+	tagged  bool // the name is set by the struct tag
+	omitted bool // omitted because empty, the field still shadows the fields with the same name promoted from deeper structs
+}
+
+// normalizeStructFields normalizes a struct to a map. If order is not nil, the names of the fields of the map
+// are appended to it in declaration order, where the fields promoted from embedded structs take the place of the embedded struct.
+func (n *normalizer) normalizeStructFields(structValue reflect.Value, order *[]string) (map[string]interface{}, error) {
+	entries, err := n.appendStructEntries(nil, structValue, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string][]int, len(entries))
+	for i, entry := range entries {
+		byName[entry.name] = append(byName[entry.name], i)
+	}
+
+	dominant := make(map[string]int, len(byName))
+	for name, indexes := range byName {
+		if i, found := dominantEntry(entries, indexes); found {
+			dominant[name] = i
+		}
+	}
+
+	m := make(map[string]interface{}, len(dominant))
+	for i, entry := range entries {
+		if j, found := dominant[entry.name]; !found || j != i || entry.omitted {
+			continue
+		}
+
+		m[entry.name] = entry.value
+		if order != nil {
+			*order = append(*order, entry.name)
+		}
+	}
+	return m, nil
+}
+
+// dominantEntry returns which of the entries with the given indexes, all having the same name, is normalized,
+// following the rules of encoding/json: the fields with the least depth shadow the ones promoted from deeper embedded structs
+// and, among them, a tagged field shadows the untagged ones. If more than one field is left, the name is ambiguous
+// and false is returned, so that none of the fields is normalized.
+func dominantEntry(entries []structEntry, indexes []int) (int, bool) {
+	minDepth := entries[indexes[0]].depth
+	for _, i := range indexes[1:] {
+		if entries[i].depth < minDepth {
+			minDepth = entries[i].depth
+		}
+	}
+
+	dominant, count := -1, 0
+	tagged, taggedCount := -1, 0
+	for _, i := range indexes {
+		if entries[i].depth != minDepth {
+			continue
+		}
+
+		dominant, count = i, count+1
+		if entries[i].tagged {
+			tagged, taggedCount = i, taggedCount+1
+		}
+	}
+
+	if count == 1 {
+		return dominant, true
+	}
+	if taggedCount == 1 {
+		return tagged, true
+	}
+	return -1, false
+}
+
+// appendStructEntries appends to entries the fields of structValue, in declaration order,
+// replacing each embedded struct with its own fields.
+func (n *normalizer) appendStructEntries(entries []structEntry, structValue reflect.Value, depth int) ([]structEntry, error) {
+	for _, field := range getStructFields(structValue.Type()) {
+		fieldValue := structValue.Field(field.index)
+
+		// nil embedded struct pointers have no fields to promote, while non-nil ones are dereferenced
+		if field.anonymous && isNilStructPtr(fieldValue) {
+			continue
+		}
+
+		if field.omitempty && isEmptyValue(fieldValue) {
+			if !field.anonymous {
+				entries = append(entries, structEntry{name: field.name, depth: depth, tagged: field.tagged, omitted: true})
+			}
+			continue
+		}
+
+		// embedded values are promoted only if they are normalized to maps (which is not the case of time.Time, for example)
+		if field.anonymous {
+			if elem := reflect.Indirect(fieldValue); isPlainStruct(elem) {
+				leave, err := n.enter(fieldValue)
 				if err != nil {
 					return nil, err
 				}
 
-				if !fieldType.Anonymous {
-					m[fieldName] = normalized
-				} else {
-					if normalizedMap, ok := normalized.(map[string]interface{}); ok {
-						for k, v := range normalizedMap {
-							m[k] = v
-						}
-					} else {
-						m[fieldName] = normalized
-					}
+				entries, err = n.appendStructEntries(entries, elem, depth+1)
+				leave()
+				if err != nil {
+					return nil, err
 				}
+				continue
 			}
 		}
+
+		normalized, err := n.normalize(fieldValue.Interface())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, structEntry{name: field.name, value: normalized, depth: depth, tagged: field.tagged})
 	}
+	return entries, nil
+}
 
-	return m, nil
+// isPlainStruct reports whether rv is a struct normalized field by field, rather than to a single value as time.Time is.
+func isPlainStruct(rv reflect.Value) bool {
+	if rv.Kind() != reflect.Struct {
+		return false
+	}
+
+	switch rv.Interface().(type) {
+	case time.Time, url.URL, Value:
+		return false
+	}
+	return !rv.Type().Implements(textMarshalerType) && !reflect.PtrTo(rv.Type()).Implements(textMarshalerType)
+}
+
+// NormalizeWithOrder is like Normalize, but it also returns the names of the fields v is normalized to if it is a struct (or a pointer to a struct),
+// in declaration order. The fields promoted from embedded structs are listed in place of the embedded struct. The names are nil for any other value.
+func NormalizeWithOrder(v interface{}) (interface{}, []string, error) {
+	n := &normalizer{opts: &NormalizeOptions{}}
+	if v == nil {
+		normalized, err := n.normalize(v)
+		return normalized, nil, err
+	}
+
+	rv, _ := getElemValueAndType(v)
+	if !isPlainStruct(rv) {
+		normalized, err := n.normalize(v)
+		return normalized, nil, err
+	}
+
+	leave, err := n.enter(reflect.ValueOf(v))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer leave()
+
+	order := make([]string, 0)
+	m, err := n.normalizeStructFields(rv, &order)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, order, nil
 }
 
-func normalizeSlice(sliceValue reflect.Value) (interface{}, error) {
+func isNilStructPtr(v reflect.Value) bool {
+	return v.Kind() == reflect.Ptr && v.IsNil() && getElemType(v.Type()).Kind() == reflect.Struct
+}
+
+func (n *normalizer) normalizeSlice(sliceValue reflect.Value) (interface{}, error) {
 	if sliceValue.Type().Elem().Kind() == reflect.Uint8 {
+		if sliceValue.Kind() == reflect.Array { // fixed size arrays are stored as binary data
+			data := make([]byte, sliceValue.Len())
+			reflect.Copy(reflect.ValueOf(data), sliceValue)
+			return data, nil
+		}
 		return sliceValue.Interface(), nil
 	}
 
+	// elements are normalized one by one, thus nil pointers become nil while the others are dereferenced
 	s := make([]interface{}, 0)
 	for i := 0; i < sliceValue.Len(); i++ {
-		v, err := Normalize(sliceValue.Index(i).Interface())
+		v, err := n.normalize(sliceValue.Index(i).Interface())
 		if err != nil {
 			return nil, err
 		}
@@ -105,7 +385,7 @@ func getElemValueAndType(v interface{}) (reflect.Value, reflect.Type) {
 	return rv, rt
 }
 
-func normalizeMap(mapValue reflect.Value) (map[string]interface{}, error) {
+func (n *normalizer) normalizeMap(mapValue reflect.Value) (map[string]interface{}, error) {
 	if mapValue.Type().Key().Kind() != reflect.String {
 		return nil, fmt.Errorf("map key type must be a string")
 	}
@@ -114,7 +394,7 @@ func normalizeMap(mapValue reflect.Value) (map[string]interface{}, error) {
 	for _, key := range mapValue.MapKeys() {
 		value := mapValue.MapIndex(key)
 
-		normalized, err := Normalize(value.Interface())
+		normalized, err := n.normalize(value.Interface())
 		if err != nil {
 			return nil, err
 		}
@@ -123,59 +403,176 @@ func normalizeMap(mapValue reflect.Value) (map[string]interface{}, error) {
 	return m, nil
 }
 
-func Normalize(value interface{}) (interface{}, error) {
+func (n *normalizer) normalizeNil() (interface{}, error) {
+	if n.opts.DisallowNil {
+		return nil, fmt.Errorf("nil values are not allowed")
+	}
+	return nil, nil
+}
+
+// textMarshaler returns the encoding.TextMarshaler implemented by v or by a pointer to it, which points to a copy of v if v is not addressable.
+func textMarshaler(v reflect.Value) (encoding.TextMarshaler, bool) {
+	if marshaler, ok := v.Interface().(encoding.TextMarshaler); ok {
+		return marshaler, true
+	}
+
+	if v.CanAddr() {
+		marshaler, ok := v.Addr().Interface().(encoding.TextMarshaler)
+		return marshaler, ok
+	}
+
+	// values whose pointer implements the interface (such as big.Int) are marshaled through a pointer to a copy
+	if reflect.PtrTo(v.Type()).Implements(textMarshalerType) {
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		return ptr.Interface().(encoding.TextMarshaler), true
+	}
+	return nil, false
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// normalizeUint converts unsigned integers to int64 values, unless they exceed math.MaxInt64: in this case, they are kept as uint64 values.
+func normalizeUint(u uint64) interface{} {
+	if u <= math.MaxInt64 {
+		return int64(u)
+	}
+	return u
+}
+
+func (n *normalizer) normalizeJSONNumber(number json.Number) (interface{}, error) {
+	if i, err := number.Int64(); err == nil {
+		return i, nil
+	}
+
+	if u, err := strconv.ParseUint(number.String(), 10, 64); err == nil {
+		return u, nil
+	}
+
+	f, err := number.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("invalid json number %q", number.String())
+	}
+
+	if n.opts.DisallowFloat {
+		return nil, fmt.Errorf("float values are not allowed: %v", f)
+	}
+	return f, nil
+}
+
+func (n *normalizer) normalize(value interface{}) (interface{}, error) {
 	if value == nil {
-		return nil, nil
+		return n.normalizeNil()
+	}
+
+	leave, err := n.enter(reflect.ValueOf(value))
+	if err != nil {
+		return nil, err
 	}
+	defer leave()
 
 	rValue, rType := getElemValueAndType(value)
 	if rType.Kind() == reflect.Ptr {
-		return nil, nil
+		return n.normalizeNil()
 	}
 
 	if _, isTime := rValue.Interface().(time.Time); isTime {
 		return rValue.Interface(), nil
 	}
 
+	// URLs are stored in their string form, since their components are not meaningful as separate fields
+	if u, isURL := rValue.Interface().(url.URL); isURL {
+		return u.String(), nil
+	}
+
+	// numbers decoded by json.Decoder.UseNumber() are stored as integers if possible, rather than as strings
+	if number, isNumber := rValue.Interface().(json.Number); isNumber {
+		return n.normalizeJSONNumber(number)
+	}
+
 	if _, isValue := rValue.Interface().(Value); isValue {
 		return rValue.Interface(), nil
 	}
 
+	if marshaler, isMarshaler := textMarshaler(rValue); isMarshaler {
+		text, err := marshaler.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return string(text), nil
+	}
+
 	switch rType.Kind() {
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return rValue.Uint(), nil
+		return normalizeUint(rValue.Uint()), nil
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return rValue.Int(), nil
 	case reflect.Float32, reflect.Float64:
+		if n.opts.DisallowFloat {
+			return nil, fmt.Errorf("float values are not allowed: %v", rValue.Float())
+		}
 		return rValue.Float(), nil
 	case reflect.Struct:
-		return normalizeStruct(rValue)
+		return n.normalizeStruct(rValue)
 	case reflect.Map:
-		return normalizeMap(rValue)
+		return n.normalizeMap(rValue)
 	case reflect.String:
+		if n.opts.MaxStringLen > 0 && rValue.Len() > n.opts.MaxStringLen {
+			return nil, fmt.Errorf("string of length %d exceeds the maximum length of %d", rValue.Len(), n.opts.MaxStringLen)
+		}
 		return rValue.String(), nil
 	case reflect.Bool:
 		return rValue.Bool(), nil
-	case reflect.Slice:
-		return normalizeSlice(rValue)
+	case reflect.Slice, reflect.Array:
+		return n.normalizeSlice(rValue)
+	}
+
+	// values of unsupported types (such as channels or functions) implementing fmt.Stringer are stored in their string form
+	if stringer, isStringer := value.(fmt.Stringer); isStringer && !n.opts.DisallowStringer && StringerFallback() {
+		return stringer.String(), nil
 	}
 	return nil, fmt.Errorf("invalid dtype %s", rType.Name())
 }
 
+// Normalize converts the supplied value to its canonical representation, which is the one used for storing documents.
+// Integers are represented as int64 values, signed or not, except for unsigned values exceeding math.MaxInt64,
+// which are kept as uint64 values, both when stored and when compared.
+// Values containing themselves (through maps, slices or pointers) cannot be normalized, and cause ErrCyclicReference to be returned.
+func Normalize(value interface{}) (interface{}, error) {
+	return NormalizeWithOptions(value, &NormalizeOptions{})
+}
+
+// NormalizeWithOptions is like Normalize, but returns an error if the value violates any of the supplied restrictions.
+// Nil options impose no restriction, as with Normalize.
+func NormalizeWithOptions(value interface{}, opts *NormalizeOptions) (interface{}, error) {
+	if opts == nil {
+		opts = &NormalizeOptions{}
+	}
+	n := &normalizer{opts: opts}
+	return n.normalize(value)
+}
+
 func createRenameMap(rv reflect.Value) map[string]string {
 	renameMap := make(map[string]string)
 	for i := 0; i < rv.NumField(); i++ {
 		fieldType := rv.Type().Field(i)
 
-		tagStr, found := fieldType.Tag.Lookup("clover")
-		if found {
-			name, _ := processStructTag(tagStr)
-			renameMap[name] = fieldType.Name
+		tagStr, found := fieldType.Tag.Lookup(structTag)
+		if name, _, skip := processStructTag(tagStr); found && !skip {
+			renameMap[name] = jsonFieldName(fieldType)
 		}
 	}
 	return renameMap
 }
 
+// jsonFieldName returns the key encoding/json decodes into the given field, which is used as the target of renaming.
+func jsonFieldName(field reflect.StructField) string {
+	if name, _, skip := processStructTag(field.Tag.Get("json")); name != "" && !skip {
+		return name
+	}
+	return field.Name
+}
+
 func rename(fields map[string]interface{}, v interface{}) map[string]interface{} {
 	rv := reflect.ValueOf(v)
 	if rv.Type().Kind() != reflect.Struct {
@@ -188,7 +585,6 @@ func rename(fields map[string]interface{}, v interface{}) map[string]interface{}
 		renamedFieldName := renameMap[key]
 		if renamedFieldName != "" {
 			m[renamedFieldName] = value
-			delete(m, key)
 		} else {
 			m[key] = value
 		}
@@ -203,29 +599,219 @@ func getElemType(rt reflect.Type) reflect.Type {
 	return rt
 }
 
-func renameMapKeys(m map[string]interface{}, v interface{}) map[string]interface{} {
-	rv, rt := getElemValueAndType(v)
-	if rt.Kind() != reflect.Struct {
+// stringField is a value located by its path within the decoded value, which must be set from a string after decoding,
+// since encoding/json is not able to decode its type from strings. This is the case of url.URL (or *url.URL),
+// and of the types which decode JSON differently from text, such as big.Int, which only accepts JSON numbers.
+type stringField struct {
+	path  []pathStep
+	value string
+}
+
+// pathStep selects, depending on the kind of the value it is applied to, a struct field or a slice element by index, or a map entry by key.
+type pathStep struct {
+	index int
+	key   string
+}
+
+func appendPathStep(path []pathStep, step pathStep) []pathStep {
+	return append(append(make([]pathStep, 0, len(path)+1), path...), step)
+}
+
+var urlType = reflect.TypeOf(url.URL{})
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// isStringFieldType reports whether values of type t must be set from strings after decoding (see stringField).
+func isStringFieldType(t reflect.Type) bool {
+	if t == urlType {
+		return true
+	}
+
+	ptrType := reflect.PtrTo(t)
+	return ptrType.Implements(textUnmarshalerType) && ptrType.Implements(jsonUnmarshalerType)
+}
+
+func renameMapKeys(m map[string]interface{}, t reflect.Type, path []pathStep, strs *[]stringField) map[string]interface{} {
+	t = getElemType(t)
+	switch t.Kind() {
+	case reflect.Struct:
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return m
+		}
+
+		renamed := make(map[string]interface{}, len(m))
+		for key, value := range m {
+			if s, isString := value.(string); isString && isStringFieldType(getElemType(t.Elem())) {
+				*strs = append(*strs, stringField{path: appendPathStep(path, pathStep{key: key}), value: s})
+				continue
+			}
+			renamed[key] = renameValue(value, t.Elem(), appendPathStep(path, pathStep{key: key}), strs)
+		}
+		return renamed
+	default:
 		return m
 	}
 
-	renamed := rename(m, rv.Interface())
-	for i := 0; i < rv.NumField(); i++ {
-		sf := rv.Type().Field(i)
-		fv := renamed[sf.Name]
-		ft := getElemType(sf.Type)
+	renamed := rename(m, reflect.Zero(t).Interface())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := jsonFieldName(sf)
+		if _, _, skip := processStructTag(sf.Tag.Get(structTag)); skip {
+			delete(renamed, key) // skipped fields are not decoded either
+			continue
+		}
+
+		fv, exists := renamed[key]
+		if !exists {
+			continue
+		}
 
-		fMap, isMap := fv.(map[string]interface{})
-		if isMap && ft.Kind() == reflect.Struct {
-			converted := renameMapKeys(fMap, rv.Field(i).Interface())
-			renamed[sf.Name] = converted
+		fieldPath := appendPathStep(path, pathStep{index: i})
+		if s, isString := fv.(string); isString && isStringFieldType(getElemType(sf.Type)) {
+			delete(renamed, key)
+			*strs = append(*strs, stringField{path: fieldPath, value: s})
+			continue
 		}
+		renamed[key] = renameValue(fv, sf.Type, fieldPath, strs)
 	}
 	return renamed
 }
 
+// renameValue prepares a normalized value to be decoded into a value of type t, renaming the keys of the objects decoded into structs
+// and collecting the strings which must be set after decoding, whose place is taken by nil.
+func renameValue(value interface{}, t reflect.Type, path []pathStep, strs *[]stringField) interface{} {
+	t = getElemType(t)
+	switch vType := value.(type) {
+	case map[string]interface{}:
+		return renameMapKeys(vType, t, path, strs)
+	case []interface{}:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return value
+		}
+
+		s := make([]interface{}, len(vType))
+		for i, elem := range vType {
+			s[i] = renameValue(elem, t.Elem(), appendPathStep(path, pathStep{index: i}), strs)
+		}
+		return s
+	case []byte:
+		if t.Kind() == reflect.Array && t.Elem().Kind() == reflect.Uint8 {
+			return bytesToSlice(vType)
+		}
+	case string:
+		if isStringFieldType(t) {
+			*strs = append(*strs, stringField{path: path, value: vType})
+			return nil
+		}
+	}
+	return value
+}
+
+func setStringFields(v interface{}, strs []stringField) error {
+	for _, field := range strs {
+		ptr, err := parseStringField(getElemType(stringFieldType(reflect.TypeOf(v), field.path)), field.value)
+		if err != nil {
+			return err
+		}
+		setPath(reflect.ValueOf(v), field.path, ptr)
+	}
+	return nil
+}
+
+// stringFieldType returns the type of the value located by path within a value of type t.
+func stringFieldType(t reflect.Type, path []pathStep) reflect.Type {
+	for _, step := range path {
+		t = getElemType(t)
+		if t.Kind() == reflect.Struct {
+			t = t.Field(step.index).Type
+		} else {
+			t = t.Elem()
+		}
+	}
+	return t
+}
+
+// setPath sets the value located by path within rv, which must be settable unless it is a pointer, to the value pointed by ptr.
+// Nil pointers along the path are allocated, and map entries are replaced with an updated copy, since they are not settable.
+func setPath(rv reflect.Value, path []pathStep, ptr reflect.Value) {
+	for rv.Kind() == reflect.Ptr && len(path) > 0 {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+
+	if len(path) == 0 {
+		if rv.Kind() == reflect.Ptr {
+			rv.Set(ptr)
+		} else {
+			rv.Set(ptr.Elem())
+		}
+		return
+	}
+
+	step := path[0]
+	switch rv.Kind() {
+	case reflect.Struct:
+		setPath(rv.Field(step.index), path[1:], ptr)
+	case reflect.Slice, reflect.Array:
+		setPath(rv.Index(step.index), path[1:], ptr)
+	case reflect.Map:
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+
+		key := reflect.ValueOf(step.key).Convert(rv.Type().Key())
+		elem := reflect.New(rv.Type().Elem()).Elem()
+		if current := rv.MapIndex(key); current.IsValid() {
+			elem.Set(current)
+		}
+		setPath(elem, path[1:], ptr)
+		rv.SetMapIndex(key, elem)
+	}
+}
+
+// parseStringField returns a pointer to the value of type t parsed from s.
+func parseStringField(t reflect.Type, s string) (reflect.Value, error) {
+	if t == urlType {
+		u, err := url.Parse(s)
+		return reflect.ValueOf(u), err
+	}
+
+	ptr := reflect.New(t)
+	err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	return ptr, err
+}
+
+// bytesToSlice converts binary data to a slice of numbers,
+// so that it can be decoded into a fixed size byte array.
+func bytesToSlice(data []byte) []interface{} {
+	s := make([]interface{}, len(data))
+	for i, b := range data {
+		s[i] = b
+	}
+	return s
+}
+
+// marshal encodes v sorting map keys, so that equal values always produce the same bytes.
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetSortMapKeys(true)
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func Encode(v map[string]interface{}) ([]byte, error) {
-	return msgpack.Marshal(replaceTimes(v))
+	return marshal(replaceTimes(v))
 }
 
 func Decode(data []byte, m *map[string]interface{}) error {
@@ -236,12 +822,98 @@ func Decode(data []byte, m *map[string]interface{}) error {
 	return err
 }
 
+// EncodeValue encodes a single normalized value.
+func EncodeValue(v interface{}) ([]byte, error) {
+	return marshal(replaceTimes(v))
+}
+
+// DecodeValue decodes a value previously encoded with EncodeValue.
+// An error is returned if data is not a single, well-formed value.
+func DecodeValue(data []byte) (interface{}, error) {
+	r := bytes.NewReader(data)
+
+	var v interface{}
+	if err := msgpack.NewDecoder(r).Decode(&v); err != nil {
+		return nil, err
+	}
+
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("unexpected %d trailing bytes after encoded value", r.Len())
+	}
+	return removeLocalizedTimes(v), nil
+}
+
+// isFieldwiseTarget reports whether v points to a struct or a map, which decoding a JSON object updates in place
+// rather than replacing, allowing to fill them by decoding one field at a time.
+func isFieldwiseTarget(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return false
+	}
+
+	kind := rv.Elem().Kind()
+	return kind == reflect.Struct || kind == reflect.Map
+}
+
+// ConvertValue stores a normalized value in the value pointed by v.
+func ConvertValue(value interface{}, v interface{}) error {
+	if m, isMap := value.(map[string]interface{}); isMap {
+		return Convert(m, v)
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
 func Convert(m map[string]interface{}, v interface{}) error {
-	renamed := renameMapKeys(m, v)
+	strs := make([]stringField, 0)
+	renamed := renameMapKeys(m, reflect.TypeOf(v), nil, &strs)
 
 	b, err := json.Marshal(renamed)
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(b, v)
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return err
+	}
+	return setStringFields(v, strs)
+}
+
+// ConvertContext is like Convert, but it converts one top-level field at a time, checking ctx before each of them.
+// If ctx is done, the conversion is aborted and the context error is returned, leaving v partially filled.
+// Only structs and maps can be filled one field at a time: any other target is converted as a whole, after checking ctx once.
+func ConvertContext(ctx context.Context, m map[string]interface{}, v interface{}) error {
+	if !isFieldwiseTarget(v) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return Convert(m, v)
+	}
+
+	strs := make([]stringField, 0)
+	renamed := renameMapKeys(m, reflect.TypeOf(v), nil, &strs)
+
+	for key, value := range renamed {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		b, err := json.Marshal(map[string]interface{}{key: value})
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(b, v); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return setStringFields(v, strs)
 }
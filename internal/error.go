@@ -3,3 +3,6 @@ package internal
 import "errors"
 
 var ErrStopIteration = errors.New("iteration stop")
+
+// ErrCyclicReference is returned when normalizing a value which (directly or indirectly) contains itself.
+var ErrCyclicReference = errors.New("cyclic reference")
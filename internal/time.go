@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"sync"
 	"time"
 
 	"github.com/ostafen/clover/v2/util"
@@ -18,12 +19,80 @@ type LocalizedTime struct {
 var _ msgpack.Marshaler = (*LocalizedTime)(nil)
 var _ msgpack.Unmarshaler = (*LocalizedTime)(nil)
 
+// MarshalMsgpack encodes the time in its binary form, which only holds the offset of the zone, followed by the name of its location,
+// so that times of named locations (such as "Europe/Berlin") are decoded in the same location rather than in an anonymous fixed zone.
+// Note that releases which predate the location name fail to decode the times encoded this way.
 func (tm *LocalizedTime) MarshalMsgpack() ([]byte, error) {
-	return tm.GobEncode()
+	data, err := tm.GobEncode()
+	if err != nil {
+		return nil, err
+	}
+	return append(data, tm.Location().String()...), nil
 }
 
+// UnmarshalMsgpack decodes a time encoded by MarshalMsgpack. Times encoded without the name of their location are decoded as well.
+// If the location cannot be loaded, or its offset at that time differs from the encoded one, the time is decoded in a fixed zone having the same name.
 func (tm *LocalizedTime) UnmarshalMsgpack(b []byte) error {
-	return tm.GobDecode(b)
+	n := timeBinarySize(b)
+	if err := tm.GobDecode(b[:n]); err != nil {
+		return err
+	}
+
+	name := string(b[n:])
+	if name == "" || name == tm.Location().String() {
+		return nil
+	}
+
+	_, offset := tm.Zone()
+	if loc := loadLocation(name); loc != nil {
+		if t := tm.In(loc); zoneOffset(t) == offset {
+			tm.Time = t
+			return nil
+		}
+	}
+	tm.Time = tm.In(time.FixedZone(name, offset))
+	return nil
+}
+
+// locations caches the locations loaded by name, since loading a location is much more expensive than decoding a time.
+// Names which cannot be loaded are cached as well, as nil locations.
+var locations sync.Map
+
+// loadLocation returns the location with the given name, or nil if it cannot be loaded.
+func loadLocation(name string) *time.Location {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc = nil
+	}
+	locations.Store(name, loc)
+	return loc
+}
+
+// timeBinarySize returns the length of the binary form of the time b starts with, which depends on its version.
+func timeBinarySize(b []byte) int {
+	n := len(b)
+	if len(b) > 0 {
+		switch b[0] {
+		case 1:
+			n = 15
+		case 2:
+			n = 16
+		}
+	}
+
+	if n > len(b) {
+		return len(b)
+	}
+	return n
+}
+
+func zoneOffset(t time.Time) int {
+	_, offset := t.Zone()
+	return offset
 }
 
 func replaceTimes(v interface{}) interface{} {
@@ -66,7 +135,7 @@ func removeLocalizedTimes(v interface{}) interface{} {
 	s, isSlice := v.([]interface{})
 	if isSlice {
 		for i, v := range s {
-			s[i] = replaceTimes(v)
+			s[i] = removeLocalizedTimes(v)
 		}
 	}
 	return v
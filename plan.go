@@ -2,6 +2,7 @@ package clover
 
 import (
 	"errors"
+	"reflect"
 	"sort"
 
 	"github.com/dgraph-io/badger/v3"
@@ -81,7 +82,16 @@ func (nd *iterNode) iterateFullCollection(txn *badger.Txn) error {
 }
 
 func (nd *iterNode) iterateIndex(txn *badger.Txn) error {
+	// a document can have several entries in the index, since array elements are indexed individually (multikey)
+	// and so are the values of a field crossing an array of objects: each document must only be visited once
+	visited := make(map[string]bool)
+
 	iterFunc := func(docId string) error {
+		if visited[docId] {
+			return nil
+		}
+		visited[docId] = true
+
 		doc, err := getDocumentById(nd.collection, docId, txn)
 
 		if err != nil {
@@ -139,15 +149,117 @@ func getIndexQueries(q *query.Query, indexes []index.Index) []index.IndexQuery {
 
 	queries := make([]index.IndexQuery, 0)
 	for field, vRange := range fieldRanges {
-		queries = append(queries, &index.RangeIndexQuery{
-			Range: vRange,
-			Idx:   indexesMap[field].(index.RangeIndex),
-		})
+		switch idx := indexesMap[field].(type) {
+		case index.RangeIndex:
+			queries = append(queries, &index.RangeIndexQuery{
+				Range: vRange,
+				Idx:   idx,
+			})
+		case index.HashIndex:
+			// hash indexes can only be used for equality, and the filter confirms the candidates they return
+			if !isPointRange(vRange) {
+				return nil
+			}
+
+			queries = append(queries, &index.HashIndexQuery{
+				Value: vRange.Start,
+				Idx:   idx,
+			})
+		}
 	}
 	return queries
 }
 
+// isPointRange reports whether vRange only contains a single value.
+func isPointRange(vRange *index.Range) bool {
+	return vRange.StartIncluded && vRange.EndIncluded && (vRange.IsNil() || (vRange.Start != nil && internal.Compare(vRange.Start, vRange.End) == 0))
+}
+
+// equalityValue returns the value which c requires field to be equal to, if any. Only conjunctions of criteria are taken into account.
+func equalityValue(c query.Criteria, field string) (interface{}, bool) {
+	switch cType := c.(type) {
+	case *query.UnaryCriteria:
+		if cType.Field == field && cType.OpType == query.EqOp && cType.KeyFunc == nil && !query.IsField(cType.Value) {
+			return cType.Value, true
+		}
+	case *query.BinaryCriteria:
+		if cType.OpType == query.LogicalAnd {
+			if value, ok := equalityValue(cType.C1, field); ok {
+				return value, true
+			}
+			return equalityValue(cType.C2, field)
+		}
+	}
+	return nil, false
+}
+
+// tryToSelectCompoundIndex looks for a compound index whose leading fields are required to be equal to some values by the query criteria.
+// An index whose next field is the one the query is sorted by is preferred, since it produces sorted output.
+func tryToSelectCompoundIndex(q *query.Query, indexes []index.Index) (*iterNode, bool) {
+	if q.Criteria() == nil {
+		return nil, false
+	}
+
+	var selected *iterNode
+	for _, idx := range indexes {
+		compoundIdx, isCompound := idx.(index.CompoundIndex)
+		if !isCompound {
+			continue
+		}
+
+		fields := compoundIdx.Fields()
+
+		prefix := make([]interface{}, 0, len(fields))
+		for _, field := range fields {
+			value, ok := equalityValue(q.Criteria(), field)
+			if !ok {
+				break
+			}
+			prefix = append(prefix, value)
+		}
+
+		if len(prefix) == 0 {
+			continue
+		}
+
+		idxQuery := &index.CompoundIndexQuery{Prefix: prefix, Idx: compoundIdx}
+		node := &iterNode{
+			idxQuery:   idxQuery,
+			filter:     q.Criteria(),
+			collection: q.Collection(),
+		}
+
+		if len(q.SortOptions()) == 1 && len(prefix) < len(fields) && q.SortOptions()[0].Field == fields[len(prefix)] && !mayBeMultikey(idx) {
+			idxQuery.Reverse = q.SortOptions()[0].Direction < 0
+			return node, true
+		}
+
+		if selected == nil {
+			selected = node
+		}
+	}
+	return selected, false
+}
+
+// mayBeMultikey reports whether a document may have several entries in the index, in which case
+// the order of the index doesn't match the order of the documents by the indexed field, and sorting must be done in memory.
+// Indexes unable to tell, as well as those failing to, are assumed to be multikey.
+func mayBeMultikey(idx index.Index) bool {
+	multikeyIdx, ok := idx.(index.MultikeyIndex)
+	if !ok {
+		return true
+	}
+
+	multikey, err := multikeyIdx.Multikey()
+	return err != nil || multikey
+}
+
 func tryToSelectIndex(q *query.Query, indexes []index.Index) (*iterNode, bool) {
+	compoundNode, sorted := tryToSelectCompoundIndex(q, indexes)
+	if sorted {
+		return compoundNode, true
+	}
+
 	indexQueries := getIndexQueries(q, indexes)
 	if len(indexQueries) == 1 {
 		outputSorted := false
@@ -155,7 +267,7 @@ func tryToSelectIndex(q *query.Query, indexes []index.Index) (*iterNode, bool) {
 		idxQuery := indexQueries[0]
 
 		if rangeQuery, ok := idxQuery.(*index.RangeIndexQuery); ok {
-			if len(q.SortOptions()) == 1 && q.SortOptions()[0].Field == rangeQuery.Idx.Field() {
+			if len(q.SortOptions()) == 1 && q.SortOptions()[0].Field == rangeQuery.Idx.Field() && !mayBeMultikey(rangeQuery.Idx) {
 				rangeQuery.Reverse = q.SortOptions()[0].Direction < 0
 				outputSorted = true
 			}
@@ -168,9 +280,13 @@ func tryToSelectIndex(q *query.Query, indexes []index.Index) (*iterNode, bool) {
 		}, outputSorted
 	}
 
+	if compoundNode != nil {
+		return compoundNode, false
+	}
+
 	if len(q.SortOptions()) == 1 {
 		for _, idx := range indexes {
-			if idx.Type() == index.IndexSingleField && idx.Field() == q.SortOptions()[0].Field {
+			if idx.Type() == index.IndexSingleField && idx.Field() == q.SortOptions()[0].Field && !mayBeMultikey(idx) {
 				return &iterNode{
 					filter:     q.Criteria(),
 					collection: q.Collection(),
@@ -234,11 +350,74 @@ func (nd *sortNode) Finish() error {
 	return nil
 }
 
+func applyKeyFuncs(q *query.Query, indexes []index.Index) *query.Query {
+	keyFuncs := make(map[string]index.KeyFunc)
+	for _, idx := range indexes {
+		if name := idx.Info().KeyFunc; name != "" {
+			if keyFunc := index.GetKeyFunc(name); keyFunc != nil {
+				keyFuncs[idx.Field()] = keyFunc
+			}
+		}
+	}
+
+	if q.Criteria() == nil || len(keyFuncs) == 0 {
+		return q
+	}
+	return q.Where(q.Criteria().Accept(&KeyFuncVisitor{KeyFuncs: keyFuncs}).(query.Criteria))
+}
+
+// usableIndexes returns the indexes which cover all the documents the query can match:
+// a partial index is only usable if each conjunct of its filter is also a conjunct of the query criteria.
+func usableIndexes(q *query.Query, indexes []index.Index) []index.Index {
+	usable := make([]index.Index, 0, len(indexes))
+	for _, idx := range indexes {
+		name := idx.Info().Filter
+		if name == "" {
+			usable = append(usable, idx)
+			continue
+		}
+
+		filter, err := getIndexFilter(name)
+		if err == nil && q.Criteria() != nil && containsConjuncts(conjuncts(q.Criteria()), conjuncts(filter)) {
+			usable = append(usable, idx)
+		}
+	}
+	return usable
+}
+
+// conjuncts returns the criteria whose conjunction forms c.
+func conjuncts(c query.Criteria) []query.Criteria {
+	if binaryCriteria, isBinary := c.(*query.BinaryCriteria); isBinary && binaryCriteria.OpType == query.LogicalAnd {
+		return append(conjuncts(binaryCriteria.C1), conjuncts(binaryCriteria.C2)...)
+	}
+	return []query.Criteria{c}
+}
+
+func containsConjuncts(criteria []query.Criteria, required []query.Criteria) bool {
+	for _, r := range required {
+		found := false
+		for _, c := range criteria {
+			if reflect.DeepEqual(c, r) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 func buildQueryPlan(q *query.Query, indexes []index.Index, outputNode planNode) inputNode {
 	var inputNode inputNode
 	var prevNode planNode
 
-	itNode, isOutputSorted := tryToSelectIndex(q, indexes)
+	usable := usableIndexes(q, indexes) // the filters of partial indexes are compared with the criteria before key functions are applied
+	q = applyKeyFuncs(q, indexes)
+
+	itNode, isOutputSorted := tryToSelectIndex(q, usable)
 	if itNode == nil {
 		itNode = &iterNode{
 			filter:     q.Criteria(),
@@ -93,6 +93,14 @@ type UnaryCriteria struct {
 	OpType int
 	Field  string
 	Value  interface{}
+
+	// KeyFunc, if not nil, maps both the field value and the criteria value before they are compared,
+	// so that comparisons follow a custom ordering.
+	KeyFunc func(value interface{}) interface{}
+
+	// MatchElements makes the criteria also satisfied by the documents where the field is an array
+	// having any element which satisfies it (see AnyElement).
+	MatchElements bool
 }
 
 func (c *UnaryCriteria) Not() Criteria {
@@ -108,21 +116,56 @@ func (c *UnaryCriteria) Or(other Criteria) Criteria {
 }
 
 func (c *UnaryCriteria) Satisfy(doc *d.Document) bool {
+	if c.OpType == FunctionOp {
+		return c.Value.(func(*d.Document) bool)(doc)
+	}
+
+	// when the field crosses an array of objects, the criteria is satisfied if any element satisfies it
+	if values, crossed := doc.ArrayValues(c.Field); crossed {
+		for _, value := range values {
+			if c.satisfyValueOrElements(doc, value, true) {
+				return true
+			}
+		}
+		return false
+	}
+	return c.satisfyValueOrElements(doc, doc.Get(c.Field), doc.Has(c.Field))
+}
+
+// satisfyValueOrElements reports whether the criteria is satisfied by fieldValue or, if it is an array and MatchElements is set, by any of its elements,
+// so that tags = "go" matches the documents whose tags array holds "go". Exists and Contains criteria are only checked against the whole value.
+func (c *UnaryCriteria) satisfyValueOrElements(doc *d.Document, fieldValue interface{}, exists bool) bool {
+	if c.satisfyValue(doc, fieldValue, exists) {
+		return true
+	}
+
+	if !c.MatchElements || c.OpType == ExistsOp || c.OpType == ContainsOp {
+		return false
+	}
+
+	elems, _ := fieldValue.([]interface{})
+	for _, elem := range elems {
+		if c.satisfyValue(doc, elem, true) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *UnaryCriteria) satisfyValue(doc *d.Document, fieldValue interface{}, exists bool) bool {
 	switch c.OpType {
 	case ExistsOp:
-		return c.exist(doc)
+		return exists
 	case EqOp:
-		return c.eq(doc)
+		return exists && c.eq(doc, fieldValue)
 	case LikeOp:
-		return c.like(doc)
+		return c.like(fieldValue)
 	case InOp:
-		return c.in(doc)
+		return c.in(doc, fieldValue)
 	case GtOp, GtEqOp, LtOp, LtEqOp:
-		return c.compare(doc)
+		return c.compare(doc, fieldValue)
 	case ContainsOp:
-		return c.contains(doc)
-	case FunctionOp:
-		return c.Value.(func(*d.Document) bool)(doc)
+		return c.contains(doc, fieldValue)
 	}
 	return false
 }
@@ -160,7 +203,8 @@ func newCriteria(opType int, field string, value interface{}) Criteria {
 }
 
 type field struct {
-	name string
+	name     string
+	elements bool
 }
 
 func IsField(v interface{}) bool {
@@ -173,12 +217,30 @@ func Field(name string) *field {
 	return &field{name: name}
 }
 
+// AnyElement makes the criteria built from the field also match the documents where the field is an array having any element
+// which satisfies them, in addition to the documents where the field as a whole does: for example, Field("tags").AnyElement().Eq("go")
+// matches both {"tags": "go"} and {"tags": ["db", "go"]}. Exists and Contains criteria are not affected.
+// By default, criteria are only checked against the whole value of the field. Indexes on the field can be used in both cases,
+// since arrays are indexed both as a whole and once per element.
+func (f *field) AnyElement() *field {
+	return &field{name: f.name, elements: true}
+}
+
+func (f *field) newCriteria(opType int, value interface{}) Criteria {
+	return &UnaryCriteria{
+		OpType:        opType,
+		Field:         f.name,
+		Value:         value,
+		MatchElements: f.elements,
+	}
+}
+
 func (f *field) Exists() Criteria {
-	return newCriteria(ExistsOp, f.name, nil)
+	return f.newCriteria(ExistsOp, nil)
 }
 
 func (f *field) NotExists() Criteria {
-	return newCriteria(ExistsOp, f.name, nil).Not()
+	return f.newCriteria(ExistsOp, nil).Not()
 }
 
 func (f *field) IsNil() Criteria {
@@ -198,23 +260,23 @@ func (f *field) IsNilOrNotExists() Criteria {
 }
 
 func (f *field) Eq(value interface{}) Criteria {
-	return newCriteria(EqOp, f.name, value)
+	return f.newCriteria(EqOp, value)
 }
 
 func (f *field) Gt(value interface{}) Criteria {
-	return newCriteria(GtOp, f.name, value)
+	return f.newCriteria(GtOp, value)
 }
 
 func (f *field) GtEq(value interface{}) Criteria {
-	return newCriteria(GtEqOp, f.name, value)
+	return f.newCriteria(GtEqOp, value)
 }
 
 func (f *field) Lt(value interface{}) Criteria {
-	return newCriteria(LtOp, f.name, value)
+	return f.newCriteria(LtOp, value)
 }
 
 func (f *field) LtEq(value interface{}) Criteria {
-	return newCriteria(LtEqOp, f.name, value)
+	return f.newCriteria(LtEqOp, value)
 }
 
 func (f *field) Neq(value interface{}) Criteria {
@@ -222,15 +284,15 @@ func (f *field) Neq(value interface{}) Criteria {
 }
 
 func (f *field) In(values ...interface{}) Criteria {
-	return newCriteria(InOp, f.name, values)
+	return f.newCriteria(InOp, values)
 }
 
 func (f *field) Like(pattern string) Criteria {
-	return newCriteria(LikeOp, f.name, pattern)
+	return f.newCriteria(LikeOp, pattern)
 }
 
 func (f *field) Contains(elems ...interface{}) Criteria {
-	return newCriteria(ContainsOp, f.name, elems)
+	return f.newCriteria(ContainsOp, elems)
 }
 
 // getFieldOrValue returns dereferenced value if value denotes another document field,
@@ -245,13 +307,20 @@ func getFieldOrValue(doc *d.Document, value interface{}) interface{} {
 	return value
 }
 
-func (c *UnaryCriteria) compare(doc *d.Document) bool {
+func (c *UnaryCriteria) compareValues(v1, v2 interface{}) int {
+	if c.KeyFunc != nil {
+		v1, v2 = c.KeyFunc(v1), c.KeyFunc(v2)
+	}
+	return internal.Compare(v1, v2)
+}
+
+func (c *UnaryCriteria) compare(doc *d.Document, fieldValue interface{}) bool {
 	normValue, err := internal.Normalize(getFieldOrValue(doc, c.Value))
 	if err != nil {
 		return false
 	}
 
-	res := internal.Compare(doc.Get(c.Field), normValue)
+	res := c.compareValues(fieldValue, normValue)
 
 	switch c.OpType {
 	case GtOp:
@@ -266,37 +335,26 @@ func (c *UnaryCriteria) compare(doc *d.Document) bool {
 	panic("unreachable code")
 }
 
-func (c *UnaryCriteria) exist(doc *d.Document) bool {
-	return doc.Has(c.Field)
-}
-
-func (c *UnaryCriteria) eq(doc *d.Document) bool {
+func (c *UnaryCriteria) eq(doc *d.Document, fieldValue interface{}) bool {
 	value := getFieldOrValue(doc, c.Value)
-
-	if !doc.Has(c.Field) {
-		return false
-	}
-
-	return internal.Compare(doc.Get(c.Field), value) == 0
+	return c.compareValues(fieldValue, value) == 0
 }
 
-func (c *UnaryCriteria) in(doc *d.Document) bool {
+func (c *UnaryCriteria) in(doc *d.Document, fieldValue interface{}) bool {
 	values := c.Value.([]interface{})
 
-	docValue := doc.Get(c.Field)
 	for _, value := range values {
 		actualValue := getFieldOrValue(doc, value)
-		if internal.Compare(actualValue, docValue) == 0 {
+		if c.compareValues(actualValue, fieldValue) == 0 {
 			return true
 		}
 	}
 	return false
 }
 
-func (c *UnaryCriteria) contains(doc *d.Document) bool {
+func (c *UnaryCriteria) contains(doc *d.Document, fieldValue interface{}) bool {
 	elems := c.Value.([]interface{})
 
-	fieldValue := doc.Get(c.Field)
 	slice, _ := fieldValue.([]interface{})
 
 	if fieldValue == nil || slice == nil {
@@ -322,10 +380,10 @@ func (c *UnaryCriteria) contains(doc *d.Document) bool {
 	return true
 }
 
-func (c *UnaryCriteria) like(doc *d.Document) bool {
+func (c *UnaryCriteria) like(fieldValue interface{}) bool {
 	pattern := c.Value.(string)
 
-	s, isString := doc.Get(c.Field).(string)
+	s, isString := fieldValue.(string)
 	if !isString {
 		return false
 	}
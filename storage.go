@@ -1,6 +1,7 @@
 package clover
 
 import (
+	"context"
 	"errors"
 
 	d "github.com/ostafen/clover/v2/document"
@@ -11,6 +12,9 @@ import (
 var ErrDocumentNotExist = errors.New("no such document")
 var ErrDuplicateKey = errors.New("duplicate key")
 
+// ErrNotSupported is returned when an operation requires an optional interface which the storage engine does not implement.
+var ErrNotSupported = errors.New("operation not supported by the storage engine")
+
 type docConsumer func(doc *d.Document) error
 
 // StorageEngine represents the persistance layer and abstracts how collections are stored.
@@ -36,3 +40,25 @@ type StorageEngine interface {
 	HasIndex(collection, field string) (bool, error)
 	ListIndexes(collection string) ([]index.IndexInfo, error)
 }
+
+// CollectionOptionsCreator is implemented by the storage engines which support creating collections with CollectionOptions.
+type CollectionOptionsCreator interface {
+	CreateCollectionWithOptions(name string, opts CollectionOptions) error
+}
+
+// IndexInfoCreator is implemented by the storage engines which support the index types and options described by index.IndexInfo.
+// Storage engines which do not implement it only support single field indexes without options, created through StorageEngine.CreateIndex.
+type IndexInfoCreator interface {
+	CreateIndexWithInfo(collection string, info index.IndexInfo) error
+}
+
+// IndexRebuilder is implemented by the storage engines which are able to rebuild an index from the documents (see DB.RebuildIndex).
+type IndexRebuilder interface {
+	RebuildIndex(collection, field string) error
+}
+
+// StreamIndexCreator is implemented by the storage engines which are able to build an index by decoding the documents in parallel
+// (see DB.CreateIndexStream).
+type StreamIndexCreator interface {
+	CreateIndexStream(ctx context.Context, collection, field string, progress func(indexed int)) error
+}
@@ -2,14 +2,19 @@ package clover
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	badger "github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/pb"
+	"github.com/dgraph-io/ristretto/z"
 	"github.com/mmcloughlin/geohash"
 	d "github.com/ostafen/clover/v2/document"
 	"github.com/ostafen/clover/v2/index"
@@ -26,6 +31,13 @@ type storageImpl struct {
 	closed uint32
 }
 
+var (
+	_ CollectionOptionsCreator = (*storageImpl)(nil)
+	_ IndexInfoCreator         = (*storageImpl)(nil)
+	_ IndexRebuilder           = (*storageImpl)(nil)
+	_ StreamIndexCreator       = (*storageImpl)(nil)
+)
+
 func NewDefaultStorage() *storageImpl {
 	return &storageImpl{
 		chQuit: make(chan struct{}, 1),
@@ -74,12 +86,94 @@ func (s *storageImpl) Open(path string, c *Config) error {
 
 	s.startGC()
 
-	return err
+	if err != nil {
+		return err
+	}
+	return s.upgradeIndexes()
+}
+
+// upgradeIndexes rebuilds the indexes of the collections whose index keys were written with an older layout.
+func (s *storageImpl) upgradeIndexes() error {
+	collections, err := s.ListCollections()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range collections {
+		if err := s.upgradeCollectionIndexes(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *storageImpl) upgradeCollectionIndexes(collection string) error {
+	txn := s.db.NewTransaction(true)
+	defer txn.Discard()
+
+	meta, err := s.getCollectionMeta(collection, txn)
+	if err != nil {
+		return err
+	}
+
+	if meta.IndexFormat >= index.KeyFormatVersion {
+		return nil
+	}
+
+	for _, idx := range s.getIndexes(txn, collection, meta) {
+		if err := idx.Drop(); err != nil {
+			return err
+		}
+	}
+
+	indexes, err := s.getWritableIndexes(txn, collection, meta)
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range indexes {
+		if err := s.indexDocs(txn, idx); err != nil {
+			return err
+		}
+	}
+
+	meta.IndexFormat = index.KeyFormatVersion
+	if err := s.saveCollectionMetadata(collection, meta, txn); err != nil {
+		return err
+	}
+	return txn.Commit()
 }
 
 type collectionMetadata struct {
 	Size    int
 	Indexes []index.IndexInfo
+	Options CollectionOptions
+
+	// IndexFormat is the version of the layout of the index keys of the collection (see index.KeyFormatVersion).
+	IndexFormat int `json:",omitempty"`
+
+	// StaleIndexes lists the fields of the partial indexes which stopped being maintained because their filter was not registered.
+	// Such indexes are ignored until they are rebuilt (see RebuildIndex).
+	StaleIndexes []string `json:",omitempty"`
+}
+
+func (meta *collectionMetadata) isStale(field string) bool {
+	for _, stale := range meta.StaleIndexes {
+		if stale == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (meta *collectionMetadata) clearStale(field string) {
+	fields := make([]string, 0, len(meta.StaleIndexes))
+	for _, stale := range meta.StaleIndexes {
+		if stale != field {
+			fields = append(fields, stale)
+		}
+	}
+	meta.StaleIndexes = fields
 }
 
 func getCollectionKeyPrefix() string {
@@ -91,6 +185,10 @@ func getCollectionKey(name string) string {
 }
 
 func (s *storageImpl) CreateCollection(name string) error {
+	return s.CreateCollectionWithOptions(name, CollectionOptions{})
+}
+
+func (s *storageImpl) CreateCollectionWithOptions(name string, opts CollectionOptions) error {
 	txn := s.db.NewTransaction(true)
 	defer txn.Discard()
 
@@ -103,7 +201,7 @@ func (s *storageImpl) CreateCollection(name string) error {
 		return ErrCollectionExist
 	}
 
-	meta := &collectionMetadata{Size: 0}
+	meta := &collectionMetadata{Size: 0, Options: opts, IndexFormat: index.KeyFormatVersion}
 	if err := s.saveCollectionMetadata(name, meta, txn); err != nil {
 		return err
 	}
@@ -245,15 +343,72 @@ func getGeoHash(v interface{}) int64 {
 	return int64(geohash.EncodeIntWithPrecision(x, y, 26))
 }
 
+// getIndexedValue returns the value of the field to be indexed for the document.
+// Values are read from the document, so that index keys are built from the same normalized representation
+// used to store the document (and to normalize query values), e.g. int64 for any signed integer.
+// If the field path crosses an array of objects, an index.MultiValue holding the sub-value of each element is returned,
+// so that the document is indexed once per element.
+func getIndexedValue(doc *d.Document, field string) interface{} {
+	if values, crossed := doc.ArrayValues(field); crossed {
+		if len(values) == 0 { // no element has the field, so it is treated as missing
+			return nil
+		}
+		return index.MultiValue(values)
+	}
+	return doc.Get(field)
+}
+
+// getIndexValue returns the value to be indexed for the document by the index described by info.
+// For compound indexes, it is an index.CompoundValue holding the value of each field, where the sub-values of a field crossing an array of objects are gathered into an array.
+func getIndexValue(doc *d.Document, info index.IndexInfo) interface{} {
+	if info.Type != index.IndexCompound {
+		return getIndexedValue(doc, info.Field)
+	}
+
+	values := make(index.CompoundValue, 0, len(info.Fields))
+	for _, field := range info.Fields {
+		value := getIndexedValue(doc, field)
+		if multiValue, isMulti := value.(index.MultiValue); isMulti {
+			value = []interface{}(multiValue)
+		} else if !doc.Has(field) {
+			value = index.MissingValue
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// indexCovers reports whether the document belongs to the documents covered by the index described by info,
+// which are all the documents of the collection unless the index is partial (see WithFilter).
+func indexCovers(info index.IndexInfo, doc *d.Document) (bool, error) {
+	if info.Filter == "" {
+		return true, nil
+	}
+
+	filter, err := getIndexFilter(info.Filter)
+	if err != nil {
+		return false, err
+	}
+	return filter.Satisfy(doc), nil
+}
+
 func (s *storageImpl) addDocToIndexes(txn *badger.Txn, indexes []index.Index, doc *d.Document) error {
 	// update indexes
 	for _, idx := range indexes {
-		fieldVal := doc.Get(idx.Field()) // missing fields are treated as null
-
-		err := idx.Add(doc.ObjectId(), fieldVal, doc.TTL())
+		covered, err := indexCovers(idx.Info(), doc)
 		if err != nil {
 			return err
 		}
+
+		if !covered {
+			continue
+		}
+
+		fieldVal := getIndexValue(doc, idx.Info()) // missing fields are treated as null
+
+		if err := idx.Add(doc.ObjectId(), fieldVal, doc.TTL()); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -267,9 +422,16 @@ func (s *storageImpl) Insert(collection string, docs ...*d.Document) error {
 		return err
 	}
 
-	indexes := s.getIndexes(txn, collection, meta)
+	indexes, err := s.getWritableIndexes(txn, collection, meta)
+	if err != nil {
+		return err
+	}
 
 	for _, doc := range docs {
+		if meta.Options.DefaultTTL > 0 && !doc.Has(d.ExpiresAtField) {
+			doc.SetExpiresAfter(meta.Options.DefaultTTL)
+		}
+
 		if err := s.addDocToIndexes(txn, indexes, doc); err != nil {
 			return err
 		}
@@ -280,7 +442,7 @@ func (s *storageImpl) Insert(collection string, docs ...*d.Document) error {
 			return ErrDuplicateKey
 		}
 
-		if err := saveDocument(doc, key, txn); err != nil {
+		if err := s.saveDocument(doc, key, txn); err != nil {
 			return err
 		}
 	}
@@ -293,8 +455,8 @@ func (s *storageImpl) Insert(collection string, docs ...*d.Document) error {
 	return txn.Commit()
 }
 
-func saveDocument(doc *d.Document, key []byte, txn *badger.Txn) error {
-	if err := d.Validate(doc); err != nil {
+func (s *storageImpl) saveDocument(doc *d.Document, key []byte, txn *badger.Txn) error {
+	if err := d.ValidateWithOptions(doc, &d.ValidateOptions{AllowZeroExpiresAt: s.conf.AllowZeroExpiresAt}); err != nil {
 		return err
 	}
 
@@ -319,7 +481,16 @@ func saveDocument(doc *d.Document, key []byte, txn *badger.Txn) error {
 
 func (s *storageImpl) deleteDocFromIndexes(txn *badger.Txn, indexes []index.Index, doc *d.Document) error {
 	for _, idx := range indexes {
-		value := doc.Get(idx.Field())
+		covered, err := indexCovers(idx.Info(), doc)
+		if err != nil {
+			return err
+		}
+
+		if !covered {
+			continue
+		}
+
+		value := getIndexValue(doc, idx.Info())
 		if err := idx.Remove(doc.ObjectId(), value); err != nil {
 			return err
 		}
@@ -342,7 +513,16 @@ func (s *storageImpl) getDocAndDeleteFromIndexes(txn *badger.Txn, indexes []inde
 	}
 
 	for _, idx := range indexes {
-		value := doc.Get(idx.Field())
+		covered, err := indexCovers(idx.Info(), doc)
+		if err != nil {
+			return err
+		}
+
+		if !covered {
+			continue
+		}
+
+		value := getIndexValue(doc, idx.Info())
 		if err := idx.Remove(doc.ObjectId(), value); err != nil {
 			return err
 		}
@@ -372,7 +552,10 @@ func (s *storageImpl) replaceDocs(txn *badger.Txn, q *query.Query, updater docUp
 		return err
 	}
 
-	indexes := s.getIndexes(txn, q.Collection(), meta)
+	indexes, err := s.getWritableIndexes(txn, q.Collection(), meta)
+	if err != nil {
+		return err
+	}
 
 	deletedDocs := 0
 	err = s.iterateDocs(txn, q, func(doc *d.Document) error {
@@ -388,7 +571,7 @@ func (s *storageImpl) replaceDocs(txn *badger.Txn, q *query.Query, updater docUp
 			return txn.Delete(docKey)
 		}
 
-		return saveDocument(newDoc, docKey, txn)
+		return s.saveDocument(newDoc, docKey, txn)
 	})
 
 	if err != nil {
@@ -439,7 +622,10 @@ func (s *storageImpl) DeleteById(collName string, id string) error {
 		return err
 	}
 
-	indexes := s.getIndexes(txn, collName, meta)
+	indexes, err := s.getWritableIndexes(txn, collName, meta)
+	if err != nil {
+		return err
+	}
 
 	if err := s.getDocAndDeleteFromIndexes(txn, indexes, collName, id); err != nil {
 		return err
@@ -463,7 +649,10 @@ func (s *storageImpl) UpdateById(collectionName string, docId string, updater fu
 			return err
 		}
 
-		indexes := s.getIndexes(txn, collectionName, meta)
+		indexes, err := s.getWritableIndexes(txn, collectionName, meta)
+		if err != nil {
+			return err
+		}
 
 		docKey := getDocumentKey(collectionName, docId)
 		item, err := txn.Get([]byte(docKey))
@@ -487,7 +676,7 @@ func (s *storageImpl) UpdateById(collectionName string, docId string, updater fu
 			return err
 		}
 
-		return saveDocument(updatedDoc, []byte(docKey), txn)
+		return s.saveDocument(updatedDoc, []byte(docKey), txn)
 	})
 }
 
@@ -565,7 +754,17 @@ func (s *storageImpl) ListCollections() ([]string, error) {
 	return collections, err
 }
 
-func (s *storageImpl) createIndex(collection, field string, indexType index.IndexType) error {
+func (s *storageImpl) createIndex(collection string, info index.IndexInfo) error {
+	if info.KeyFunc != "" && index.GetKeyFunc(info.KeyFunc) == nil {
+		return fmt.Errorf("%w: %s", index.ErrKeyFuncNotExist, info.KeyFunc)
+	}
+
+	if info.Filter != "" {
+		if _, err := getIndexFilter(info.Filter); err != nil {
+			return err
+		}
+	}
+
 	txn := s.db.NewTransaction(true)
 	defer txn.Discard()
 
@@ -575,36 +774,271 @@ func (s *storageImpl) createIndex(collection, field string, indexType index.Inde
 	}
 
 	for i := 0; i < len(meta.Indexes); i++ {
-		if meta.Indexes[i].Field == field {
+		if meta.Indexes[i].Field == info.Field {
 			return ErrIndexExist
 		}
 	}
 
+	if info.Type == index.IndexCompound && len(info.Fields) == 0 {
+		return fmt.Errorf("compound index requires at least one field")
+	}
+
+	if info.Unique && info.Type != index.IndexSingleField {
+		return fmt.Errorf("unique indexes must be of type %d", index.IndexSingleField)
+	}
+
 	if meta.Indexes == nil {
 		meta.Indexes = make([]index.IndexInfo, 0)
 	}
-	meta.Indexes = append(meta.Indexes, index.IndexInfo{Field: field, Type: indexType})
+	meta.Indexes = append(meta.Indexes, info)
+
+	idx := index.CreateBadgerIndexWithInfo(collection, info, txn)
+	if idx == nil {
+		return fmt.Errorf("invalid index type: %d", info.Type)
+	}
+
+	if err := s.indexDocs(txn, idx); err != nil {
+		return err
+	}
+
+	if err := s.saveCollectionMetadata(collection, meta, txn); err != nil {
+		return err
+	}
 
-	idx := index.CreateBadgerIndex(collection, field, indexType, txn)
+	return txn.Commit()
+}
 
-	err = s.iterateDocs(txn, query.NewQuery(collection), func(doc *d.Document) error {
-		value := doc.Get(field)
+// indexDocs adds to the index all the documents of its collection which it covers.
+func (s *storageImpl) indexDocs(txn *badger.Txn, idx index.Index) error {
+	info := idx.Info()
+	return s.iterateDocs(txn, query.NewQuery(idx.Collection()), func(doc *d.Document) error {
+		if covered, err := indexCovers(info, doc); !covered || err != nil {
+			return err
+		}
+
+		value := getIndexValue(doc, info)
 		return idx.Add(doc.ObjectId(), value, doc.TTL())
 	})
+}
+
+func (s *storageImpl) CreateIndex(collection, field string) error {
+	return s.createIndex(collection, index.IndexInfo{Field: field, Type: index.IndexSingleField})
+}
+
+func (s *storageImpl) CreateIndexWithInfo(collection string, info index.IndexInfo) error {
+	return s.createIndex(collection, info)
+}
+
+// CreateIndexStream builds a new index by streaming the documents of the collection, which are decoded in parallel.
+// Since index entries are written outside of the transaction adding the index to the collection,
+// documents inserted or updated while the index is being built may not be indexed:
+// it is meant to be used for bootstrapping indexes on collections which are not being modified.
+// If progress is not nil, it is called with the number of indexed documents after each written batch.
+func (s *storageImpl) CreateIndexStream(ctx context.Context, collection, field string, progress func(indexed int)) error {
+	indexed := false
+	err := s.db.View(func(txn *badger.Txn) error {
+		if _, err := s.getCollectionMeta(collection, txn); err != nil {
+			return err
+		}
+
+		var err error
+		indexed, err = s.hasIndex(txn, collection, field)
+		return err
+	})
 
 	if err != nil {
 		return err
 	}
 
-	if err := s.saveCollectionMetadata(collection, meta, txn); err != nil {
+	if indexed {
+		return ErrIndexExist
+	}
+
+	if err := s.streamIndexEntries(ctx, collection, field, progress); err != nil {
+		// remove the entries written before the failure
+		dropErr := s.db.Update(func(txn *badger.Txn) error {
+			return index.CreateBadgerIndexWithInfo(collection, index.IndexInfo{Field: field, Type: index.IndexSingleField}, txn).Drop()
+		})
+
+		if dropErr != nil {
+			log.Printf("CreateIndexStream(): %s\n", dropErr.Error())
+		}
 		return err
 	}
 
-	return txn.Commit()
+	return s.db.Update(func(txn *badger.Txn) error {
+		meta, err := s.getCollectionMeta(collection, txn)
+		if err != nil {
+			return err
+		}
+
+		for _, info := range meta.Indexes {
+			if info.Field == field {
+				return ErrIndexExist
+			}
+		}
+		meta.Indexes = append(meta.Indexes, index.IndexInfo{Field: field, Type: index.IndexSingleField})
+		return s.saveCollectionMetadata(collection, meta, txn)
+	})
 }
 
-func (s *storageImpl) CreateIndex(collection, field string) error {
-	return s.createIndex(collection, field, index.IndexSingleField)
+func (s *storageImpl) streamIndexEntries(ctx context.Context, collection, field string, progress func(indexed int)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var streamErr error
+
+	setErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if streamErr == nil {
+			streamErr = err
+		}
+		cancel()
+	}
+
+	stream := s.db.NewStream()
+	stream.Prefix = []byte(getDocumentKeyPrefix(collection))
+	stream.LogPrefix = "clover.CreateIndexStream"
+
+	// documents are decoded concurrently, and only their id and the value of the indexed field are sent
+	stream.KeyToList = func(key []byte, itr *badger.Iterator) (*pb.KVList, error) {
+		item := itr.Item()
+		if item.IsDeletedOrExpired() {
+			return nil, nil
+		}
+
+		var kv *pb.KV
+		err := item.Value(func(data []byte) error {
+			doc, err := d.Decode(data)
+			if err != nil {
+				return err
+			}
+
+			// values are always encoded as a list, since a document is indexed once per value when its field crosses an array
+			value := getIndexedValue(doc, field)
+			values := []interface{}{value}
+
+			multiValue, isMulti := value.(index.MultiValue)
+			if isMulti {
+				values = multiValue
+			}
+
+			encoded, err := internal.EncodeValue(values)
+			if err != nil {
+				return err
+			}
+
+			kv = &pb.KV{
+				Key:       []byte(doc.ObjectId()),
+				Value:     encoded,
+				ExpiresAt: item.ExpiresAt(),
+			}
+
+			if isMulti {
+				kv.UserMeta = []byte{streamedMultiValue}
+			}
+			return nil
+		})
+
+		if err != nil {
+			setErr(err)
+			return nil, err
+		}
+		return &pb.KVList{Kv: []*pb.KV{kv}}, nil
+	}
+
+	total := 0
+	stream.Send = func(buf *z.Buffer) error {
+		list, err := badger.BufferToKVList(buf)
+		if err != nil {
+			return err
+		}
+
+		n, err := s.writeIndexEntries(collection, field, list.Kv)
+		if err != nil {
+			return err
+		}
+
+		total += n
+		if progress != nil {
+			progress(total)
+		}
+		return nil
+	}
+
+	err := stream.Orchestrate(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if streamErr != nil {
+		return streamErr
+	}
+	return err
+}
+
+// streamedMultiValue is the user meta of the streamed documents whose field crosses an array of objects.
+// Their values are added back to the index as a MultiValue, which marks the index as multikey (see index.MultikeyIndex).
+const streamedMultiValue byte = 1
+
+type streamedEntry struct {
+	docId string
+	value interface{}
+	multi bool
+	ttl   time.Duration
+}
+
+// writeIndexEntries writes the supplied entries in index order, splitting them over multiple transactions if needed.
+func (s *storageImpl) writeIndexEntries(collection, field string, kvs []*pb.KV) (int, error) {
+	indexedDocs := 0
+	entries := make([]streamedEntry, 0, len(kvs))
+	for _, kv := range kvs {
+		decoded, err := internal.DecodeValue(kv.Value)
+		if err != nil {
+			return 0, err
+		}
+
+		ttl := time.Duration(-1)
+		if kv.ExpiresAt > 0 {
+			ttl = time.Until(time.Unix(int64(kv.ExpiresAt), 0))
+			if ttl <= 0 { // document already expired
+				continue
+			}
+		}
+
+		multi := len(kv.UserMeta) > 0 && kv.UserMeta[0] == streamedMultiValue
+		for _, value := range decoded.([]interface{}) {
+			entries = append(entries, streamedEntry{docId: string(kv.Key), value: value, multi: multi, ttl: ttl})
+		}
+		indexedDocs++
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if res := internal.Compare(entries[i].value, entries[j].value); res != 0 {
+			return res < 0
+		}
+		return entries[i].docId < entries[j].docId
+	})
+
+	batch, err := index.BeginBatch(s.db, collection, index.IndexInfo{Field: field, Type: index.IndexSingleField})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		value := entry.value
+		if entry.multi {
+			value = index.MultiValue{value}
+		}
+
+		if err := batch.Add(entry.docId, value, entry.ttl); err != nil {
+			return 0, err
+		}
+	}
+	return indexedDocs, batch.Commit()
 }
 
 func (s *storageImpl) DropIndex(collection, field string) error {
@@ -627,12 +1061,13 @@ func (s *storageImpl) DropIndex(collection, field string) error {
 		return ErrIndexNotExist
 	}
 
-	idxType := meta.Indexes[j].Type
+	info := meta.Indexes[j]
 
 	meta.Indexes[j] = meta.Indexes[0]
 	meta.Indexes = meta.Indexes[1:]
+	meta.clearStale(field)
 
-	idx := index.CreateBadgerIndex(collection, field, idxType, txn)
+	idx := index.CreateBadgerIndexWithInfo(collection, info, txn)
 
 	if err := idx.Drop(); err != nil {
 		return err
@@ -644,6 +1079,38 @@ func (s *storageImpl) DropIndex(collection, field string) error {
 	return txn.Commit()
 }
 
+func (s *storageImpl) RebuildIndex(collection, field string) error {
+	txn := s.db.NewTransaction(true)
+	defer txn.Discard()
+
+	meta, err := s.getCollectionMeta(collection, txn)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range meta.Indexes {
+		if info.Field != field {
+			continue
+		}
+
+		idx := index.CreateBadgerIndexWithInfo(collection, info, txn)
+		if err := idx.Drop(); err != nil {
+			return err
+		}
+
+		if err := s.indexDocs(txn, idx); err != nil {
+			return err
+		}
+
+		meta.clearStale(field)
+		if err := s.saveCollectionMetadata(collection, meta, txn); err != nil {
+			return err
+		}
+		return txn.Commit()
+	}
+	return ErrIndexNotExist
+}
+
 func (s *storageImpl) hasIndex(txn *badger.Txn, collection, field string) (bool, error) {
 	meta, err := s.getCollectionMeta(collection, txn)
 	if err == nil {
@@ -663,15 +1130,47 @@ func (s *storageImpl) HasIndex(collection, field string) (bool, error) {
 	return s.hasIndex(txn, collection, field)
 }
 
+// getIndexes returns the indexes of the collection, except for the stale ones (see collectionMetadata.StaleIndexes).
 func (s *storageImpl) getIndexes(txn *badger.Txn, collection string, meta *collectionMetadata) []index.Index {
 	indexes := make([]index.Index, 0)
 
 	for _, info := range meta.Indexes {
-		indexes = append(indexes, index.CreateBadgerIndex(collection, info.Field, info.Type, txn))
+		if !meta.isStale(info.Field) {
+			indexes = append(indexes, index.CreateBadgerIndexWithInfo(collection, info, txn))
+		}
 	}
 	return indexes
 }
 
+// getWritableIndexes is like getIndexes, but it is meant to be used by transactions modifying the collection:
+// rather than failing on partial indexes whose filter is not registered, it marks them as stale, so that they are rebuilt
+// before being used again, and it reports them once.
+func (s *storageImpl) getWritableIndexes(txn *badger.Txn, collection string, meta *collectionMetadata) ([]index.Index, error) {
+	indexes := make([]index.Index, 0)
+
+	stale := false
+	for _, idx := range s.getIndexes(txn, collection, meta) {
+		info := idx.Info()
+		if info.Filter != "" {
+			if _, err := getIndexFilter(info.Filter); err != nil {
+				log.Printf("index on field %q of collection %q is no longer maintained: %s (rebuild it once the filter is registered)\n", info.Field, collection, err.Error())
+
+				meta.StaleIndexes = append(meta.StaleIndexes, info.Field)
+				stale = true
+				continue
+			}
+		}
+		indexes = append(indexes, idx)
+	}
+
+	if stale {
+		if err := s.saveCollectionMetadata(collection, meta, txn); err != nil {
+			return nil, err
+		}
+	}
+	return indexes, nil
+}
+
 func (s *storageImpl) listIndexes(collection string, txn *badger.Txn) ([]index.IndexInfo, error) {
 	meta, err := s.getCollectionMeta(collection, txn)
 	return meta.Indexes, err
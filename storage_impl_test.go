@@ -0,0 +1,175 @@
+package clover
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v3"
+
+	d "github.com/ostafen/clover/v2/document"
+	"github.com/ostafen/clover/v2/index"
+	q "github.com/ostafen/clover/v2/query"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgradeLegacyIndexes(t *testing.T) {
+	dir, err := os.MkdirTemp("", "clover-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := NewDefaultStorage()
+	require.NoError(t, s.Open(dir, defaultConfig()))
+
+	require.NoError(t, s.CreateCollection("test"))
+	for i := 0; i < 10; i++ {
+		doc := d.NewDocument()
+		doc.Set("_id", NewObjectId())
+		doc.Set("n", i)
+		require.NoError(t, s.Insert("test", doc))
+	}
+	require.NoError(t, s.CreateIndex("test", "n"))
+
+	// turn the collection into one written by a release using the legacy key layout
+	txn := s.db.NewTransaction(true)
+	meta, err := s.getCollectionMeta("test", txn)
+	require.NoError(t, err)
+	meta.IndexFormat = 0
+	require.NoError(t, s.saveCollectionMetadata("test", meta, txn))
+	require.NoError(t, txn.Set([]byte("c:test;i:n;\xff"), nil))
+	require.NoError(t, txn.Commit())
+	require.NoError(t, s.Close())
+
+	s = NewDefaultStorage()
+	require.NoError(t, s.Open(dir, defaultConfig()))
+	defer s.Close()
+
+	txn = s.db.NewTransaction(false)
+	meta, err = s.getCollectionMeta("test", txn)
+	txn.Discard()
+	require.NoError(t, err)
+	require.Equal(t, index.KeyFormatVersion, meta.IndexFormat)
+
+	docs, err := s.FindAll(q.NewQuery("test").Where(q.Field("n").Gt(int64(4))).Sort(q.SortOption{Field: "n"}))
+	require.NoError(t, err)
+	require.Len(t, docs, 5)
+}
+
+func TestUnregisteredIndexFilter(t *testing.T) {
+	db, err := Open("", InMemoryMode(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.CreateCollection("posts"))
+	require.NoError(t, RegisterIndexFilter("unregistered", q.Field("archived").Eq(false)))
+
+	insert := func(n int, archived bool) {
+		doc := d.NewDocument()
+		doc.Set("n", n)
+		doc.Set("archived", archived)
+		require.NoError(t, db.Insert("posts", doc))
+	}
+
+	insert(0, false)
+	insert(1, true)
+	require.NoError(t, db.CreateIndex("posts", "n", WithFilter("unregistered")))
+
+	// as after reopening the database without registering the filter again
+	indexFilters.Delete("unregistered")
+
+	insert(2, false)
+	require.NoError(t, db.Update(q.NewQuery("posts").Where(q.Field("n").Eq(0)), map[string]interface{}{"archived": true}))
+
+	isStale := func() bool {
+		txn := db.engine.(*storageImpl).db.NewTransaction(false)
+		defer txn.Discard()
+
+		meta, err := db.engine.(*storageImpl).getCollectionMeta("posts", txn)
+		require.NoError(t, err)
+		return meta.isStale("n")
+	}
+	require.True(t, isStale())
+
+	require.NoError(t, RegisterIndexFilter("unregistered", q.Field("archived").Eq(false)))
+
+	getNs := func() []int64 {
+		docs, err := db.FindAll(q.NewQuery("posts").Where(q.Field("archived").Eq(false).And(q.Field("n").GtEq(0))))
+		require.NoError(t, err)
+
+		ns := make([]int64, 0, len(docs))
+		for _, doc := range docs {
+			ns = append(ns, doc.Get("n").(int64))
+		}
+		return ns
+	}
+
+	// the stale index is ignored until it is rebuilt
+	require.Equal(t, []int64{2}, getNs())
+
+	require.NoError(t, db.RebuildIndex("posts", "n"))
+	require.False(t, isStale())
+	require.Equal(t, []int64{2}, getNs())
+}
+
+func TestCreateIndexStreamMatchesCreateIndex(t *testing.T) {
+	db, err := Open("", InMemoryMode(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.CreateCollection("test"))
+
+	values := []interface{}{nil, 1, -2.5, "clover", true, []interface{}{3, "a", 3}, map[string]interface{}{"x": 1}}
+	docs := make([]*d.Document, 0)
+	for i := 0; i < 1000; i++ {
+		doc := d.NewDocument()
+		if i%10 != 0 {
+			doc.Set("value", values[i%len(values)])
+		}
+		if i%3 == 0 {
+			doc.SetExpiresAfter(time.Hour)
+		}
+		docs = append(docs, doc)
+	}
+	require.NoError(t, db.Insert("test", docs...))
+
+	s := db.engine.(*storageImpl)
+
+	type entry struct {
+		key       string
+		expiresAt uint64
+	}
+
+	getEntries := func() []entry {
+		entries := make([]entry, 0)
+		err := s.db.View(func(txn *badger.Txn) error {
+			prefix := []byte("c:test;i:value;")
+
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				entries = append(entries, entry{key: string(it.Item().KeyCopy(nil)), expiresAt: it.Item().ExpiresAt()})
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		return entries
+	}
+
+	require.NoError(t, db.CreateIndexStream(context.Background(), "test", "value", nil))
+	streamed := getEntries()
+	require.NotEmpty(t, streamed)
+
+	require.NoError(t, db.DropIndex("test", "value"))
+	require.Empty(t, getEntries())
+
+	require.NoError(t, db.CreateIndex("test", "value"))
+	serial := getEntries()
+	require.Len(t, serial, len(streamed))
+
+	for i := range serial {
+		require.Equal(t, serial[i].key, streamed[i].key)
+		require.InDelta(t, serial[i].expiresAt, streamed[i].expiresAt, 1) // expirations are derived from TTLs, computed at different times
+	}
+}
@@ -51,3 +51,32 @@ func StringSliceToSet(s []string) map[string]bool {
 	}
 	return set
 }
+
+// DeepCopyMap returns a copy of m where nested maps and slices are recursively copied.
+func DeepCopyMap(m map[string]interface{}) map[string]interface{} {
+	mapCopy := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		mapCopy[k] = DeepCopyValue(v)
+	}
+	return mapCopy
+}
+
+// DeepCopyValue returns a copy of v where nested maps and slices, including byte slices, are recursively copied.
+func DeepCopyValue(v interface{}) interface{} {
+	switch vType := v.(type) {
+	case map[string]interface{}:
+		return DeepCopyMap(vType)
+	case []byte:
+		if vType == nil {
+			return vType
+		}
+		return append(make([]byte, 0, len(vType)), vType...)
+	case []interface{}:
+		sliceCopy := make([]interface{}, len(vType))
+		for i, elem := range vType {
+			sliceCopy[i] = DeepCopyValue(elem)
+		}
+		return sliceCopy
+	}
+	return v
+}
@@ -51,6 +51,11 @@ func (v *NotFlattenVisitor) removeNotCriteria(c *query.NotCriteria) query.Criter
 
 	unaryCriteria := innerNode.(*query.UnaryCriteria)
 
+	// no element must satisfy the negated criteria, which is not the same as some element satisfying the opposite one
+	if unaryCriteria.MatchElements {
+		return c
+	}
+
 	switch unaryCriteria.OpType {
 	case query.EqOp:
 		return &query.BinaryCriteria{
@@ -101,20 +106,36 @@ type IndexSelectVisitor struct {
 
 func (v *IndexSelectVisitor) VisitUnaryCriteria(c *query.UnaryCriteria) interface{} {
 	info := v.Fields[c.Field]
-	if info != nil {
+
+	// hash indexes can only serve equality criteria
+	if info != nil && (info.Type != index.IndexHash || c.OpType == query.EqOp) {
 		return []*index.IndexInfo{info}
 	}
 	return []*index.IndexInfo{}
 }
 
+// onlyHashIndexes reports whether all the supplied indexes are hash indexes, whose lookups are the cheapest ones.
+func onlyHashIndexes(infos []*index.IndexInfo) bool {
+	for _, info := range infos {
+		if info.Type != index.IndexHash {
+			return false
+		}
+	}
+	return len(infos) > 0
+}
+
 func (v *IndexSelectVisitor) VisitBinaryCriteria(c *query.BinaryCriteria) interface{} {
 	leftIndexes := c.C1.Accept(v).([]*index.IndexInfo)
 	rightIndexes := c.C2.Accept(v).([]*index.IndexInfo)
 
-	if c.OpType == query.LogicalAnd { // select the indexes with the lowest number of queries
+	if c.OpType == query.LogicalAnd { // select the indexes with the lowest number of queries, preferring hash lookups on ties
 		if len(leftIndexes) > 0 && len(leftIndexes) < len(rightIndexes) {
 			return leftIndexes
 		}
+
+		if len(leftIndexes) == len(rightIndexes) && onlyHashIndexes(leftIndexes) {
+			return leftIndexes
+		}
 		return rightIndexes
 	}
 
@@ -133,8 +154,9 @@ func (v *IndexSelectVisitor) VisitBinaryCriteria(c *query.BinaryCriteria) interf
 	return res
 }
 
+// VisitNotCriteria selects no index, since the criteria which cannot be flattened (see NotFlattenVisitor) have no range.
 func (v *IndexSelectVisitor) VisitNotCriteria(c *query.NotCriteria) interface{} {
-	return nil
+	return []*index.IndexInfo{}
 }
 
 type FieldRangeVisitor struct {
@@ -178,7 +200,7 @@ func (v *FieldRangeVisitor) VisitBinaryCriteria(c *query.BinaryCriteria) interfa
 }
 
 func (v *FieldRangeVisitor) VisitNotCriteria(c *query.NotCriteria) interface{} {
-	return c.C.Accept(v)
+	return map[string]*index.Range{}
 }
 
 type CriteriaNormalizeVisitor struct {
@@ -200,9 +222,10 @@ func (v *CriteriaNormalizeVisitor) VisitUnaryCriteria(c *query.UnaryCriteria) in
 	}
 
 	return &query.UnaryCriteria{
-		Field:  c.Field,
-		OpType: c.OpType,
-		Value:  normValue,
+		Field:         c.Field,
+		OpType:        c.OpType,
+		Value:         normValue,
+		MatchElements: c.MatchElements,
 	}
 }
 
@@ -269,3 +292,41 @@ func unaryCriteriaToRange(c *query.UnaryCriteria) *index.Range {
 	}
 	return nil
 }
+
+// KeyFuncVisitor sets the KeyFunc of the criteria on fields whose index derives keys through a KeyFunc,
+// so that documents are filtered according to the same ordering of the index.
+type KeyFuncVisitor struct {
+	KeyFuncs map[string]index.KeyFunc
+}
+
+func (v *KeyFuncVisitor) VisitUnaryCriteria(c *query.UnaryCriteria) interface{} {
+	keyFunc := v.KeyFuncs[c.Field]
+	if keyFunc == nil {
+		return c
+	}
+
+	return &query.UnaryCriteria{
+		Field:         c.Field,
+		OpType:        c.OpType,
+		Value:         c.Value,
+		MatchElements: c.MatchElements,
+		KeyFunc: func(value interface{}) interface{} {
+			if key, ok := keyFunc(value); ok {
+				return key
+			}
+			return value
+		},
+	}
+}
+
+func (v *KeyFuncVisitor) VisitBinaryCriteria(c *query.BinaryCriteria) interface{} {
+	return &query.BinaryCriteria{
+		OpType: c.OpType,
+		C1:     c.C1.Accept(v).(query.Criteria),
+		C2:     c.C2.Accept(v).(query.Criteria),
+	}
+}
+
+func (v *KeyFuncVisitor) VisitNotCriteria(c *query.NotCriteria) interface{} {
+	return &query.NotCriteria{C: c.C.Accept(v).(query.Criteria)}
+}
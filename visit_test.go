@@ -85,3 +85,25 @@ func TestSelectIndexes(t *testing.T) {
 	require.Equal(t, s[0], &index.IndexInfo{Field: "a"})
 	require.Equal(t, s[1], &index.IndexInfo{Field: "b"})
 }
+
+func TestSelectHashIndexes(t *testing.T) {
+	hashIndexes := map[string]*index.IndexInfo{
+		"a": {Field: "a", Type: index.IndexHash},
+		"b": {Field: "b", Type: index.IndexSingleField},
+	}
+
+	selectIndexes := func(c q.Criteria) []*index.IndexInfo {
+		c = c.Accept(&CriteriaNormalizeVisitor{}).(q.Criteria)
+		c = c.Accept(&NotFlattenVisitor{}).(q.Criteria)
+		return c.Accept(&IndexSelectVisitor{Fields: hashIndexes}).([]*index.IndexInfo)
+	}
+
+	// equality lookups prefer hash indexes
+	require.Equal(t, []*index.IndexInfo{hashIndexes["a"]}, selectIndexes(q.Field("a").Eq(1).And(q.Field("b").Eq(2))))
+	require.Equal(t, []*index.IndexInfo{hashIndexes["a"]}, selectIndexes(q.Field("b").Eq(2).And(q.Field("a").Eq(1))))
+
+	// hash indexes cannot serve range criteria
+	require.Empty(t, selectIndexes(q.Field("a").Gt(1)))
+	require.Empty(t, selectIndexes(q.Field("a").Eq(1).Not()))
+	require.Equal(t, []*index.IndexInfo{hashIndexes["b"]}, selectIndexes(q.Field("a").Gt(1).And(q.Field("b").Eq(2))))
+}